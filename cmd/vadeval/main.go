@@ -0,0 +1,137 @@
+// Command vadeval measures the VAD against labelled audio.
+//
+//	vadeval generate -dir corpus -items 20 -snr 10
+//	vadeval sweep -corpus corpus -method energy \
+//		-param speech-threshold=6:18:3 -param smoothing=0,0.3,0.6 \
+//		-csv roc.csv -json roc.json
+//
+// sweep reads every WAV file in the corpus directory with an Audacity label
+// file (.txt) or RTTM file (.rttm) of the same name beside it.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/garlicgarrison/go-recorder/vad"
+	"github.com/garlicgarrison/go-recorder/vad/eval"
+)
+
+func main() {
+	log.SetFlags(0)
+	if len(os.Args) < 2 {
+		usage()
+	}
+
+	switch os.Args[1] {
+	case "generate":
+		generate(os.Args[2:])
+	case "sweep":
+		sweep(os.Args[2:])
+	default:
+		usage()
+	}
+}
+
+func usage() {
+	log.Fatalf("usage: vadeval generate|sweep [flags]\nparameters: %s", strings.Join(eval.Params(), ", "))
+}
+
+func generate(args []string) {
+	cfg := eval.DefaultCorpusConfig()
+	fs := flag.NewFlagSet("generate", flag.ExitOnError)
+	dir := fs.String("dir", "corpus", "directory to write the corpus to")
+	fs.IntVar(&cfg.Items, "items", cfg.Items, "recordings to generate")
+	fs.IntVar(&cfg.SampleRate, "rate", cfg.SampleRate, "sample rate")
+	fs.DurationVar(&cfg.Duration, "duration", cfg.Duration, "length of each recording")
+	fs.Float64Var(&cfg.SNR, "snr", cfg.SNR, "dB of speech over noise")
+	fs.Float64Var(&cfg.Level, "level", cfg.Level, "dB of speech below full scale")
+	fs.Int64Var(&cfg.Seed, "seed", cfg.Seed, "random seed")
+	fs.Parse(args)
+
+	items, err := eval.Generate(cfg)
+	if err != nil {
+		log.Fatalf("generate error -- %s", err)
+	}
+
+	err = eval.WriteCorpus(*dir, items)
+	if err != nil {
+		log.Fatalf("write error -- %s", err)
+	}
+	fmt.Printf("wrote %d recordings to %s\n", len(items), *dir)
+}
+
+// paramFlags collects repeated -param flags
+type paramFlags []eval.Param
+
+func (p *paramFlags) String() string {
+	return fmt.Sprint(*p)
+}
+
+func (p *paramFlags) Set(spec string) error {
+	param, err := eval.ParseParam(spec)
+	if err != nil {
+		return err
+	}
+	*p = append(*p, param)
+	return nil
+}
+
+func sweep(args []string) {
+	cfg := vad.DefaultVADConfig()
+	var sweep paramFlags
+	fs := flag.NewFlagSet("sweep", flag.ExitOnError)
+	corpus := fs.String("corpus", "corpus", "directory of labelled wav files")
+	method := fs.String("method", string(vad.EnergyMethod), "energy, spectral or webrtc")
+	noise := fs.String("noise", string(vad.AverageTracking), "noise floor tracking, average or minimum")
+	csvPath := fs.String("csv", "", "file to write the points as CSV to")
+	jsonPath := fs.String("json", "", "file to write the points as JSON to")
+	fs.Var(&sweep, "param", "name=v1,v2,... or name=from:to:step, repeatable")
+	fs.Parse(args)
+	cfg.Method = vad.Method(*method)
+	cfg.NoiseTracking = vad.NoiseTracking(*noise)
+
+	items, err := eval.LoadCorpus(*corpus)
+	if err != nil {
+		log.Fatalf("corpus error -- %s", err)
+	}
+
+	points, err := eval.Sweep(cfg, sweep, items)
+	if err != nil {
+		log.Fatalf("sweep error -- %s", err)
+	}
+	points = eval.ROC(points)
+
+	for _, p := range points {
+		m := p.Metrics
+		fmt.Printf("%v\tP %.3f\tR %.3f\tF1 %.3f\tFPR %.3f\tonset %s\toffset %s\tFA/h %.1f\n",
+			p.Params, m.Precision, m.Recall, m.F1, m.FalsePositiveRate,
+			m.OnsetLatency, m.OffsetLatency, m.FalseAlarmsPerHour)
+	}
+	if best, ok := eval.Best(points); ok {
+		fmt.Printf("best F1 %.3f at %v\n", best.Metrics.F1, best.Params)
+	}
+
+	if *csvPath != "" {
+		write(*csvPath, func(f *os.File) error { return eval.WriteCSV(f, points) })
+	}
+	if *jsonPath != "" {
+		write(*jsonPath, func(f *os.File) error { return eval.WriteJSON(f, points) })
+	}
+}
+
+func write(path string, report func(f *os.File) error) {
+	f, err := os.Create(path)
+	if err != nil {
+		log.Fatalf("file creation error -- %s", err)
+	}
+	defer f.Close()
+
+	err = report(f)
+	if err != nil {
+		log.Fatalf("write error -- %s", err)
+	}
+}
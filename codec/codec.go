@@ -12,6 +12,12 @@ var (
 	ErrInvalidWAV = errors.New("invalid wav file")
 )
 
+// bytes written before the samples
+const (
+	wavHeaderSize  = 44
+	aiffHeaderSize = 54
+)
+
 type WAVHeader struct {
 	RIFF          [4]byte // "RIFF"
 	TotalSize     uint32  // Total file size DEFAULT: 36 + 4*numSamples
@@ -56,6 +62,7 @@ func NewDefaultWAV(stream []int32) *WAVFile {
 
 func (f *WAVFile) EncodeWAV() (*bytes.Buffer, error) {
 	var buf bytes.Buffer
+	buf.Grow(wavHeaderSize + 4*len(f.Data))
 	w := bufio.NewWriter(&buf)
 
 	// format
@@ -226,6 +233,7 @@ func NewDefaultAIFF(stream []int32) *AIFFFile {
 
 func (f *AIFFFile) EncodeAIFF() (*bytes.Buffer, error) {
 	var buf bytes.Buffer
+	buf.Grow(aiffHeaderSize + 4*len(f.Data))
 	w := bufio.NewWriter(&buf)
 
 	// format
@@ -310,17 +318,30 @@ func (f *AIFFFile) EncodeAIFF() (*bytes.Buffer, error) {
 	return &buf, nil
 }
 
+// writeRawAudio encodes through a fixed scratch buffer; binary.Write per
+// sample allocates on every call
 func writeRawAudio(w *bufio.Writer, endian bool, fullStream []int32) error {
-	for _, frame := range fullStream {
-		var err error
-		if endian {
-			err = binary.Write(w, binary.BigEndian, frame)
-		} else {
-			err = binary.Write(w, binary.LittleEndian, frame)
+	var order binary.ByteOrder = binary.LittleEndian
+	if endian {
+		order = binary.BigEndian
+	}
+
+	var scratch [4096]byte
+	for len(fullStream) > 0 {
+		n := len(fullStream)
+		if n > len(scratch)/4 {
+			n = len(scratch) / 4
 		}
+
+		for i, frame := range fullStream[:n] {
+			order.PutUint32(scratch[4*i:], uint32(frame))
+		}
+
+		_, err := w.Write(scratch[:4*n])
 		if err != nil {
 			return err
 		}
+		fullStream = fullStream[n:]
 	}
 
 	return nil
@@ -70,3 +70,23 @@ func TestEncodeDecodeWAV(t *testing.T) {
 		t.Fatalf("decode error -- %s", err)
 	}
 }
+
+func TestEncodedSize(t *testing.T) {
+	waves := getTestData(1)
+
+	wav, err := NewDefaultWAV(waves).EncodeWAV()
+	if err != nil {
+		t.Fatalf("encoding error - %s", err)
+	}
+	if wav.Len() != wavHeaderSize+4*len(waves) {
+		t.Errorf("wav is %d bytes, want %d", wav.Len(), wavHeaderSize+4*len(waves))
+	}
+
+	aiff, err := NewDefaultAIFF(waves).EncodeAIFF()
+	if err != nil {
+		t.Fatalf("encoding error - %s", err)
+	}
+	if aiff.Len() != aiffHeaderSize+4*len(waves) {
+		t.Errorf("aiff is %d bytes, want %d", aiff.Len(), aiffHeaderSize+4*len(waves))
+	}
+}
@@ -0,0 +1,405 @@
+// Package diarize works out who spoke when in a recording: it splits the
+// VAD's speech segments where the speaker changes and clusters the pieces
+// into speakers, comparing Gaussians of MFCC features by the Bayesian
+// information criterion.
+package diarize
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/garlicgarrison/go-recorder/codec"
+	"github.com/garlicgarrison/go-recorder/dsp"
+	"github.com/garlicgarrison/go-recorder/label"
+	"github.com/garlicgarrison/go-recorder/vad"
+)
+
+const (
+	DefaultMinTurn        = 1000 // milliseconds
+	DefaultChangePenalty  = 1.5
+	DefaultClusterPenalty = 2.0
+
+	// feature frames between the places a change is looked for
+	changeStep = 5
+)
+
+var (
+	ErrInvalidConfig = errors.New("invalid diarize config")
+)
+
+type Config struct {
+	// finds the speech in Diarize; nil is vad.DefaultVADConfig
+	VADConfig *vad.VADConfig
+
+	// the most speakers to find, 0 for as many as the criterion tells
+	// apart
+	MaxSpeakers int
+
+	// milliseconds; no change is found nearer than this to another or to
+	// the end of a segment, and turns shorter than this take the speaker
+	// they sound most like rather than starting one
+	MinTurn int
+
+	// scale the cost of a second model's parameters against how much
+	// better it fits, for finding changes and for keeping speakers apart:
+	// higher finds fewer
+	ChangePenalty  float64
+	ClusterPenalty float64
+}
+
+func DefaultConfig() *Config {
+	return &Config{
+		MinTurn:        DefaultMinTurn,
+		ChangePenalty:  DefaultChangePenalty,
+		ClusterPenalty: DefaultClusterPenalty,
+	}
+}
+
+func (c *Config) Validate() error {
+	switch {
+	case c == nil:
+		return ErrInvalidConfig
+	case c.MaxSpeakers < 0:
+		return fmt.Errorf("%w: MaxSpeakers must not be negative", ErrInvalidConfig)
+	case c.MinTurn <= 0:
+		return fmt.Errorf("%w: MinTurn must be positive", ErrInvalidConfig)
+	case c.ChangePenalty <= 0:
+		return fmt.Errorf("%w: ChangePenalty must be positive", ErrInvalidConfig)
+	case c.ClusterPenalty <= 0:
+		return fmt.Errorf("%w: ClusterPenalty must be positive", ErrInvalidConfig)
+	}
+	return nil
+}
+
+// Turn is a stretch of speech by one speaker, numbered from 0 in the order
+// they first speak
+type Turn struct {
+	Start   time.Duration
+	End     time.Duration
+	Speaker int
+}
+
+// Name is the speaker's label, speaker_0 onwards
+func (t Turn) Name() string {
+	return fmt.Sprintf("speaker_%d", t.Speaker)
+}
+
+// Diarize finds the speech in a WAV file with the VAD and who speaks in it
+func Diarize(cfg *Config, wav *codec.WAVFile) ([]Turn, error) {
+	err := cfg.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	vadCfg := cfg.VADConfig
+	if vadCfg == nil {
+		vadCfg = vad.DefaultVADConfig()
+	}
+	segments, err := vad.AnalyzeFile(vadCfg, wav)
+	if err != nil {
+		return nil, err
+	}
+	return DiarizeSegments(cfg, wav, segments)
+}
+
+// DiarizeSegments splits the speech segments of a WAV file into turns and
+// finds who speaks in each
+func DiarizeSegments(cfg *Config, wav *codec.WAVFile, segments []vad.Segment) ([]Turn, error) {
+	err := cfg.Validate()
+	if err != nil {
+		return nil, err
+	}
+	if wav.Header.SampleRate == 0 || wav.Header.NumChannels == 0 {
+		return nil, fmt.Errorf("%w: WAV header has no sample rate or channels", ErrInvalidConfig)
+	}
+
+	d, err := newDiarizer(cfg, wav)
+	if err != nil {
+		return nil, err
+	}
+
+	var turns []*turn
+	for _, s := range segments {
+		turns = append(turns, d.split(s)...)
+	}
+	if len(turns) == 0 {
+		return nil, nil
+	}
+
+	d.cluster(turns)
+	return d.label(turns), nil
+}
+
+// Labels converts turns to labels named by speaker
+func Labels(turns []Turn) []label.Label {
+	labels := make([]label.Label, len(turns))
+	for i, t := range turns {
+		labels[i] = label.Label{Start: t.Start, End: t.End, Name: t.Name()}
+	}
+	return labels
+}
+
+// WriteRTTM writes turns as the SPEAKER lines of an RTTM file
+func WriteRTTM(w io.Writer, file string, turns []Turn) error {
+	return label.WriteRTTM(w, file, Labels(turns))
+}
+
+type diarizer struct {
+	cfg  *Config
+	rate float64
+	hop  int
+
+	// the centre of frame i is i*hop + centre samples in
+	centre int
+
+	vectors [][]float64
+	minTurn int // frames
+}
+
+// turn is a piece of a segment, its feature frames and, once clustered,
+// its speaker's cluster
+type turn struct {
+	start, end  time.Duration
+	first, last int // frames [first, last)
+	stats       *gaussian
+	cluster     int
+}
+
+func newDiarizer(cfg *Config, wav *codec.WAVFile) (*diarizer, error) {
+	rate := float64(wav.Header.SampleRate)
+	features, err := dsp.NewFeatures(rate)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidConfig, err)
+	}
+
+	channels := int(wav.Header.NumChannels)
+	mono := make([]float64, len(wav.Data)/channels)
+	for i := range mono {
+		sum := 0.0
+		for _, amp := range wav.Data[i*channels : (i+1)*channels] {
+			sum += float64(amp)
+		}
+		mono[i] = sum / float64(channels)
+	}
+
+	d := &diarizer{
+		cfg:     cfg,
+		rate:    rate,
+		hop:     features.Hop(),
+		centre:  features.FrameLength() / 2,
+		minTurn: cfg.MinTurn / dsp.FeatureHopTime,
+	}
+
+	// the energy coefficient is left out, so loudness does not tell
+	// speakers apart
+	features.Add(mono, func(vector []float64, energy float64) {
+		d.vectors = append(d.vectors, append([]float64(nil), vector...))
+	})
+	return d, nil
+}
+
+// frame is the first frame centred at or after a time
+func (d *diarizer) frame(t time.Duration) int {
+	sample := int(math.Ceil(t.Seconds() * d.rate))
+	f := (sample - d.centre + d.hop - 1) / d.hop
+	if f < 0 {
+		return 0
+	}
+	if f > len(d.vectors) {
+		return len(d.vectors)
+	}
+	return f
+}
+
+// time is the centre of a frame
+func (d *diarizer) time(frame int) time.Duration {
+	return time.Duration(float64(frame*d.hop+d.centre) / d.rate * float64(time.Second))
+}
+
+func (d *diarizer) stats(first, last int) *gaussian {
+	g := newGaussian(dsp.FeatureSize)
+	for _, v := range d.vectors[first:last] {
+		g.add(v)
+	}
+	return g
+}
+
+// split cuts a segment where the speaker changes
+func (d *diarizer) split(s vad.Segment) []*turn {
+	first, last := d.frame(s.Start), d.frame(s.End)
+	if last < first {
+		last = first
+	}
+	return d.splitFrames(&turn{
+		start: s.Start,
+		end:   s.End,
+		first: first,
+		last:  last,
+		stats: d.stats(first, last),
+	})
+}
+
+// splitFrames cuts a turn at its likeliest change, if the criterion finds
+// one, and the pieces again until none do
+func (d *diarizer) splitFrames(t *turn) []*turn {
+	if t.last-t.first < 2*d.minTurn {
+		return []*turn{t}
+	}
+
+	whole := t.stats.logDet()
+	left := newGaussian(dsp.FeatureSize)
+	best, at := 0.0, -1
+	next := t.first
+	for c := t.first + d.minTurn; c <= t.last-d.minTurn; c += changeStep {
+		for ; next < c; next++ {
+			left.add(d.vectors[next])
+		}
+		right := t.stats.clone()
+		right.addWeighted(left, -1)
+
+		delta := deltaBICOf(t.stats, left, right, whole, d.cfg.ChangePenalty)
+		if delta > best {
+			best, at = delta, c
+		}
+	}
+	if at < 0 {
+		return []*turn{t}
+	}
+
+	change := d.time(at)
+	a := &turn{start: t.start, end: change, first: t.first, last: at, stats: d.stats(t.first, at)}
+	b := &turn{start: change, end: t.end, first: at, last: t.last, stats: d.stats(at, t.last)}
+	return append(d.splitFrames(a), d.splitFrames(b)...)
+}
+
+// cluster merges the turns at least MinTurn long into speakers, the closest
+// two at a time, while the criterion finds them alike or there are more
+// than MaxSpeakers, then gives each shorter turn the speaker whose model
+// fits it best
+func (d *diarizer) cluster(turns []*turn) {
+	var long []*turn
+	for _, t := range turns {
+		if t.last-t.first >= d.minTurn {
+			long = append(long, t)
+		}
+	}
+	if len(long) == 0 {
+		long = turns
+	}
+
+	clusters := make([]*gaussian, len(long))
+	for i, t := range long {
+		clusters[i] = t.stats.clone()
+		t.cluster = i
+	}
+
+	distance := make([][]float64, len(clusters))
+	for i := range distance {
+		distance[i] = make([]float64, len(clusters))
+		for j := 0; j < i; j++ {
+			distance[i][j] = deltaBIC(clusters[i], clusters[j], d.cfg.ClusterPenalty)
+		}
+	}
+
+	alive := make([]bool, len(clusters))
+	for i := range alive {
+		alive[i] = true
+	}
+	for count := len(clusters); count > 1; count-- {
+		bi, bj, best := -1, -1, math.Inf(1)
+		for i := range clusters {
+			for j := 0; j < i; j++ {
+				if alive[i] && alive[j] && distance[i][j] < best {
+					bi, bj, best = i, j, distance[i][j]
+				}
+			}
+		}
+		over := d.cfg.MaxSpeakers > 0 && count > d.cfg.MaxSpeakers
+		if best >= 0 && !over {
+			break
+		}
+
+		// fold bi into bj
+		clusters[bj].addWeighted(clusters[bi], 1)
+		alive[bi] = false
+		for _, t := range long {
+			if t.cluster == bi {
+				t.cluster = bj
+			}
+		}
+		for k := range clusters {
+			if alive[k] && k != bj {
+				delta := deltaBIC(clusters[bj], clusters[k], d.cfg.ClusterPenalty)
+				if k < bj {
+					distance[bj][k] = delta
+				} else {
+					distance[k][bj] = delta
+				}
+			}
+		}
+	}
+
+	if len(long) == len(turns) {
+		return
+	}
+
+	models := make(map[int]*model)
+	for i, c := range clusters {
+		if alive[i] {
+			models[i] = c.model()
+		}
+	}
+	for _, t := range turns {
+		if t.last-t.first >= d.minTurn {
+			continue
+		}
+		t.cluster = d.nearest(t, models)
+	}
+}
+
+// nearest is the cluster whose model gives a short turn's frames the
+// highest likelihood, or the lowest numbered if it has none
+func (d *diarizer) nearest(t *turn, models map[int]*model) int {
+	ids := make([]int, 0, len(models))
+	for id := range models {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	best, nearest := math.Inf(-1), ids[0]
+	for _, id := range ids {
+		sum := 0.0
+		for _, v := range d.vectors[t.first:t.last] {
+			sum += models[id].logLikelihood(v)
+		}
+		if t.last > t.first && sum > best {
+			best, nearest = sum, id
+		}
+	}
+	return nearest
+}
+
+// label numbers the clusters by first turn and joins the pieces of a
+// segment the same speaker was found either side of a change in
+func (d *diarizer) label(turns []*turn) []Turn {
+	speakers := make(map[int]int)
+	var out []Turn
+	for _, t := range turns {
+		speaker, ok := speakers[t.cluster]
+		if !ok {
+			speaker = len(speakers)
+			speakers[t.cluster] = speaker
+		}
+
+		if n := len(out); n > 0 && out[n-1].Speaker == speaker && out[n-1].End == t.start {
+			out[n-1].End = t.end
+			continue
+		}
+		out = append(out, Turn{Start: t.start, End: t.end, Speaker: speaker})
+	}
+	return out
+}
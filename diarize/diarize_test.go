@@ -0,0 +1,181 @@
+package diarize
+
+import (
+	"bytes"
+	"math"
+	"math/rand"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/garlicgarrison/go-recorder/codec"
+	"github.com/garlicgarrison/go-recorder/vad"
+	"github.com/stretchr/testify/assert"
+)
+
+const testRate = 16000
+
+// speaker is a synthetic voice: harmonics of a pitch shaped by two
+// formants that wander like changing vowels
+type speaker struct {
+	pitch    float64
+	formants [2]float64
+}
+
+var (
+	low  = speaker{pitch: 110, formants: [2]float64{500, 1500}}
+	high = speaker{pitch: 220, formants: [2]float64{850, 2600}}
+)
+
+type conversation struct {
+	rng     *rand.Rand
+	samples []float64
+}
+
+func (c *conversation) pause(seconds float64) {
+	for i := 0; i < int(seconds*testRate); i++ {
+		c.samples = append(c.samples, c.rng.NormFloat64()*1e5)
+	}
+}
+
+func (c *conversation) say(s speaker, seconds float64) time.Duration {
+	at := time.Duration(float64(len(c.samples)) / testRate * float64(time.Second))
+	phase := 0.0
+	offset := c.rng.Float64() * 10
+	for i := 0; i < int(seconds*testRate); i++ {
+		t := float64(i)/testRate + offset
+		f0 := s.pitch * (1 + 0.08*math.Sin(2*math.Pi*0.9*t))
+		phase += 2 * math.Pi * f0 / testRate
+		f1 := s.formants[0] * (1 + 0.15*math.Sin(2*math.Pi*1.7*t))
+		f2 := s.formants[1] * (1 + 0.1*math.Sin(2*math.Pi*2.3*t+1))
+
+		v := 0.0
+		for h := 1; float64(h)*f0 < 4000; h++ {
+			f := float64(h) * f0
+			gain := math.Exp(-sq((f-f1)/150)) + 0.6*math.Exp(-sq((f-f2)/250)) + 0.02
+			v += gain * math.Sin(float64(h)*phase)
+		}
+		envelope := 0.6 + 0.4*math.Sin(2*math.Pi*4*t)
+		c.samples = append(c.samples, 1e8*envelope*v+c.rng.NormFloat64()*1e5)
+	}
+	return at
+}
+
+func sq(x float64) float64 {
+	return x * x
+}
+
+func (c *conversation) wav() *codec.WAVFile {
+	data := make([]int32, len(c.samples))
+	for i, s := range c.samples {
+		data[i] = int32(math.Max(math.MinInt32, math.Min(math.MaxInt32, s)))
+	}
+	wav := codec.NewDefaultWAV(data)
+	wav.Header.SampleRate = testRate
+	wav.Header.ByteRate = testRate * 4
+	return wav
+}
+
+func interview() (*conversation, time.Duration) {
+	c := &conversation{rng: rand.New(rand.NewSource(1))}
+	c.pause(1)
+	c.say(low, 3)
+	c.pause(1.5)
+	c.say(high, 3)
+	c.pause(1.5)
+	c.say(low, 2.5)
+	change := c.say(high, 2.5)
+	c.pause(1.5)
+	return c, change
+}
+
+func TestDiarize(t *testing.T) {
+	c, change := interview()
+
+	turns, err := Diarize(DefaultConfig(), c.wav())
+	assert.NoError(t, err)
+
+	var speakers []int
+	for _, turn := range turns {
+		speakers = append(speakers, turn.Speaker)
+	}
+	assert.Equal(t, []int{0, 1, 0, 1}, speakers)
+	if len(turns) == 4 {
+		assert.InDelta(t, change.Seconds(), turns[3].Start.Seconds(), 0.2)
+		assert.Equal(t, turns[2].End, turns[3].Start)
+	}
+}
+
+func TestDiarizeMaxSpeakers(t *testing.T) {
+	c, _ := interview()
+	segments := []vad.Segment{
+		{Start: time.Second, End: 4 * time.Second},
+		{Start: 5500 * time.Millisecond, End: 8500 * time.Millisecond},
+	}
+
+	cfg := DefaultConfig()
+	turns, err := DiarizeSegments(cfg, c.wav(), segments)
+	assert.NoError(t, err)
+	assert.Len(t, turns, 2)
+	if len(turns) == 2 {
+		assert.Equal(t, "speaker_0", turns[0].Name())
+		assert.Equal(t, "speaker_1", turns[1].Name())
+	}
+
+	cfg.MaxSpeakers = 1
+	turns, err = DiarizeSegments(cfg, c.wav(), segments)
+	assert.NoError(t, err)
+	assert.Len(t, turns, 2)
+	for _, turn := range turns {
+		assert.Equal(t, 0, turn.Speaker)
+	}
+}
+
+func TestShortTurn(t *testing.T) {
+	c, _ := interview()
+	segments := []vad.Segment{
+		{Start: time.Second, End: 4 * time.Second},
+		{Start: 5500 * time.Millisecond, End: 8500 * time.Millisecond},
+		{Start: 10 * time.Second, End: 10500 * time.Millisecond},
+	}
+
+	turns, err := DiarizeSegments(DefaultConfig(), c.wav(), segments)
+	assert.NoError(t, err)
+	assert.Len(t, turns, 3)
+	if len(turns) == 3 {
+		// too short to be a speaker of its own, it sounds like the first
+		assert.Equal(t, 0, turns[2].Speaker)
+	}
+}
+
+func TestWriteRTTM(t *testing.T) {
+	var b bytes.Buffer
+	err := WriteRTTM(&b, "call", []Turn{
+		{Start: time.Second, End: 2500 * time.Millisecond, Speaker: 0},
+		{Start: 3 * time.Second, End: 4 * time.Second, Speaker: 1},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"SPEAKER call 1 1.000 1.500 <NA> <NA> speaker_0 <NA> <NA>",
+		"SPEAKER call 1 3.000 1.000 <NA> <NA> speaker_1 <NA> <NA>",
+	}, strings.Split(strings.TrimSpace(b.String()), "\n"))
+}
+
+func TestConfigValidate(t *testing.T) {
+	assert.NoError(t, DefaultConfig().Validate())
+
+	var nilCfg *Config
+	assert.ErrorIs(t, nilCfg.Validate(), ErrInvalidConfig)
+
+	cfg := DefaultConfig()
+	cfg.MaxSpeakers = -1
+	assert.ErrorIs(t, cfg.Validate(), ErrInvalidConfig)
+
+	cfg = DefaultConfig()
+	cfg.MinTurn = 0
+	assert.ErrorIs(t, cfg.Validate(), ErrInvalidConfig)
+
+	cfg = DefaultConfig()
+	cfg.ClusterPenalty = 0
+	assert.ErrorIs(t, cfg.Validate(), ErrInvalidConfig)
+}
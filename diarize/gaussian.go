@@ -0,0 +1,140 @@
+package diarize
+
+import "math"
+
+// keeps the covariance of a few similar frames invertible
+const minVariance = 1e-2
+
+// gaussian accumulates the statistics of a full covariance Gaussian over
+// feature vectors
+type gaussian struct {
+	n       float64
+	sum     []float64
+	scatter [][]float64 // sum of outer products
+}
+
+func newGaussian(dims int) *gaussian {
+	g := &gaussian{
+		sum:     make([]float64, dims),
+		scatter: make([][]float64, dims),
+	}
+	for i := range g.scatter {
+		g.scatter[i] = make([]float64, dims)
+	}
+	return g
+}
+
+func (g *gaussian) add(x []float64) {
+	g.n++
+	for i, xi := range x {
+		g.sum[i] += xi
+		row := g.scatter[i]
+		for j := 0; j <= i; j++ {
+			row[j] += xi * x[j]
+		}
+	}
+}
+
+// addWeighted adds another Gaussian's statistics times w, 1 to merge and
+// -1 to take them out
+func (g *gaussian) addWeighted(o *gaussian, w float64) {
+	g.n += w * o.n
+	for i := range g.sum {
+		g.sum[i] += w * o.sum[i]
+		for j := 0; j <= i; j++ {
+			g.scatter[i][j] += w * o.scatter[i][j]
+		}
+	}
+}
+
+func (g *gaussian) clone() *gaussian {
+	c := newGaussian(len(g.sum))
+	c.addWeighted(g, 1)
+	return c
+}
+
+// model is the mean and Cholesky factor of the covariance, with its log
+// determinant
+type model struct {
+	mean   []float64
+	chol   [][]float64
+	logDet float64
+}
+
+func (g *gaussian) model() *model {
+	d := len(g.sum)
+	m := &model{
+		mean: make([]float64, d),
+		chol: make([][]float64, d),
+	}
+	for i := range m.mean {
+		m.mean[i] = g.sum[i] / g.n
+	}
+
+	cov := make([][]float64, d)
+	for i := range cov {
+		cov[i] = make([]float64, i+1)
+		for j := 0; j <= i; j++ {
+			cov[i][j] = g.scatter[i][j]/g.n - m.mean[i]*m.mean[j]
+		}
+		cov[i][i] += minVariance
+	}
+
+	for i := 0; i < d; i++ {
+		m.chol[i] = make([]float64, i+1)
+		for j := 0; j <= i; j++ {
+			s := cov[i][j]
+			for k := 0; k < j; k++ {
+				s -= m.chol[i][k] * m.chol[j][k]
+			}
+			if i == j {
+				// rounding can leave a nearly singular pivot below zero
+				s = math.Sqrt(math.Max(s, minVariance))
+				m.chol[i][i] = s
+				m.logDet += 2 * math.Log(s)
+			} else {
+				m.chol[i][j] = s / m.chol[j][j]
+			}
+		}
+	}
+	return m
+}
+
+// logDet is the log determinant of the covariance
+func (g *gaussian) logDet() float64 {
+	return g.model().logDet
+}
+
+// logLikelihood of x, less the constant every model shares
+func (m *model) logLikelihood(x []float64) float64 {
+	// solve L y = x - mean; |y|^2 is the Mahalanobis distance
+	y := make([]float64, len(x))
+	distance := 0.0
+	for i := range y {
+		s := x[i] - m.mean[i]
+		for k := 0; k < i; k++ {
+			s -= m.chol[i][k] * y[k]
+		}
+		y[i] = s / m.chol[i][i]
+		distance += y[i] * y[i]
+	}
+	return -0.5 * (m.logDet + distance)
+}
+
+// deltaBIC is how much better two Gaussians explain their frames than one
+// does both: above zero, they are different speakers. penalty scales the
+// cost of the second model's parameters.
+func deltaBIC(a, b *gaussian, penalty float64) float64 {
+	both := a.clone()
+	both.addWeighted(b, 1)
+	return deltaBICOf(both, a, b, both.logDet(), penalty)
+}
+
+// deltaBICOf is deltaBIC with the merged Gaussian and its log determinant
+// already to hand
+func deltaBICOf(both, a, b *gaussian, bothLogDet, penalty float64) float64 {
+	d := float64(len(both.sum))
+	parameters := d + d*(d+1)/2
+	gain := 0.5 * (both.n*bothLogDet - a.n*a.logDet() - b.n*b.logDet())
+	return gain - penalty*0.5*parameters*math.Log(both.n)
+}
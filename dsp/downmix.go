@@ -0,0 +1,35 @@
+package dsp
+
+// Downmix averages interleaved channels into mono as a stream: a frame
+// split between two calls is finished by the second.
+type Downmix struct {
+	channels int
+	channel  int // channels of the frame in progress already summed
+	sum      float64
+}
+
+func NewDownmix(channels int) *Downmix {
+	return &Downmix{channels: channels}
+}
+
+// Add appends the mono sample of each frame samples completes to out
+func (d *Downmix) Add(samples []int32, out []float64) []float64 {
+	for _, amp := range samples {
+		d.sum += float64(amp)
+		d.channel++
+		if d.channel < d.channels {
+			continue
+		}
+
+		out = append(out, d.sum/float64(d.channels))
+		d.channel = 0
+		d.sum = 0
+	}
+	return out
+}
+
+// Reset drops the frame in progress
+func (d *Downmix) Reset() {
+	d.channel = 0
+	d.sum = 0
+}
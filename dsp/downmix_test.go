@@ -0,0 +1,23 @@
+package dsp
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDownmix(t *testing.T) {
+	d := NewDownmix(2)
+
+	// the second frame is split between the calls
+	out := d.Add([]int32{2, 4, 6}, nil)
+	assert.Equal(t, []float64{3}, out)
+	out = d.Add([]int32{8, -1, 1}, out)
+	assert.Equal(t, []float64{3, 7, 0}, out)
+
+	d.Add([]int32{100}, nil)
+	d.Reset()
+	assert.Equal(t, []float64{5}, d.Add([]int32{4, 6}, nil))
+
+	assert.Equal(t, []float64{1, 2, 3}, NewDownmix(1).Add([]int32{1, 2, 3}, nil))
+}
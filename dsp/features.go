@@ -0,0 +1,68 @@
+package dsp
+
+import "math"
+
+const (
+	FeatureFrameTime = 25 // milliseconds per feature frame
+	FeatureHopTime   = 10 // milliseconds between feature frames
+
+	FeatureFilters      = 26
+	FeatureCoefficients = 13
+
+	// the length of each feature vector, the energy coefficient left out
+	FeatureSize = FeatureCoefficients - 1
+)
+
+// Features cuts a stream of mono samples into overlapping frames and
+// computes each one's MFCCs. The vectors leave out the energy coefficient,
+// so loudness does not count, and it is passed alongside.
+type Features struct {
+	mfcc *MFCC
+	hop  int
+
+	pending []float64
+	out     []float64
+}
+
+func NewFeatures(rate float64) (*Features, error) {
+	length := int(math.Round(rate * FeatureFrameTime / 1000))
+	mfcc, err := NewMFCC(rate, length, FeatureFilters, FeatureCoefficients)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Features{
+		mfcc: mfcc,
+		hop:  int(math.Round(rate * FeatureHopTime / 1000)),
+	}, nil
+}
+
+// FrameLength is the number of samples in a frame
+func (f *Features) FrameLength() int {
+	return f.mfcc.FrameLength()
+}
+
+// Hop is the number of samples from one frame to the next
+func (f *Features) Hop() int {
+	return f.hop
+}
+
+// Add appends samples and calls emit with the vector and the log energy of
+// each frame completed, the vector reused between calls
+func (f *Features) Add(samples []float64, emit func(vector []float64, energy float64)) {
+	f.pending = append(f.pending, samples...)
+
+	length := f.mfcc.FrameLength()
+	used := 0
+	for used+length <= len(f.pending) {
+		f.out = f.mfcc.Compute(f.pending[used:used+length], f.out[:0])
+		emit(f.out[1:], f.out[0])
+		used += f.hop
+	}
+	f.pending = f.pending[:copy(f.pending, f.pending[used:])]
+}
+
+// Reset drops the samples of the frame in progress
+func (f *Features) Reset() {
+	f.pending = f.pending[:0]
+}
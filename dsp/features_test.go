@@ -0,0 +1,36 @@
+package dsp
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// frames come every hop however the samples are split up
+func TestFeatures(t *testing.T) {
+	f, err := NewFeatures(16000)
+	assert.NoError(t, err)
+	assert.Equal(t, 400, f.FrameLength())
+	assert.Equal(t, 160, f.Hop())
+
+	samples := scale(sine(300, 16000, 16000), 1e6)
+	var whole [][]float64
+	f.Add(samples, func(vector []float64, energy float64) {
+		assert.Len(t, vector, FeatureSize)
+		whole = append(whole, append([]float64(nil), vector...))
+	})
+	assert.Len(t, whole, (16000-400)/160+1)
+
+	f.Reset()
+	var pieces [][]float64
+	for i := 0; i < len(samples); i += 123 {
+		end := i + 123
+		if end > len(samples) {
+			end = len(samples)
+		}
+		f.Add(samples[i:end], func(vector []float64, energy float64) {
+			pieces = append(pieces, append([]float64(nil), vector...))
+		})
+	}
+	assert.Equal(t, whole, pieces)
+}
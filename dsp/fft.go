@@ -0,0 +1,122 @@
+// Package dsp holds the signal processing shared by the detectors: an FFT
+// and the windows and spectra built on it.
+package dsp
+
+import (
+	"errors"
+	"math"
+	"math/cmplx"
+)
+
+var (
+	ErrNotPowerOfTwo = errors.New("fft size must be a power of two")
+)
+
+// FFT is a radix-2 transform of a fixed size with its twiddle factors and
+// bit reversal table computed up front. It is not safe for concurrent use.
+type FFT struct {
+	size     int
+	twiddles []complex128
+	reversed []int
+	scratch  []complex128
+}
+
+func NewFFT(size int) (*FFT, error) {
+	if size <= 0 || size&(size-1) != 0 {
+		return nil, ErrNotPowerOfTwo
+	}
+
+	f := &FFT{
+		size:     size,
+		twiddles: make([]complex128, size/2),
+		reversed: make([]int, size),
+		scratch:  make([]complex128, size),
+	}
+	for i := range f.twiddles {
+		f.twiddles[i] = cmplx.Rect(1, -2*math.Pi*float64(i)/float64(size))
+	}
+
+	bits := 0
+	for 1<<bits < size {
+		bits++
+	}
+	for i := range f.reversed {
+		r := 0
+		for b := 0; b < bits; b++ {
+			r |= (i >> b & 1) << (bits - 1 - b)
+		}
+		f.reversed[i] = r
+	}
+
+	return f, nil
+}
+
+func (f *FFT) Size() int {
+	return f.size
+}
+
+// Transform replaces x, which must hold Size values, with its DFT
+func (f *FFT) Transform(x []complex128) {
+	for i, r := range f.reversed {
+		if i < r {
+			x[i], x[r] = x[r], x[i]
+		}
+	}
+
+	for half := 1; half < f.size; half *= 2 {
+		stride := f.size / (half * 2)
+		for start := 0; start < f.size; start += half * 2 {
+			for k := 0; k < half; k++ {
+				t := f.twiddles[k*stride] * x[start+k+half]
+				x[start+k+half] = x[start+k] - t
+				x[start+k] += t
+			}
+		}
+	}
+}
+
+// Power returns the power of each bin from 0 to Size/2 of a real frame of
+// up to Size samples, zero padded, appended to out. window, if not nil,
+// is applied first.
+func (f *FFT) Power(frame []float64, window []float64, out []float64) []float64 {
+	for i := range f.scratch {
+		v := 0.0
+		if i < len(frame) {
+			v = frame[i]
+			if window != nil {
+				v *= window[i]
+			}
+		}
+		f.scratch[i] = complex(v, 0)
+	}
+
+	f.Transform(f.scratch)
+	for _, c := range f.scratch[:f.size/2+1] {
+		out = append(out, real(c)*real(c)+imag(c)*imag(c))
+	}
+
+	return out
+}
+
+// BinFrequency is the centre frequency of bin i at a sample rate
+func (f *FFT) BinFrequency(i int, rate float64) float64 {
+	return float64(i) * rate / float64(f.size)
+}
+
+// NextPowerOfTwo is the smallest power of two no less than n
+func NextPowerOfTwo(n int) int {
+	p := 1
+	for p < n {
+		p *= 2
+	}
+	return p
+}
+
+// Hann is a periodic Hann window of n points
+func Hann(n int) []float64 {
+	w := make([]float64, n)
+	for i := range w {
+		w[i] = 0.5 - 0.5*math.Cos(2*math.Pi*float64(i)/float64(n))
+	}
+	return w
+}
@@ -0,0 +1,69 @@
+package dsp
+
+import (
+	"math"
+	"math/cmplx"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func dft(x []complex128) []complex128 {
+	out := make([]complex128, len(x))
+	for k := range out {
+		for n, v := range x {
+			out[k] += v * cmplx.Rect(1, -2*math.Pi*float64(k*n)/float64(len(x)))
+		}
+	}
+	return out
+}
+
+func TestTransform(t *testing.T) {
+	for _, size := range []int{1, 2, 8, 64, 256} {
+		f, err := NewFFT(size)
+		assert.NoError(t, err)
+
+		x := make([]complex128, size)
+		for i := range x {
+			x[i] = complex(rand.Float64()-0.5, rand.Float64()-0.5)
+		}
+		expected := dft(x)
+
+		f.Transform(x)
+		for i := range x {
+			assert.InDelta(t, real(expected[i]), real(x[i]), 1e-9, "size %d bin %d", size, i)
+			assert.InDelta(t, imag(expected[i]), imag(x[i]), 1e-9, "size %d bin %d", size, i)
+		}
+	}
+}
+
+func TestPower(t *testing.T) {
+	f, err := NewFFT(512)
+	assert.NoError(t, err)
+
+	// a tone on bin 32 of a 16kHz frame
+	frame := make([]float64, 512)
+	for i := range frame {
+		frame[i] = math.Sin(2 * math.Pi * 1000 * float64(i) / 16000)
+	}
+
+	power := f.Power(frame, Hann(512), nil)
+	assert.Len(t, power, 257)
+	assert.Equal(t, 1000.0, f.BinFrequency(32, 16000))
+
+	peak := 0
+	for i := range power {
+		if power[i] > power[peak] {
+			peak = i
+		}
+	}
+	assert.Equal(t, 32, peak)
+}
+
+func TestNewFFT(t *testing.T) {
+	_, err := NewFFT(100)
+	assert.ErrorIs(t, err, ErrNotPowerOfTwo)
+	assert.Equal(t, 512, NextPowerOfTwo(441))
+	assert.Equal(t, 512, NextPowerOfTwo(512))
+}
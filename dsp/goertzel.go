@@ -0,0 +1,29 @@
+package dsp
+
+import "math"
+
+// Goertzel measures the power of a single frequency over a block of
+// samples, cheaper than an FFT when only a few frequencies matter
+type Goertzel struct {
+	coeff float64
+}
+
+func NewGoertzel(freq, rate float64) *Goertzel {
+	return &Goertzel{coeff: 2 * math.Cos(2*math.Pi*freq/rate)}
+}
+
+// Power is the power of the block at the frequency as a mean square, so a
+// sine of amplitude A at the frequency alone gives about A²/2
+func (g *Goertzel) Power(block []float64) float64 {
+	if len(block) == 0 {
+		return 0
+	}
+
+	var s1, s2 float64
+	for _, x := range block {
+		s1, s2 = x+g.coeff*s1-s2, s1
+	}
+
+	n := float64(len(block))
+	return 2 * (s1*s1 + s2*s2 - g.coeff*s1*s2) / (n * n)
+}
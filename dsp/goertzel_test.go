@@ -0,0 +1,26 @@
+package dsp
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGoertzel(t *testing.T) {
+	block := scale(sine(1000, 8000, 200), 3)
+	assert.InDelta(t, 4.5, NewGoertzel(1000, 8000).Power(block), 0.05)
+
+	// the bins of the DFT agree
+	f, err := NewFFT(256)
+	assert.NoError(t, err)
+	block = scale(sine(1500, 8000, 256), 2)
+	power := f.Power(block, nil, nil)
+	bin := 1500.0 * 256 / 8000
+	assert.InDelta(t, 2*power[int(bin)]/(256*256), NewGoertzel(1500, 8000).Power(block), 1e-9)
+
+	// far from the frequency there is little
+	assert.Less(t, NewGoertzel(3000, 8000).Power(block), 0.01)
+	assert.Equal(t, 0.0, NewGoertzel(1000, 8000).Power(nil))
+	assert.False(t, math.IsNaN(NewGoertzel(0, 8000).Power(block)))
+}
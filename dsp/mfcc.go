@@ -0,0 +1,158 @@
+package dsp
+
+import (
+	"errors"
+	"math"
+)
+
+const (
+	// pre-emphasis coefficient, lifting the high frequencies speech loses
+	// energy in
+	preEmphasis = 0.97
+
+	// the highest frequency the mel filters reach, where the sample rate
+	// allows
+	maxMelFrequency = 8000.0
+
+	// keeps the log of an empty filter finite
+	minFilterEnergy = 1e-10
+)
+
+var (
+	ErrInvalidMFCC = errors.New("invalid mfcc parameters")
+)
+
+// MFCC computes mel-frequency cepstral coefficients of fixed length
+// frames: pre-emphasis, a Hann window, the power spectrum, triangular
+// filters spaced evenly on the mel scale, their log energies, and a DCT.
+// It is not safe for concurrent use.
+type MFCC struct {
+	fft    *FFT
+	window []float64
+
+	// each filter's first bin and weights from there
+	starts  []int
+	weights [][]float64
+
+	// orthonormal DCT-II rows, one per coefficient
+	dct [][]float64
+
+	frame    []float64
+	power    []float64
+	energies []float64
+}
+
+// NewMFCC computes coefficients of frames of frameLength samples at a
+// sample rate, through filters mel filters
+func NewMFCC(rate float64, frameLength, filters, coefficients int) (*MFCC, error) {
+	if rate <= 0 || frameLength <= 0 || filters <= 0 || coefficients <= 0 || coefficients > filters {
+		return nil, ErrInvalidMFCC
+	}
+
+	size := NextPowerOfTwo(frameLength)
+	fft, err := NewFFT(size)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &MFCC{
+		fft:      fft,
+		window:   Hann(frameLength),
+		starts:   make([]int, filters),
+		weights:  make([][]float64, filters),
+		dct:      make([][]float64, coefficients),
+		frame:    make([]float64, frameLength),
+		power:    make([]float64, 0, size/2+1),
+		energies: make([]float64, filters),
+	}
+
+	// filter edges, evenly spaced in mel from 0 to the top frequency
+	top := math.Min(rate/2, maxMelFrequency)
+	edges := make([]float64, filters+2)
+	for i := range edges {
+		edges[i] = fromMel(toMel(top) * float64(i) / float64(filters+1))
+	}
+	for f := 0; f < filters; f++ {
+		low, centre, high := edges[f], edges[f+1], edges[f+2]
+		m.starts[f] = -1
+		for bin := 0; bin <= size/2; bin++ {
+			freq := fft.BinFrequency(bin, rate)
+			var w float64
+			switch {
+			case freq > low && freq <= centre:
+				w = (freq - low) / (centre - low)
+			case freq > centre && freq < high:
+				w = (high - freq) / (high - centre)
+			default:
+				continue
+			}
+			if m.starts[f] < 0 {
+				m.starts[f] = bin
+			}
+			m.weights[f] = append(m.weights[f], w)
+		}
+		if m.starts[f] < 0 {
+			// narrower than a bin: take the nearest one whole
+			m.starts[f] = int(math.Round(centre * float64(size) / rate))
+			m.weights[f] = []float64{1}
+		}
+	}
+
+	for k := range m.dct {
+		m.dct[k] = make([]float64, filters)
+		scale := math.Sqrt(2 / float64(filters))
+		if k == 0 {
+			scale = math.Sqrt(1 / float64(filters))
+		}
+		for n := range m.dct[k] {
+			m.dct[k][n] = scale * math.Cos(math.Pi*float64(k)*(float64(n)+0.5)/float64(filters))
+		}
+	}
+
+	return m, nil
+}
+
+// FrameLength is the number of samples Compute takes
+func (m *MFCC) FrameLength() int {
+	return len(m.frame)
+}
+
+// Compute appends the coefficients of a frame of FrameLength samples to
+// out, the first being the overall log energy
+func (m *MFCC) Compute(frame []float64, out []float64) []float64 {
+	prev := 0.0
+	for i := range m.frame {
+		v := 0.0
+		if i < len(frame) {
+			v = frame[i]
+		}
+		m.frame[i] = v - preEmphasis*prev
+		prev = v
+	}
+
+	m.power = m.fft.Power(m.frame, m.window, m.power[:0])
+	for f, weights := range m.weights {
+		e := 0.0
+		for i, w := range weights {
+			e += w * m.power[m.starts[f]+i]
+		}
+		m.energies[f] = math.Log(e + minFilterEnergy)
+	}
+
+	for _, row := range m.dct {
+		c := 0.0
+		for n, e := range m.energies {
+			c += row[n] * e
+		}
+		out = append(out, c)
+	}
+	return out
+}
+
+func toMel(f float64) float64 {
+	return 2595 * math.Log10(1+f/700)
+}
+
+func fromMel(mel float64) float64 {
+	return 700 * (math.Pow(10, mel/2595) - 1)
+}
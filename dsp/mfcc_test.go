@@ -0,0 +1,61 @@
+package dsp
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func sine(freq, rate float64, n int) []float64 {
+	x := make([]float64, n)
+	for i := range x {
+		x[i] = math.Sin(2 * math.Pi * freq * float64(i) / rate)
+	}
+	return x
+}
+
+func scale(x []float64, gain float64) []float64 {
+	for i := range x {
+		x[i] *= gain
+	}
+	return x
+}
+
+func TestMFCC(t *testing.T) {
+	m, err := NewMFCC(16000, 400, 26, 13)
+	assert.NoError(t, err)
+	assert.Equal(t, 400, m.FrameLength())
+
+	low := m.Compute(scale(sine(300, 16000, 400), 1e6), nil)
+	assert.Len(t, low, 13)
+
+	// the same sound louder moves only the energy coefficient
+	louder := m.Compute(scale(sine(300, 16000, 400), 1e8), nil)
+	assert.InDelta(t, 2*math.Log(100)*math.Sqrt(26), louder[0]-low[0], 0.01)
+	for k := 1; k < 13; k++ {
+		assert.InDelta(t, low[k], louder[k], 1e-3, "coefficient %d", k)
+	}
+
+	// a different pitch has a different shape
+	high := m.Compute(scale(sine(3000, 16000, 400), 1e6), nil)
+	distance := 0.0
+	for k := 1; k < 13; k++ {
+		distance += (high[k] - low[k]) * (high[k] - low[k])
+	}
+	assert.Greater(t, math.Sqrt(distance), 10.0)
+}
+
+func TestMFCCFilters(t *testing.T) {
+	// at a low rate and short frame some filters are narrower than a bin
+	m, err := NewMFCC(8000, 64, 40, 13)
+	assert.NoError(t, err)
+	for _, c := range m.Compute(sine(500, 8000, 64), nil) {
+		assert.False(t, math.IsNaN(c) || math.IsInf(c, 0))
+	}
+
+	for _, args := range [][4]int{{0, 400, 26, 13}, {16000, 0, 26, 13}, {16000, 400, 0, 13}, {16000, 400, 26, 27}} {
+		_, err := NewMFCC(float64(args[0]), args[1], args[2], args[3])
+		assert.ErrorIs(t, err, ErrInvalidMFCC)
+	}
+}
@@ -0,0 +1,15 @@
+package ingest
+
+// ulawDecode expands one G.711 mu-law byte to a 16-bit sample
+func ulawDecode(u byte) int16 {
+	u = ^u
+	exponent := (u >> 4) & 0x07
+	mantissa := int16(u & 0x0f)
+
+	sample := ((mantissa << 3) + 0x84) << exponent
+	sample -= 0x84
+	if u&0x80 != 0 {
+		return -sample
+	}
+	return sample
+}
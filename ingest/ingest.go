@@ -0,0 +1,82 @@
+package ingest
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"github.com/garlicgarrison/go-recorder/stream"
+)
+
+const (
+	DefaultFramesPerBuffer = stream.DefaultFramesPerBuffer
+	DefaultJitterPackets   = 5
+	DefaultIdleTimeout     = 5 * time.Second
+	DefaultMaxBuffered     = 10 * time.Second
+	DefaultMaxFrameSize    = 1 << 20
+
+	// room for a jumbo UDP datagram
+	MaxPacketSize = 65536
+)
+
+var (
+	ErrInvalidIngestConfig = errors.New("invalid ingest config")
+)
+
+type Config struct {
+	FramesPerBuffer int
+
+	// RTP packets held back to put reordered ones in order
+	JitterPackets int
+
+	// an RTP session ends after this long without packets
+	IdleTimeout time.Duration
+
+	// a session drops its oldest audio past this much unread backlog
+	MaxBuffered time.Duration
+
+	// dynamic RTP payload types, added to the static PCMU and L16 ones
+	PayloadTypes map[uint8]Payload
+
+	// WebSocket frames larger than this are rejected. It bounds what a
+	// client can have the server allocate, so it must be set.
+	MaxFrameSize int
+
+	// called on its own goroutine for every new session; the session is
+	// closed when it returns
+	OnSession func(*Session)
+}
+
+func DefaultConfig() *Config {
+	return &Config{
+		FramesPerBuffer: DefaultFramesPerBuffer,
+		JitterPackets:   DefaultJitterPackets,
+		IdleTimeout:     DefaultIdleTimeout,
+		MaxBuffered:     DefaultMaxBuffered,
+		PayloadTypes:    map[uint8]Payload{},
+		MaxFrameSize:    DefaultMaxFrameSize,
+	}
+}
+
+// Server turns RTP streams and WebSocket connections into Sessions
+type Server struct {
+	cfg *Config
+}
+
+func NewServer(cfg *Config) (*Server, error) {
+	if cfg == nil || cfg.OnSession == nil || cfg.FramesPerBuffer <= 0 || cfg.MaxFrameSize <= 0 {
+		return nil, ErrInvalidIngestConfig
+	}
+
+	return &Server{
+		cfg: cfg,
+	}, nil
+}
+
+func (s *Server) serve(session *Session) {
+	log.Printf("%s session %s from %s", session.Transport, session.ID, session.Remote)
+	go func() {
+		defer session.Close()
+		s.cfg.OnSession(session)
+	}()
+}
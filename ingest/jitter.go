@@ -0,0 +1,144 @@
+package ingest
+
+// gaps longer than this many frames are treated as a timestamp jump rather
+// than lost audio (~20s at 48kHz)
+const maxGapFrames = 1 << 20
+
+type pushResult int
+
+const (
+	packetInOrder pushResult = iota
+	packetReordered
+	packetLate
+)
+
+type jitterOutput struct {
+	packet *rtpPacket
+
+	// packets skipped right before this one, and the frames they covered
+	lost int
+	gap  uint32
+}
+
+// jitterBuffer holds up to depth packets so ones that arrive out of order
+// can be released in sequence order. A missing packet is given up on once
+// the buffer is full.
+//
+// The added latency is depth packets. What is still held when the session
+// ends is released by flush.
+type jitterBuffer struct {
+	depth  int
+	frames func([]byte) int
+
+	started  bool
+	next     uint16
+	highest  uint16
+	released bool
+	lastEnd  uint32 // timestamp right after the last released packet
+	packets  map[uint16]*rtpPacket
+}
+
+func newJitterBuffer(depth int, frames func([]byte) int) *jitterBuffer {
+	if depth <= 0 {
+		depth = DefaultJitterPackets
+	}
+
+	return &jitterBuffer{
+		depth:   depth,
+		frames:  frames,
+		packets: map[uint16]*rtpPacket{},
+	}
+}
+
+// seqBefore compares sequence numbers across the 16-bit wrap
+func seqBefore(a, b uint16) bool {
+	return int16(a-b) < 0
+}
+
+func (j *jitterBuffer) push(p *rtpPacket) pushResult {
+	if len(j.packets) == 0 && !j.started {
+		j.highest = p.sequence
+	}
+
+	if j.started && seqBefore(p.sequence, j.next) {
+		return packetLate
+	}
+	if _, ok := j.packets[p.sequence]; ok {
+		return packetLate
+	}
+
+	j.packets[p.sequence] = p
+	if seqBefore(p.sequence, j.highest) {
+		return packetReordered
+	}
+
+	j.highest = p.sequence
+	return packetInOrder
+}
+
+// pop releases every packet that is ready, in sequence order. Nothing is
+// released until the buffer first fills, so the first packets can still be
+// put in order.
+func (j *jitterBuffer) pop() []jitterOutput {
+	if !j.started {
+		if len(j.packets) < j.depth {
+			return nil
+		}
+
+		j.started = true
+		j.next = j.oldest().sequence
+	}
+
+	var out []jitterOutput
+	for len(j.packets) > 0 {
+		lost := 0
+		p, ok := j.packets[j.next]
+		if !ok {
+			if len(j.packets) < j.depth {
+				break
+			}
+
+			// give up on the missing packets and skip to the oldest held one
+			p = j.oldest()
+			lost = int(p.sequence - j.next)
+		}
+
+		gap := uint32(0)
+		if j.released && lost > 0 {
+			diff := p.timestamp - j.lastEnd
+			if int32(diff) > 0 && diff < maxGapFrames {
+				gap = diff
+			}
+		}
+
+		delete(j.packets, p.sequence)
+		j.next = p.sequence + 1
+		j.released = true
+		j.lastEnd = p.timestamp + uint32(j.frames(p.payload))
+
+		out = append(out, jitterOutput{
+			packet: p,
+			lost:   lost,
+			gap:    gap,
+		})
+	}
+
+	return out
+}
+
+// flush releases every packet still held, in sequence order, giving up on
+// the missing ones: with no depth left to fill, pop waits for nothing
+func (j *jitterBuffer) flush() []jitterOutput {
+	j.depth = 0
+	return j.pop()
+}
+
+func (j *jitterBuffer) oldest() *rtpPacket {
+	var oldest *rtpPacket
+	for _, p := range j.packets {
+		if oldest == nil || seqBefore(p.sequence, oldest.sequence) {
+			oldest = p
+		}
+	}
+	return oldest
+}
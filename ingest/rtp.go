@@ -0,0 +1,276 @@
+package ingest
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Encoding is an RTP payload encoding
+type Encoding string
+
+const (
+	PCMU Encoding = "PCMU"
+	L16  Encoding = "L16"
+)
+
+var (
+	ErrShortPacket        = errors.New("rtp packet too short")
+	ErrBadVersion         = errors.New("not an rtp version 2 packet")
+	ErrUnknownPayloadType = errors.New("unknown rtp payload type")
+)
+
+// Payload describes the audio carried by an RTP payload type
+type Payload struct {
+	Encoding   Encoding
+	SampleRate float64
+	Channels   int
+}
+
+// static payload types from RFC 3551
+var staticPayloads = map[uint8]Payload{
+	0:  {Encoding: PCMU, SampleRate: 8000, Channels: 1},
+	10: {Encoding: L16, SampleRate: 44100, Channels: 2},
+	11: {Encoding: L16, SampleRate: 44100, Channels: 1},
+}
+
+type rtpPacket struct {
+	payloadType uint8
+	sequence    uint16
+	timestamp   uint32
+	ssrc        uint32
+	payload     []byte
+}
+
+func parseRTP(b []byte) (*rtpPacket, error) {
+	if len(b) < 12 {
+		return nil, ErrShortPacket
+	}
+	if b[0]>>6 != 2 {
+		return nil, ErrBadVersion
+	}
+
+	p := &rtpPacket{
+		payloadType: b[1] & 0x7f,
+		sequence:    binary.BigEndian.Uint16(b[2:4]),
+		timestamp:   binary.BigEndian.Uint32(b[4:8]),
+		ssrc:        binary.BigEndian.Uint32(b[8:12]),
+	}
+
+	offset := 12 + 4*int(b[0]&0x0f)
+	if b[0]&0x10 != 0 {
+		if len(b) < offset+4 {
+			return nil, ErrShortPacket
+		}
+		offset += 4 + 4*int(binary.BigEndian.Uint16(b[offset+2:offset+4]))
+	}
+
+	end := len(b)
+	if b[0]&0x20 != 0 {
+		end -= int(b[len(b)-1])
+	}
+	if offset > end {
+		return nil, ErrShortPacket
+	}
+
+	p.payload = append([]byte(nil), b[offset:end]...)
+	return p, nil
+}
+
+// decode converts the payload to full-scale int32 samples
+func (p Payload) decode(payload []byte) []int32 {
+	switch p.Encoding {
+	case PCMU:
+		samples := make([]int32, len(payload))
+		for i, b := range payload {
+			samples[i] = int32(ulawDecode(b)) << 16
+		}
+		return samples
+	case L16:
+		samples := make([]int32, len(payload)/2)
+		for i := range samples {
+			samples[i] = int32(int16(binary.BigEndian.Uint16(payload[2*i:]))) << 16
+		}
+		return samples
+	}
+
+	return nil
+}
+
+// frames is the payload length in sample frames
+func (p Payload) frames(payload []byte) int {
+	width := 1
+	if p.Encoding == L16 {
+		width = 2
+	}
+	return len(payload) / width / p.Channels
+}
+
+func (s *Server) payload(payloadType uint8) (Payload, error) {
+	if p, ok := s.cfg.PayloadTypes[payloadType]; ok {
+		return p, nil
+	}
+	if p, ok := staticPayloads[payloadType]; ok {
+		return p, nil
+	}
+
+	return Payload{}, ErrUnknownPayloadType
+}
+
+// rtpSession is the receive side of one SSRC
+type rtpSession struct {
+	session *Session
+	payload Payload
+
+	mutex  *sync.Mutex // guards jitter between receive and end
+	jitter *jitterBuffer
+}
+
+// ServeRTP reads RTP packets from conn until it is closed. Each SSRC from
+// each remote address becomes its own session.
+func (s *Server) ServeRTP(conn net.PacketConn) error {
+	sessions := map[string]*rtpSession{}
+	mutex := &sync.Mutex{}
+
+	stop := make(chan struct{})
+	defer close(stop)
+	go s.expire(sessions, mutex, stop)
+
+	defer func() {
+		mutex.Lock()
+		defer mutex.Unlock()
+		for _, rs := range sessions {
+			rs.end()
+		}
+	}()
+
+	buf := make([]byte, MaxPacketSize)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			return err
+		}
+
+		p, err := parseRTP(buf[:n])
+		if err != nil {
+			continue
+		}
+
+		key := fmt.Sprintf("%s/%08x", addr, p.ssrc)
+		mutex.Lock()
+		rs, ok := sessions[key]
+		if ok {
+			select {
+			case <-rs.session.Done():
+				// the consumer hung up, a new packet starts over
+				delete(sessions, key)
+				ok = false
+			default:
+			}
+		}
+		if !ok {
+			payload, err := s.payload(p.payloadType)
+			if err != nil {
+				mutex.Unlock()
+				continue
+			}
+
+			rs = &rtpSession{
+				session: newSession(s.cfg, key, addr.String(), RTP, payload.SampleRate, payload.Channels),
+				payload: payload,
+				mutex:   &sync.Mutex{},
+				jitter:  newJitterBuffer(s.cfg.JitterPackets, payload.frames),
+			}
+			sessions[key] = rs
+			s.serve(rs.session)
+		}
+		mutex.Unlock()
+
+		// a session keeps the format it started with
+		payload, err := s.payload(p.payloadType)
+		if err != nil || payload != rs.payload {
+			continue
+		}
+		rs.receive(p)
+	}
+}
+
+// ListenRTP serves RTP on a UDP address such as ":5004"
+func (s *Server) ListenRTP(addr string) error {
+	conn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	return s.ServeRTP(conn)
+}
+
+func (rs *rtpSession) receive(p *rtpPacket) {
+	rs.mutex.Lock()
+	defer rs.mutex.Unlock()
+
+	switch rs.jitter.push(p) {
+	case packetLate:
+		atomic.AddUint64(&rs.session.late, 1)
+		return
+	case packetReordered:
+		atomic.AddUint64(&rs.session.reordered, 1)
+	}
+
+	rs.push(rs.jitter.pop())
+}
+
+// end hands over what the jitter buffer still holds and ends the session
+func (rs *rtpSession) end() {
+	rs.mutex.Lock()
+	defer rs.mutex.Unlock()
+
+	rs.push(rs.jitter.flush())
+	rs.session.end()
+}
+
+func (rs *rtpSession) push(released []jitterOutput) {
+	for _, out := range released {
+		if out.lost > 0 {
+			atomic.AddUint64(&rs.session.lost, uint64(out.lost))
+			// keep the timeline by filling the missing span with silence
+			if out.gap > 0 {
+				rs.session.push(make([]int32, int(out.gap)*rs.payload.Channels))
+			}
+		}
+		rs.session.push(rs.payload.decode(out.packet.payload))
+	}
+}
+
+// expire ends sessions that have gone quiet
+func (s *Server) expire(sessions map[string]*rtpSession, mutex *sync.Mutex, stop chan struct{}) {
+	timeout := s.cfg.IdleTimeout
+	if timeout <= 0 {
+		timeout = DefaultIdleTimeout
+	}
+
+	ticker := time.NewTicker(timeout / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return
+		}
+
+		mutex.Lock()
+		for key, rs := range sessions {
+			if time.Since(rs.session.lastSeen()) > timeout {
+				rs.end()
+				delete(sessions, key)
+			}
+		}
+		mutex.Unlock()
+	}
+}
@@ -0,0 +1,202 @@
+package ingest
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func rtpBytes(payloadType uint8, seq uint16, ts uint32, payload []byte) []byte {
+	b := make([]byte, 12, 12+len(payload))
+	b[0] = 0x80
+	b[1] = payloadType
+	binary.BigEndian.PutUint16(b[2:], seq)
+	binary.BigEndian.PutUint32(b[4:], ts)
+	binary.BigEndian.PutUint32(b[8:], 0xdecafbad)
+	return append(b, payload...)
+}
+
+func TestParseRTP(t *testing.T) {
+	b := rtpBytes(0, 7, 160, []byte{1, 2, 3})
+	// one CSRC and a padding byte
+	b[0] |= 0x21
+	b = append(b[:12], append([]byte{0, 0, 0, 1}, b[12:]...)...)
+	b = append(b, 1)
+
+	p, err := parseRTP(b)
+	assert.NoError(t, err)
+	assert.Equal(t, uint16(7), p.sequence)
+	assert.Equal(t, uint32(160), p.timestamp)
+	assert.Equal(t, []byte{1, 2, 3}, p.payload)
+
+	_, err = parseRTP([]byte{0x80, 0})
+	assert.ErrorIs(t, err, ErrShortPacket)
+}
+
+func TestULawDecode(t *testing.T) {
+	assert.Equal(t, int16(0), ulawDecode(0xff))
+	assert.Equal(t, int16(-32124), ulawDecode(0x00))
+	assert.Equal(t, int16(32124), ulawDecode(0x80))
+}
+
+func TestJitterBufferReorder(t *testing.T) {
+	frames := Payload{Encoding: L16, SampleRate: 8000, Channels: 1}.frames
+	j := newJitterBuffer(3, frames)
+	payload := make([]byte, 4) // 2 frames
+
+	packet := func(seq uint16) *rtpPacket {
+		return &rtpPacket{sequence: seq, timestamp: uint32(seq) * 2, payload: payload}
+	}
+
+	released := []uint16{}
+	lost := 0
+	gap := uint32(0)
+	push := func(seq uint16) pushResult {
+		result := j.push(packet(seq))
+		for _, out := range j.pop() {
+			released = append(released, out.packet.sequence)
+			lost += out.lost
+			gap += out.gap
+		}
+		return result
+	}
+
+	assert.Equal(t, packetInOrder, push(65534))
+	assert.Equal(t, packetInOrder, push(0))
+	assert.Equal(t, packetReordered, push(65535))
+	assert.Equal(t, packetLate, push(65534))
+
+	// 1 never arrives, it is skipped once 3 packets are waiting
+	push(3)
+	push(2)
+	push(4)
+
+	assert.Equal(t, []uint16{65534, 65535, 0, 2, 3, 4}, released)
+	assert.Equal(t, 1, lost)
+	assert.Equal(t, uint32(2), gap)
+}
+
+func TestServeRTP(t *testing.T) {
+	server, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.NoError(t, err)
+
+	sessions := make(chan *Session, 1)
+	cfg := DefaultConfig()
+	cfg.FramesPerBuffer = 4
+	cfg.JitterPackets = 2
+	cfg.OnSession = func(s *Session) {
+		sessions <- s
+		<-s.Done()
+	}
+
+	s, err := NewServer(cfg)
+	assert.NoError(t, err)
+	go s.ServeRTP(server)
+	defer server.Close()
+
+	client, err := net.Dial("udp", server.LocalAddr().String())
+	assert.NoError(t, err)
+	defer client.Close()
+
+	// silence then full scale, sent out of order
+	client.Write(rtpBytes(0, 2, 4, []byte{0x80, 0x80, 0x80, 0x80}))
+	client.Write(rtpBytes(0, 1, 0, []byte{0xff, 0xff, 0xff, 0xff}))
+
+	var session *Session
+	select {
+	case session = <-sessions:
+	case <-time.After(time.Second):
+		t.Fatal("no session")
+	}
+	assert.Equal(t, RTP, session.Transport)
+	assert.Equal(t, 8000.0, session.SampleRate)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	// mu-law 0xff is silence
+	buffer, err := session.Read(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []int32{0, 0, 0, 0}, buffer.Samples)
+	assert.Equal(t, uint64(0), buffer.Index)
+
+	buffer, err = session.Read(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, int32(32124<<16), buffer.Samples[0])
+	assert.Equal(t, uint64(4), buffer.Index)
+	assert.Equal(t, uint64(1), session.Stats().Reordered)
+	session.Close()
+}
+
+func TestJitterBufferFlush(t *testing.T) {
+	frames := Payload{Encoding: L16, SampleRate: 8000, Channels: 1}.frames
+	j := newJitterBuffer(4, frames)
+	payload := make([]byte, 4) // 2 frames
+
+	for _, seq := range []uint16{12, 10} {
+		j.push(&rtpPacket{sequence: seq, timestamp: uint32(seq) * 2, payload: payload})
+		assert.Empty(t, j.pop())
+	}
+
+	// 11 is given up on, its frames filled in
+	out := j.flush()
+	assert.Len(t, out, 2)
+	assert.Equal(t, uint16(10), out[0].packet.sequence)
+	assert.Equal(t, uint16(12), out[1].packet.sequence)
+	assert.Equal(t, 1, out[1].lost)
+	assert.Equal(t, uint32(2), out[1].gap)
+	assert.Empty(t, j.flush())
+}
+
+// a session shorter than the jitter buffer still delivers once it goes quiet
+func TestServeRTPShortSession(t *testing.T) {
+	server, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.NoError(t, err)
+
+	sessions := make(chan *Session, 1)
+	cfg := DefaultConfig()
+	cfg.FramesPerBuffer = 4
+	cfg.JitterPackets = 8
+	cfg.IdleTimeout = 100 * time.Millisecond
+	cfg.OnSession = func(s *Session) {
+		sessions <- s
+		<-s.Done()
+	}
+
+	s, err := NewServer(cfg)
+	assert.NoError(t, err)
+	go s.ServeRTP(server)
+	defer server.Close()
+
+	client, err := net.Dial("udp", server.LocalAddr().String())
+	assert.NoError(t, err)
+	defer client.Close()
+
+	client.Write(rtpBytes(0, 1, 0, []byte{0xff, 0xff, 0xff, 0xff}))
+	client.Write(rtpBytes(0, 2, 4, []byte{0x80, 0x80, 0x80, 0x80}))
+
+	var session *Session
+	select {
+	case session = <-sessions:
+	case <-time.After(time.Second):
+		t.Fatal("no session")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	buffer, err := session.Read(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []int32{0, 0, 0, 0}, buffer.Samples)
+
+	buffer, err = session.Read(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, int32(32124<<16), buffer.Samples[0])
+
+	_, err = session.Read(ctx)
+	assert.ErrorIs(t, err, ErrSessionClosed)
+}
@@ -0,0 +1,186 @@
+package ingest
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/garlicgarrison/go-recorder/stream"
+)
+
+type Transport string
+
+const (
+	RTP       Transport = "rtp"
+	WebSocket Transport = "websocket"
+)
+
+var (
+	ErrSessionClosed = errors.New("session closed")
+)
+
+// SessionStats counts what happened to a session's audio on the way in
+type SessionStats struct {
+	Packets uint64
+	Samples uint64
+
+	// RTP only
+	Lost      uint64
+	Late      uint64
+	Reordered uint64
+
+	// samples discarded because the consumer fell too far behind
+	Dropped uint64
+}
+
+// Session is one connected client. It is a stream.Source, so it can be
+// handed straight to recorder.NewRecorder.
+type Session struct {
+	// counters are accessed atomically and kept first for 64-bit alignment
+	packets   uint64
+	samples   uint64
+	lost      uint64
+	late      uint64
+	reordered uint64
+	dropped   uint64
+
+	ID         string
+	Remote     string
+	Transport  Transport
+	SampleRate float64
+	Channels   int
+
+	framesPerBuffer int
+	maxPending      int
+
+	mutex   *sync.Mutex
+	pending []int32
+	clock   *stream.Clock
+	pool    *stream.BufferPool
+	ready   chan struct{}
+	done    chan struct{}
+	once    *sync.Once
+	seen    time.Time
+}
+
+func newSession(cfg *Config, id, remote string, transport Transport, sampleRate float64, channels int) *Session {
+	return &Session{
+		ID:              id,
+		Remote:          remote,
+		Transport:       transport,
+		SampleRate:      sampleRate,
+		Channels:        channels,
+		framesPerBuffer: cfg.FramesPerBuffer,
+		maxPending:      int(cfg.MaxBuffered.Seconds()*sampleRate) * channels,
+		mutex:           &sync.Mutex{},
+		clock:           stream.NewClock(sampleRate, channels),
+		pool:            stream.NewBufferPool(cfg.FramesPerBuffer * channels),
+		ready:           make(chan struct{}, 1),
+		done:            make(chan struct{}),
+		once:            &sync.Once{},
+		seen:            time.Now(),
+	}
+}
+
+// push queues decoded samples, dropping the oldest if the consumer is too
+// far behind
+func (s *Session) push(samples []int32) {
+	s.mutex.Lock()
+	s.pending = append(s.pending, samples...)
+	if s.maxPending > 0 && len(s.pending) > s.maxPending {
+		extra := len(s.pending) - s.maxPending
+		extra -= extra % s.Channels
+		s.pending = append(s.pending[:0], s.pending[extra:]...)
+		s.clock.Skip(uint64(extra / s.Channels))
+		atomic.AddUint64(&s.dropped, uint64(extra))
+	}
+	s.seen = time.Now()
+	s.mutex.Unlock()
+
+	atomic.AddUint64(&s.packets, 1)
+	atomic.AddUint64(&s.samples, uint64(len(samples)))
+
+	select {
+	case s.ready <- struct{}{}:
+	default:
+	}
+}
+
+func (s *Session) lastSeen() time.Time {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.seen
+}
+
+// end marks the client gone. Reads drain what is queued and then fail.
+func (s *Session) end() {
+	s.once.Do(func() { close(s.done) })
+}
+
+// Done is closed when the client disconnects or the session is closed
+func (s *Session) Done() <-chan struct{} {
+	return s.done
+}
+
+func (s *Session) Start() error {
+	select {
+	case <-s.done:
+		return ErrSessionClosed
+	default:
+	}
+
+	return nil
+}
+
+// Close disconnects the client
+func (s *Session) Close() error {
+	s.end()
+	return nil
+}
+
+// Read returns the next buffer, stamped from when the session's first
+// samples arrived. Lost packets filled with silence keep the index
+// continuous; audio dropped for a slow consumer shows up as a gap.
+func (s *Session) Read(ctx context.Context) (*stream.Buffer, error) {
+	n := s.framesPerBuffer * s.Channels
+	for {
+		s.mutex.Lock()
+		if len(s.pending) >= n {
+			buffer := s.pool.Get()
+			copy(buffer.Samples, s.pending)
+			s.pending = append(s.pending[:0], s.pending[n:]...)
+			s.clock.StampBuffer(buffer)
+			s.mutex.Unlock()
+			return buffer, nil
+		}
+		s.mutex.Unlock()
+
+		select {
+		case <-s.ready:
+		case <-s.done:
+			// one last look in case samples arrived with the disconnect
+			select {
+			case <-s.ready:
+				continue
+			default:
+			}
+			return nil, ErrSessionClosed
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+func (s *Session) Stats() SessionStats {
+	return SessionStats{
+		Packets:   atomic.LoadUint64(&s.packets),
+		Samples:   atomic.LoadUint64(&s.samples),
+		Lost:      atomic.LoadUint64(&s.lost),
+		Late:      atomic.LoadUint64(&s.late),
+		Reordered: atomic.LoadUint64(&s.reordered),
+		Dropped:   atomic.LoadUint64(&s.dropped),
+	}
+}
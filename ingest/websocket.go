@@ -0,0 +1,288 @@
+package ingest
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/garlicgarrison/go-recorder/stream"
+)
+
+// RFC 6455 handshake GUID
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+const (
+	opContinuation = 0x0
+	opText         = 0x1
+	opBinary       = 0x2
+	opClose        = 0x8
+	opPing         = 0x9
+	opPong         = 0xa
+)
+
+var (
+	ErrNotWebSocket   = errors.New("not a websocket upgrade")
+	ErrFrameTooLarge  = errors.New("websocket frame too large")
+	ErrUnmaskedFrame  = errors.New("client websocket frame not masked")
+	ErrReservedOpcode = errors.New("reserved websocket opcode")
+	ErrInvalidQuery   = errors.New("invalid stream parameters")
+	ErrHijackRejected = errors.New("connection cannot be hijacked")
+)
+
+// WebSocketHandler accepts binary PCM over WebSocket. The sample format is
+// declared in the query string, e.g.
+//
+//	ws://host/ingest?format=s16le&rate=16000&channels=1
+//
+// Every binary message is appended to the session; text messages are
+// ignored.
+func (s *Server) WebSocketHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		format, sampleRate, channels, err := parseStreamQuery(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		conn, rw, err := upgrade(w, r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		defer conn.Close()
+
+		session := newSession(s.cfg, r.RemoteAddr+r.URL.Path, r.RemoteAddr, WebSocket, sampleRate, channels)
+		s.serve(session)
+		defer session.end()
+
+		err = s.readWebSocket(conn, rw.Reader, session, format)
+		switch {
+		case err == nil, errors.Is(err, io.EOF), errors.Is(err, ErrSessionClosed):
+		case errors.Is(err, ErrFrameTooLarge):
+			writeFrame(conn, opClose, closePayload(1009, err.Error()))
+		default:
+			writeFrame(conn, opClose, closePayload(1002, err.Error()))
+		}
+	})
+}
+
+func parseStreamQuery(r *http.Request) (stream.SampleFormat, float64, int, error) {
+	q := r.URL.Query()
+
+	format := stream.S16LE
+	if name := q.Get("format"); name != "" {
+		parsed, err := stream.ParseSampleFormat(name)
+		if err != nil {
+			return "", 0, 0, err
+		}
+		format = parsed
+	}
+
+	sampleRate := float64(stream.DefaultSampleRate)
+	if rate := q.Get("rate"); rate != "" {
+		parsed, err := strconv.ParseFloat(rate, 64)
+		if err != nil || parsed <= 0 {
+			return "", 0, 0, ErrInvalidQuery
+		}
+		sampleRate = parsed
+	}
+
+	channels := stream.DefaultInputChannels
+	if c := q.Get("channels"); c != "" {
+		parsed, err := strconv.Atoi(c)
+		if err != nil || parsed <= 0 {
+			return "", 0, 0, ErrInvalidQuery
+		}
+		channels = parsed
+	}
+
+	return format, sampleRate, channels, nil
+}
+
+func upgrade(w http.ResponseWriter, r *http.Request) (net.Conn, *bufio.ReadWriter, error) {
+	if !headerContains(r.Header, "Connection", "upgrade") ||
+		!headerContains(r.Header, "Upgrade", "websocket") ||
+		r.Header.Get("Sec-WebSocket-Key") == "" {
+		return nil, nil, ErrNotWebSocket
+	}
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		return nil, nil, ErrHijackRejected
+	}
+
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	_, err = fmt.Fprintf(rw, "HTTP/1.1 101 Switching Protocols\r\n"+
+		"Upgrade: websocket\r\n"+
+		"Connection: Upgrade\r\n"+
+		"Sec-WebSocket-Accept: %s\r\n\r\n", acceptKey(r.Header.Get("Sec-WebSocket-Key")))
+	if err == nil {
+		err = rw.Flush()
+	}
+	if err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+
+	return conn, rw, nil
+}
+
+func headerContains(h http.Header, name, value string) bool {
+	for _, v := range h.Values(name) {
+		for _, token := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(token), value) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func acceptKey(key string) string {
+	sum := sha1.Sum([]byte(key + websocketGUID))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// readWebSocket decodes binary messages into the session until the client
+// closes the connection
+func (s *Server) readWebSocket(conn net.Conn, r *bufio.Reader, session *Session, format stream.SampleFormat) error {
+	width := format.Width()
+	var partial []byte
+	binaryMessage := false
+
+	for {
+		select {
+		case <-session.Done():
+			writeFrame(conn, opClose, closePayload(1000, ""))
+			return ErrSessionClosed
+		default:
+		}
+
+		opcode, payload, err := readFrame(r, s.cfg.MaxFrameSize)
+		if err != nil {
+			return err
+		}
+
+		switch opcode {
+		case opPing:
+			writeFrame(conn, opPong, payload)
+			continue
+		case opPong:
+			continue
+		case opClose:
+			writeFrame(conn, opClose, payload)
+			return io.EOF
+		case opText:
+			binaryMessage = false
+			continue
+		case opBinary:
+			binaryMessage = true
+		case opContinuation:
+			if !binaryMessage {
+				continue
+			}
+		default:
+			// the handler closes with 1002, protocol error
+			return fmt.Errorf("%w: %#x", ErrReservedOpcode, opcode)
+		}
+
+		// samples can straddle frames, keep the leftover bytes for the next
+		data := append(partial, payload...)
+		n := len(data) / width
+		samples := make([]int32, n)
+		for i := range samples {
+			samples[i] = format.Decode(data[i*width : (i+1)*width])
+		}
+		partial = append([]byte(nil), data[n*width:]...)
+
+		if n > 0 {
+			session.push(samples)
+		}
+	}
+}
+
+func readFrame(r *bufio.Reader, maxSize int) (byte, []byte, error) {
+	header := make([]byte, 2)
+	_, err := io.ReadFull(r, header)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	opcode := header[0] & 0x0f
+	if header[1]&0x80 == 0 {
+		return 0, nil, ErrUnmaskedFrame
+	}
+
+	length := uint64(header[1] & 0x7f)
+	switch length {
+	case 126:
+		ext := make([]byte, 2)
+		_, err = io.ReadFull(r, ext)
+		length = uint64(binary.BigEndian.Uint16(ext))
+	case 127:
+		ext := make([]byte, 8)
+		_, err = io.ReadFull(r, ext)
+		length = binary.BigEndian.Uint64(ext)
+	}
+	if err != nil {
+		return 0, nil, err
+	}
+	if length > uint64(maxSize) {
+		return 0, nil, ErrFrameTooLarge
+	}
+
+	mask := make([]byte, 4)
+	_, err = io.ReadFull(r, mask)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	payload := make([]byte, length)
+	_, err = io.ReadFull(r, payload)
+	if err != nil {
+		return 0, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+
+	return opcode, payload, nil
+}
+
+// writeFrame sends a single unmasked server frame
+func writeFrame(w io.Writer, opcode byte, payload []byte) error {
+	header := []byte{0x80 | opcode}
+	switch {
+	case len(payload) < 126:
+		header = append(header, byte(len(payload)))
+	case len(payload) <= 0xffff:
+		header = append(header, 126, byte(len(payload)>>8), byte(len(payload)))
+	default:
+		ext := make([]byte, 8)
+		binary.BigEndian.PutUint64(ext, uint64(len(payload)))
+		header = append(append(header, 127), ext...)
+	}
+
+	_, err := w.Write(append(header, payload...))
+	return err
+}
+
+func closePayload(code uint16, reason string) []byte {
+	payload := []byte{byte(code >> 8), byte(code)}
+	return append(payload, reason...)
+}
+
+// compile-time check that a Session can drive a recorder
+var _ stream.Source = (*Session)(nil)
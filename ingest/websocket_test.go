@@ -0,0 +1,142 @@
+package ingest
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func maskedFrame(opcode byte, payload []byte) []byte {
+	mask := []byte{1, 2, 3, 4}
+	frame := []byte{0x80 | opcode, 0x80 | byte(len(payload))}
+	frame = append(frame, mask...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+	return frame
+}
+
+func TestWebSocketIngest(t *testing.T) {
+	sessions := make(chan *Session, 1)
+	cfg := DefaultConfig()
+	cfg.FramesPerBuffer = 2
+	cfg.OnSession = func(s *Session) {
+		sessions <- s
+		<-s.Done()
+	}
+
+	s, err := NewServer(cfg)
+	assert.NoError(t, err)
+	server := httptest.NewServer(s.WebSocketHandler())
+	defer server.Close()
+
+	conn, err := net.Dial("tcp", strings.TrimPrefix(server.URL, "http://"))
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	fmt.Fprintf(conn, "GET /mic?format=s16le&rate=16000&channels=2 HTTP/1.1\r\n"+
+		"Host: test\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n"+
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Version: 13\r\n\r\n")
+
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusSwitchingProtocols, resp.StatusCode)
+	assert.Equal(t, "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=", resp.Header.Get("Sec-WebSocket-Accept"))
+
+	// a sample split across two frames
+	conn.Write(maskedFrame(opBinary, []byte{1, 0, 2, 0, 3}))
+	conn.Write(maskedFrame(opBinary, []byte{0, 4, 0}))
+
+	session := <-sessions
+	assert.Equal(t, 16000.0, session.SampleRate)
+	assert.Equal(t, 2, session.Channels)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	buffer, err := session.Read(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []int32{1 << 16, 2 << 16, 3 << 16, 4 << 16}, buffer.Samples)
+
+	conn.Write(maskedFrame(opClose, nil))
+	_, err = session.Read(ctx)
+	assert.ErrorIs(t, err, ErrSessionClosed)
+}
+
+// dial connects to a server with the default config and completes the
+// handshake
+func dial(t *testing.T) (net.Conn, *bufio.Reader, func()) {
+	cfg := DefaultConfig()
+	cfg.OnSession = func(s *Session) {
+		<-s.Done()
+	}
+
+	s, err := NewServer(cfg)
+	assert.NoError(t, err)
+	server := httptest.NewServer(s.WebSocketHandler())
+
+	conn, err := net.Dial("tcp", strings.TrimPrefix(server.URL, "http://"))
+	assert.NoError(t, err)
+
+	fmt.Fprintf(conn, "GET /mic?format=s16le&rate=16000&channels=1 HTTP/1.1\r\n"+
+		"Host: test\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n"+
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Version: 13\r\n\r\n")
+
+	r := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(r, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusSwitchingProtocols, resp.StatusCode)
+
+	return conn, r, func() {
+		conn.Close()
+		server.Close()
+	}
+}
+
+// closeCode reads the server's close frame
+func closeCode(t *testing.T, conn net.Conn, r *bufio.Reader) uint16 {
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	header := make([]byte, 4)
+	_, err := io.ReadFull(r, header)
+	assert.NoError(t, err)
+	assert.Equal(t, byte(0x80|opClose), header[0])
+	return binary.BigEndian.Uint16(header[2:])
+}
+
+func TestWebSocketReservedOpcode(t *testing.T) {
+	conn, r, done := dial(t)
+	defer done()
+
+	// 0x3 is reserved for a future data frame, not PCM
+	conn.Write(maskedFrame(0x3, []byte{1, 0, 2, 0}))
+	assert.Equal(t, uint16(1002), closeCode(t, conn, r))
+}
+
+// a frame claiming to be huge is refused from its header, with 1009,
+// before anything is allocated for it
+func TestWebSocketFrameTooLarge(t *testing.T) {
+	conn, r, done := dial(t)
+	defer done()
+
+	header := []byte{0x80 | opBinary, 0x80 | 127, 0, 0, 0, 0, 0, 0, 0, 0}
+	binary.BigEndian.PutUint64(header[2:], 1<<62)
+	conn.Write(header)
+	assert.Equal(t, uint16(1009), closeCode(t, conn, r))
+}
+
+func TestNewServerMaxFrameSize(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.OnSession = func(s *Session) {}
+	cfg.MaxFrameSize = 0
+	_, err := NewServer(cfg)
+	assert.ErrorIs(t, err, ErrInvalidIngestConfig)
+}
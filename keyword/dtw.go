@@ -0,0 +1,72 @@
+package keyword
+
+import "math"
+
+func distance(a, b []float64) float64 {
+	sum := 0.0
+	for i := range a {
+		d := a[i] - b[i]
+		sum += d * d
+	}
+	return math.Sqrt(sum)
+}
+
+// dtw is the distance per step of the cheapest alignment of template with
+// the whole of x
+func dtw(template, x [][]float64) float64 {
+	return align(template, x, false, len(x))
+}
+
+// subsequence is the distance per step of the cheapest alignment of
+// template with any stretch of x that ends in its last ends vectors
+func subsequence(template, x [][]float64, ends int) float64 {
+	return align(template, x, true, ends)
+}
+
+// align runs dynamic time warping with steps along either sequence or both,
+// keeping each cell's path length so costs can be compared per step. With
+// a free start, the template may begin at any vector of x.
+func align(template, x [][]float64, freeStart bool, ends int) float64 {
+	if len(template) == 0 || len(x) == 0 {
+		return math.Inf(1)
+	}
+
+	// two rows of the cost matrix, template by x
+	cost := [2][]float64{make([]float64, len(x)), make([]float64, len(x))}
+	steps := [2][]int{make([]int, len(x)), make([]int, len(x))}
+
+	for i, t := range template {
+		row, prev := i%2, (i+1)%2
+		for j, v := range x {
+			d := distance(t, v)
+			switch {
+			case i == 0 && (j == 0 || freeStart):
+				cost[row][j], steps[row][j] = d, 1
+			case i == 0:
+				cost[row][j], steps[row][j] = cost[row][j-1]+d, steps[row][j-1]+1
+			case j == 0:
+				cost[row][j], steps[row][j] = cost[prev][j]+d, steps[prev][j]+1
+			default:
+				c, s := cost[prev][j-1], steps[prev][j-1]
+				if cost[prev][j] < c {
+					c, s = cost[prev][j], steps[prev][j]
+				}
+				if cost[row][j-1] < c {
+					c, s = cost[row][j-1], steps[row][j-1]
+				}
+				cost[row][j], steps[row][j] = c+d, s+1
+			}
+		}
+	}
+
+	last := (len(template) - 1) % 2
+	best := math.Inf(1)
+	first := len(x) - ends
+	if first < 0 {
+		first = 0
+	}
+	for j := first; j < len(x); j++ {
+		best = math.Min(best, cost[last][j]/float64(steps[last][j]))
+	}
+	return best
+}
@@ -0,0 +1,47 @@
+package keyword
+
+import (
+	"math"
+
+	"github.com/garlicgarrison/go-recorder/dsp"
+)
+
+const (
+	// frames of an enrollment quieter than its loudest by this many dB at
+	// either end are trimmed as silence
+	trimLevel = 30.0
+)
+
+// extract is the feature vectors of a whole recording, trimmed of the
+// quiet frames at either end
+func extract(f *dsp.Features, samples []float64) [][]float64 {
+	var vectors [][]float64
+	var energies []float64
+	f.Reset()
+	f.Add(samples, func(vector []float64, energy float64) {
+		vectors = append(vectors, append([]float64(nil), vector...))
+		energies = append(energies, energy)
+	})
+	f.Reset()
+
+	if len(vectors) == 0 {
+		return nil
+	}
+
+	// the energy coefficient is the log of filter energies scaled by the
+	// DCT; compare in dB
+	loudest := math.Inf(-1)
+	for _, e := range energies {
+		loudest = math.Max(loudest, e)
+	}
+	cutoff := loudest - trimLevel/10*math.Ln10*math.Sqrt(dsp.FeatureFilters)
+
+	first, last := 0, len(vectors)-1
+	for first < last && energies[first] < cutoff {
+		first++
+	}
+	for last > first && energies[last] < cutoff {
+		last--
+	}
+	return vectors[first : last+1]
+}
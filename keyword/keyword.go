@@ -0,0 +1,201 @@
+// Package keyword spots a spoken phrase by matching MFCC features against
+// enrolled examples with dynamic time warping.
+package keyword
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/garlicgarrison/go-recorder/dsp"
+)
+
+const (
+	// the threshold, when derived from the templates, is this many times
+	// the mean distance between them
+	DefaultThresholdScale = 1.25
+
+	// the threshold with a single template and none set
+	DefaultThreshold = 4.0
+
+	// feature frames between matches, so a match ending anywhere is seen
+	matchEvery = 5
+
+	// the audio held for matching, as a multiple of the longest template
+	historyScale = 1.5
+)
+
+var (
+	ErrInvalidConfig = errors.New("invalid keyword config")
+	ErrNoTemplates   = errors.New("no keyword templates enrolled")
+	ErrTooShort      = errors.New("enrollment has no audio above silence")
+)
+
+type Config struct {
+	SampleRate    float64
+	InputChannels int
+
+	// the distance per DTW step at or below which audio matches a
+	// template. 0 derives it from the templates: DefaultThresholdScale
+	// times their mean distance from each other, or DefaultThreshold with
+	// only one.
+	Threshold float64
+}
+
+func DefaultConfig() *Config {
+	return &Config{
+		SampleRate:    22050,
+		InputChannels: 1,
+	}
+}
+
+// Spotter fires when the audio fed to it matches any of its templates, a
+// few enrolled recordings of the phrase. It is not safe for concurrent use.
+type Spotter struct {
+	cfg      *Config
+	features *dsp.Features
+
+	templates [][][]float64
+	threshold float64
+	longest   int
+
+	// recent feature vectors, oldest first, and how many arrived since
+	// the last match
+	history [][]float64
+	fresh   int
+
+	mixer *dsp.Downmix
+	mono  []float64
+	score float64
+}
+
+func NewSpotter(cfg *Config) (*Spotter, error) {
+	switch {
+	case cfg == nil:
+		return nil, ErrInvalidConfig
+	case cfg.SampleRate <= 0:
+		return nil, fmt.Errorf("%w: SampleRate must be positive", ErrInvalidConfig)
+	case cfg.InputChannels <= 0:
+		return nil, fmt.Errorf("%w: InputChannels must be positive", ErrInvalidConfig)
+	case cfg.Threshold < 0:
+		return nil, fmt.Errorf("%w: Threshold must not be negative", ErrInvalidConfig)
+	}
+
+	features, err := dsp.NewFeatures(cfg.SampleRate)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidConfig, err)
+	}
+
+	return &Spotter{
+		cfg:       cfg,
+		features:  features,
+		mixer:     dsp.NewDownmix(cfg.InputChannels),
+		threshold: cfg.Threshold,
+		score:     math.Inf(1),
+	}, nil
+}
+
+// Enroll adds a recording of the phrase, interleaved, as a template.
+// Silence around the phrase is trimmed.
+func (s *Spotter) Enroll(samples []int32) error {
+	template := extract(s.features, dsp.NewDownmix(s.cfg.InputChannels).Add(samples, nil))
+	if len(template) < matchEvery {
+		return ErrTooShort
+	}
+
+	s.templates = append(s.templates, template)
+	if len(template) > s.longest {
+		s.longest = len(template)
+	}
+
+	if s.cfg.Threshold == 0 {
+		s.threshold = s.derivedThreshold()
+	}
+	s.Reset()
+	return nil
+}
+
+// derivedThreshold scales the mean distance between the templates
+func (s *Spotter) derivedThreshold() float64 {
+	sum, pairs := 0.0, 0
+	for i := range s.templates {
+		for j := i + 1; j < len(s.templates); j++ {
+			sum += dtw(s.templates[i], s.templates[j])
+			pairs++
+		}
+	}
+
+	if pairs == 0 {
+		return DefaultThreshold
+	}
+	return DefaultThresholdScale * sum / float64(pairs)
+}
+
+// Templates is the number of templates enrolled
+func (s *Spotter) Templates() int {
+	return len(s.templates)
+}
+
+// Threshold is the distance at or below which audio matches
+func (s *Spotter) Threshold() float64 {
+	return s.threshold
+}
+
+// Score is the distance of the best match at the last check, +Inf before
+// one, for tuning the threshold
+func (s *Spotter) Score() float64 {
+	return s.score
+}
+
+// Process takes the next interleaved samples and reports whether the
+// phrase ended in them. Once it fires, the audio so far is forgotten so
+// the same phrase does not fire again. With no templates it never fires.
+func (s *Spotter) Process(samples []int32) bool {
+	if len(s.templates) == 0 {
+		return false
+	}
+
+	keep := int(math.Ceil(historyScale*float64(s.longest))) + matchEvery
+	fired := false
+	s.mono = s.mixer.Add(samples, s.mono[:0])
+	s.features.Add(s.mono, func(vector []float64, energy float64) {
+		if fired {
+			return
+		}
+
+		if len(s.history) == keep {
+			oldest := s.history[0]
+			s.history = s.history[:copy(s.history, s.history[1:])]
+			s.history = append(s.history, append(oldest[:0], vector...))
+		} else {
+			s.history = append(s.history, append([]float64(nil), vector...))
+		}
+
+		s.fresh++
+		if s.fresh < matchEvery {
+			return
+		}
+		s.fresh = 0
+
+		s.score = math.Inf(1)
+		for _, template := range s.templates {
+			s.score = math.Min(s.score, subsequence(template, s.history, matchEvery))
+		}
+		if s.score <= s.threshold {
+			fired = true
+		}
+	})
+
+	if fired {
+		s.Reset()
+	}
+	return fired
+}
+
+// Reset forgets the audio so far, keeping the templates
+func (s *Spotter) Reset() {
+	s.features.Reset()
+	s.mixer.Reset()
+	s.history = s.history[:0]
+	s.fresh = 0
+}
@@ -0,0 +1,153 @@
+package keyword
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const rate = 16000
+
+// vowel is a formant pair, in Hz
+type vowel [2]float64
+
+var (
+	phrase = []vowel{{700, 1200}, {300, 2300}, {500, 900}, {350, 1900}}
+	other  = []vowel{{300, 800}, {650, 1700}, {400, 2000}, {700, 1100}}
+)
+
+// say synthesizes vowels of 150ms each at a tempo, voiced at a pitch
+// shaped by the formants, gliding between them
+func say(vowels []vowel, tempo, pitch float64) []int32 {
+	per := int(0.15 * rate / tempo)
+	samples := make([]int32, per*len(vowels))
+	phase := 0.0
+	for i := range samples {
+		pos := float64(i) / float64(per)
+		k := int(pos)
+		next := k + 1
+		if next == len(vowels) {
+			next = k
+		}
+		glide := math.Max(0, pos-float64(k)-0.7) / 0.3
+		f1 := vowels[k][0] + glide*(vowels[next][0]-vowels[k][0])
+		f2 := vowels[k][1] + glide*(vowels[next][1]-vowels[k][1])
+
+		phase += 2 * math.Pi * pitch / rate
+		v := 0.0
+		for h := 1; float64(h)*pitch < 4000; h++ {
+			f := float64(h) * pitch
+			gain := 1/(1+math.Pow((f-f1)/80, 2)) + 0.7/(1+math.Pow((f-f2)/100, 2))
+			v += gain * math.Sin(float64(h)*phase)
+		}
+		samples[i] = int32(2e8 * v)
+	}
+	return samples
+}
+
+func noise(n int, rng *rand.Rand) []int32 {
+	samples := make([]int32, n)
+	for i := range samples {
+		samples[i] = int32(rng.NormFloat64() * 1e6)
+	}
+	return samples
+}
+
+func enrolled(t *testing.T, rng *rand.Rand) *Spotter {
+	cfg := DefaultConfig()
+	cfg.SampleRate = rate
+	s, err := NewSpotter(cfg)
+	assert.NoError(t, err)
+
+	for _, take := range []struct{ tempo, pitch float64 }{{1, 120}, {0.9, 130}, {1.1, 110}} {
+		recording := append(noise(rate/4, rng), say(phrase, take.tempo, take.pitch)...)
+		recording = append(recording, noise(rate/4, rng)...)
+		assert.NoError(t, s.Enroll(recording))
+	}
+	return s
+}
+
+// feed passes samples in buffers of 64 and returns the sample offsets at
+// whose buffers it fired
+func feed(s *Spotter, samples []int32) []int {
+	var fired []int
+	for i := 0; i < len(samples); i += 64 {
+		end := i + 64
+		if end > len(samples) {
+			end = len(samples)
+		}
+		if s.Process(samples[i:end]) {
+			fired = append(fired, end)
+		}
+	}
+	return fired
+}
+
+func TestEnroll(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	s := enrolled(t, rng)
+	assert.Equal(t, 3, s.Templates())
+	assert.Greater(t, s.Threshold(), 0.0)
+
+	assert.ErrorIs(t, s.Enroll(make([]int32, 100)), ErrTooShort)
+	assert.Equal(t, 3, s.Templates())
+
+	_, err := NewSpotter(&Config{SampleRate: rate})
+	assert.ErrorIs(t, err, ErrInvalidConfig)
+	_, err = NewSpotter(&Config{SampleRate: rate, InputChannels: 1, Threshold: -1})
+	assert.ErrorIs(t, err, ErrInvalidConfig)
+}
+
+func TestSpotter(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	s := enrolled(t, rng)
+
+	// another word first, then the phrase said a little differently
+	stream := noise(rate/2, rng)
+	stream = append(stream, say(other, 1, 120)...)
+	stream = append(stream, noise(rate/2, rng)...)
+	keywordStart := len(stream)
+	stream = append(stream, say(phrase, 0.95, 125)...)
+	keywordEnd := len(stream)
+	stream = append(stream, noise(rate/2, rng)...)
+
+	fired := feed(s, stream)
+	assert.Len(t, fired, 1)
+	if len(fired) == 1 {
+		assert.Greater(t, fired[0], keywordStart+(keywordEnd-keywordStart)/2)
+		assert.Less(t, fired[0], keywordEnd+rate/5)
+	}
+}
+
+func TestSpotterRejects(t *testing.T) {
+	rng := rand.New(rand.NewSource(2))
+	s := enrolled(t, rng)
+
+	stream := noise(rate/2, rng)
+	stream = append(stream, say(other, 1, 120)...)
+	stream = append(stream, say(phrase[:2], 1, 120)...)
+	stream = append(stream, noise(rate/2, rng)...)
+	assert.Empty(t, feed(s, stream))
+	assert.False(t, math.IsInf(s.Score(), 1))
+}
+
+func TestSpotterStereo(t *testing.T) {
+	rng := rand.New(rand.NewSource(3))
+	mono := enrolled(t, rng)
+
+	cfg := DefaultConfig()
+	cfg.SampleRate = rate
+	cfg.InputChannels = 2
+	s, err := NewSpotter(cfg)
+	assert.NoError(t, err)
+	s.templates, s.threshold, s.longest = mono.templates, mono.threshold, mono.longest
+
+	phraseSamples := say(phrase, 1, 120)
+	stream := make([]int32, 0, 2*len(phraseSamples))
+	for _, amp := range append(phraseSamples, noise(rate/4, rng)...) {
+		stream = append(stream, amp, amp/2)
+	}
+	assert.Len(t, feed(s, stream), 1)
+}
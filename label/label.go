@@ -0,0 +1,173 @@
+// Package label reads and writes stretches of a recording with a name, as
+// Audacity label tracks or the SPEAKER lines of RTTM files.
+package label
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidLabels = errors.New("invalid labels")
+)
+
+// Label is a stretch of speech, from ground truth or found by a VAD
+type Label struct {
+	Start time.Duration
+	End   time.Duration
+
+	// the Audacity label text, or the RTTM speaker
+	Name string
+}
+
+// Load reads an RTTM file if the path ends in .rttm, otherwise an Audacity
+// label file
+func Load(path string) ([]Label, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	if strings.EqualFold(filepath.Ext(path), ".rttm") {
+		return ParseRTTM(f)
+	}
+	return ParseAudacity(f)
+}
+
+// ParseAudacity reads an Audacity label track export: a start and end in
+// seconds and the label text per line, tab separated. The frequency range
+// lines of spectral selections, starting with a backslash, are skipped.
+func ParseAudacity(r io.Reader) ([]Label, error) {
+	var labels []Label
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, `\`) {
+			continue
+		}
+
+		fields := strings.SplitN(text, "\t", 3)
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("%w: line %d: want start and end", ErrInvalidLabels, line)
+		}
+
+		start, err := seconds(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("%w: line %d: %s", ErrInvalidLabels, line, err)
+		}
+		end, err := seconds(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("%w: line %d: %s", ErrInvalidLabels, line, err)
+		}
+
+		label := Label{Start: start, End: end}
+		if len(fields) == 3 {
+			label.Name = fields[2]
+		}
+		labels = append(labels, label)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return sortLabels(labels)
+}
+
+// ParseRTTM reads the SPEAKER lines of an RTTM file: type, file, channel,
+// onset and duration in seconds, two unused fields and the speaker name
+func ParseRTTM(r io.Reader) ([]Label, error) {
+	var labels []Label
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || fields[0] != "SPEAKER" {
+			continue
+		}
+		if len(fields) < 8 {
+			return nil, fmt.Errorf("%w: line %d: want at least 8 fields", ErrInvalidLabels, line)
+		}
+
+		start, err := seconds(fields[3])
+		if err != nil {
+			return nil, fmt.Errorf("%w: line %d: %s", ErrInvalidLabels, line, err)
+		}
+		duration, err := seconds(fields[4])
+		if err != nil {
+			return nil, fmt.Errorf("%w: line %d: %s", ErrInvalidLabels, line, err)
+		}
+
+		labels = append(labels, Label{
+			Start: start,
+			End:   start + duration,
+			Name:  fields[7],
+		})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return sortLabels(labels)
+}
+
+// WriteAudacity writes labels as an Audacity label track
+func WriteAudacity(w io.Writer, labels []Label) error {
+	for _, l := range labels {
+		_, err := fmt.Fprintf(w, "%.6f\t%.6f\t%s\n", l.Start.Seconds(), l.End.Seconds(), l.Name)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteRTTM writes labels as the SPEAKER lines of an RTTM file, naming
+// unnamed labels "speech"
+func WriteRTTM(w io.Writer, file string, labels []Label) error {
+	for _, l := range labels {
+		name := l.Name
+		if name == "" {
+			name = "speech"
+		}
+
+		_, err := fmt.Fprintf(w, "SPEAKER %s 1 %.3f %.3f <NA> <NA> %s <NA> <NA>\n",
+			file, l.Start.Seconds(), (l.End - l.Start).Seconds(), name)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func seconds(field string) (time.Duration, error) {
+	s, err := strconv.ParseFloat(field, 64)
+	if err != nil {
+		return 0, err
+	}
+	if s < 0 {
+		return 0, fmt.Errorf("negative time %s", field)
+	}
+	return time.Duration(s * float64(time.Second)), nil
+}
+
+// sortLabels orders labels by start, checking each ends after it starts
+func sortLabels(labels []Label) ([]Label, error) {
+	for _, l := range labels {
+		if l.End < l.Start {
+			return nil, fmt.Errorf("%w: label at %s ends before it starts", ErrInvalidLabels, l.Start)
+		}
+	}
+
+	sort.SliceStable(labels, func(i, j int) bool {
+		return labels[i].Start < labels[j].Start
+	})
+	return labels, nil
+}
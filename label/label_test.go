@@ -0,0 +1,65 @@
+package label
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseAudacity(t *testing.T) {
+	labels, err := ParseAudacity(strings.NewReader(
+		"2.5\t3.25\tsecond\n" +
+			"0.5\t1.000000\tfirst word\n" +
+			"\\\t100.0\t4000.0\n" +
+			"4\t4\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, []Label{
+		{Start: 500 * time.Millisecond, End: time.Second, Name: "first word"},
+		{Start: 2500 * time.Millisecond, End: 3250 * time.Millisecond, Name: "second"},
+		{Start: 4 * time.Second, End: 4 * time.Second},
+	}, labels)
+
+	_, err = ParseAudacity(strings.NewReader("1.0\n"))
+	assert.ErrorIs(t, err, ErrInvalidLabels)
+	_, err = ParseAudacity(strings.NewReader("2.0\t1.0\tbackwards\n"))
+	assert.ErrorIs(t, err, ErrInvalidLabels)
+	_, err = ParseAudacity(strings.NewReader("a\t1.0\n"))
+	assert.ErrorIs(t, err, ErrInvalidLabels)
+}
+
+func TestParseRTTM(t *testing.T) {
+	labels, err := ParseRTTM(strings.NewReader(
+		"SPKR-INFO meeting 1 <NA> <NA> <NA> unknown alice <NA> <NA>\n" +
+			"SPEAKER meeting 1 3.00 1.50 <NA> <NA> bob <NA> <NA>\n" +
+			"SPEAKER meeting 1 0.25 2.00 <NA> <NA> alice <NA> <NA>\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, []Label{
+		{Start: 250 * time.Millisecond, End: 2250 * time.Millisecond, Name: "alice"},
+		{Start: 3 * time.Second, End: 4500 * time.Millisecond, Name: "bob"},
+	}, labels)
+
+	_, err = ParseRTTM(strings.NewReader("SPEAKER meeting 1 3.00\n"))
+	assert.ErrorIs(t, err, ErrInvalidLabels)
+}
+
+func TestWriteLabels(t *testing.T) {
+	labels := []Label{
+		{Start: 250 * time.Millisecond, End: 2250 * time.Millisecond, Name: "alice"},
+		{Start: 3 * time.Second, End: 4500 * time.Millisecond, Name: "bob"},
+	}
+
+	var audacity bytes.Buffer
+	assert.NoError(t, WriteAudacity(&audacity, labels))
+	parsed, err := ParseAudacity(&audacity)
+	assert.NoError(t, err)
+	assert.Equal(t, labels, parsed)
+
+	var rttm bytes.Buffer
+	assert.NoError(t, WriteRTTM(&rttm, "meeting", labels))
+	parsed, err = ParseRTTM(&rttm)
+	assert.NoError(t, err)
+	assert.Equal(t, labels, parsed)
+}
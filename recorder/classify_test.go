@@ -0,0 +1,101 @@
+package recorder
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/garlicgarrison/go-recorder/stream"
+	"github.com/garlicgarrison/go-recorder/vad"
+	"github.com/stretchr/testify/assert"
+)
+
+const classRate = 16000
+
+// held is a chord held for a while, like hold music
+func held(n int) []int32 {
+	samples := make([]int32, n)
+	for i := range samples {
+		t := float64(i) / classRate
+		v := 0.0
+		for _, f := range []float64{261.63, 329.63, 392} {
+			for h := 1.0; h <= 4; h++ {
+				v += math.Sin(2*math.Pi*f*h*t) / h
+			}
+		}
+		samples[i] = int32(1e8 * v)
+	}
+	return samples
+}
+
+// syllables alternate a voiced glide with a burst of hiss five times a
+// second, with a pause now and then
+func syllables(rng *rand.Rand, n int) []int32 {
+	samples := make([]int32, n)
+	phase := 0.0
+	for i := range samples {
+		t := float64(i) / classRate
+		syllable := int(t / 0.2)
+		x := math.Mod(t, 0.2) / 0.2
+		switch {
+		case syllable%4 == 3:
+			samples[i] = int32(1e5 * rng.NormFloat64())
+		case x < 0.6:
+			f0 := 140 - 40*x + float64(syllable%3)*15
+			phase += 2 * math.Pi * f0 / classRate
+			v := 0.0
+			for h := 1.0; h <= 12; h++ {
+				v += math.Sin(h*phase) / h
+			}
+			samples[i] = int32(3e8 * math.Sin(math.Pi*x/0.6) * v)
+		default:
+			samples[i] = int32(3e7 * rng.NormFloat64())
+		}
+	}
+	return samples
+}
+
+func TestDropNonSpeech(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	quiet := func(n int) []int32 {
+		samples := make([]int32, n)
+		for i := range samples {
+			samples[i] = int32(1e5 * rng.NormFloat64())
+		}
+		return samples
+	}
+
+	var samples []int32
+	samples = append(samples, quiet(classRate)...)
+	samples = append(samples, held(3*classRate)...)
+	samples = append(samples, quiet(2*classRate)...)
+	talkStart := len(samples)
+	samples = append(samples, syllables(rng, 3*classRate)...)
+	samples = append(samples, quiet(2*classRate)...)
+
+	class, features := vad.Classify(classRate, 1, samples[talkStart:talkStart+3*classRate])
+	assert.Equal(t, vad.SpeechClass, class, "%+v", features)
+
+	cfg := DefaultRecorderConfig()
+	cfg.SampleRate = classRate
+	cfg.FramesPerBuffer = 160
+	cfg.VADConfig.SampleRate = classRate
+	cfg.VADConfig.FramesPerBuffer = 160
+	cfg.VADConfig.NonSpeech = vad.DropNonSpeech
+
+	r, err := NewRecorder(cfg, &scriptSource{
+		clock:   stream.NewClock(cfg.SampleRate, cfg.InputChannels),
+		size:    cfg.FramesPerBuffer,
+		samples: samples,
+	})
+	assert.NoError(t, err)
+
+	b, err := r.RecordVAD(WAV)
+	assert.NoError(t, err)
+	recorded := decode(t, b)
+
+	// the held chord is passed over, the talking recorded
+	span := r.LastSpan()
+	assert.InDelta(t, talkStart, span.SpeechStartIndex, 0.1*classRate)
+	assert.Equal(t, samples[span.StartIndex:span.EndIndex], recorded)
+}
@@ -2,14 +2,19 @@ package recorder
 
 import (
 	"bytes"
+	"context"
 	"errors"
+	"fmt"
+	"io"
 	"log"
 	"os"
 	"os/signal"
 	"time"
 
 	"github.com/garlicgarrison/go-recorder/codec"
+	"github.com/garlicgarrison/go-recorder/ingest"
 	"github.com/garlicgarrison/go-recorder/stream"
+	"github.com/garlicgarrison/go-recorder/tone"
 	"github.com/garlicgarrison/go-recorder/vad"
 )
 
@@ -20,6 +25,14 @@ const (
 	AIFF Format = "aiff"
 )
 
+const (
+	DefaultPreallocTime = 10000 // milliseconds
+	DefaultPreRollTime  = 300   // milliseconds
+	DefaultPostRollTime = 300   // milliseconds
+
+	DefaultTriggerTimeout = 5000 // milliseconds
+)
+
 var (
 	ErrInvalidRecorderConfig = errors.New("invalid config")
 )
@@ -30,15 +43,55 @@ type RecorderConfig struct {
 	FramesPerBuffer int
 	MaxTime         int //milliseconds
 
+	// milliseconds of audio to allocate up front for each recording, so a
+	// typical one never has to grow and copy
+	PreallocTime int
+
+	// milliseconds of audio RecordVAD keeps from before the VAD detects
+	// speech, and records after it detects silence, so the onset the VAD
+	// needed as evidence and the trailing syllable are not clipped
+	PreRollTime  int
+	PostRollTime int
+
+	// milliseconds after a start trigger fires within which speech must
+	// begin to be recorded, before RecordVAD waits for the trigger again
+	TriggerTimeout int
+
 	VADConfig *vad.VADConfig
 }
 
+// Span places a recording on its source's timeline
+type Span struct {
+	StartIndex uint64
+	EndIndex   uint64
+	Start      time.Time
+	End        time.Time
+
+	// frames lost to dropouts while recording
+	Dropped uint64
+
+	// where the VAD placed the speech in a RecordVAD recording, which runs
+	// from PreRollTime before SpeechStartIndex to PostRollTime after
+	// SpeechEndIndex
+	SpeechStartIndex uint64
+	SpeechEndIndex   uint64
+
+	// the tones heard during a RecordVAD recording, with SetMarkers
+	Markers []Marker
+}
+
 type Recorder struct {
 	cfg    *RecorderConfig
-	stream *stream.Stream
+	stream stream.Source
 	vad    *vad.VAD
 
-	quit chan bool
+	start   Trigger
+	stop    Trigger
+	markers tone.Detector
+
+	span     Span
+	prev     *stream.Buffer
+	timeline timeline
 }
 
 func DefaultRecorderConfig() *RecorderConfig {
@@ -47,68 +100,162 @@ func DefaultRecorderConfig() *RecorderConfig {
 		InputChannels:   1,
 		FramesPerBuffer: 64,
 		MaxTime:         100000,
+		PreallocTime:    DefaultPreallocTime,
+		PreRollTime:     DefaultPreRollTime,
+		PostRollTime:    DefaultPostRollTime,
+		TriggerTimeout:  DefaultTriggerTimeout,
 
 		VADConfig: vad.DefaultVADConfig(),
 	}
 }
 
-func NewRecorder(cfg *RecorderConfig, stream *stream.Stream) (*Recorder, error) {
+// newRecording allocates room for PreallocTime of audio, capped at MaxTime
+func (r *Recorder) newRecording() []int32 {
+	ms := r.cfg.PreallocTime
+	if r.cfg.MaxTime > 0 && ms > r.cfg.MaxTime {
+		ms = r.cfg.MaxTime
+	}
+	if ms <= 0 {
+		return []int32{}
+	}
+
+	return make([]int32, 0, r.samples(ms))
+}
+
+// samples is the number of interleaved samples in ms milliseconds
+func (r *Recorder) samples(ms int) int {
+	return int(float64(ms)/1000*r.cfg.SampleRate) * r.cfg.InputChannels
+}
+
+// NewRecorder records from any stream.Source, such as a *stream.Stream or a
+// stream.Tee subscriber, detecting speech with the VADConfig's method
+func NewRecorder(cfg *RecorderConfig, stream stream.Source) (*Recorder, error) {
+	return newRecorder(cfg, stream, func() (*vad.VAD, error) {
+		return vad.NewVAD(cfg.VADConfig)
+	})
+}
+
+// NewRecorderWithDetector detects speech with any vad.Detector, such as a
+// model behind a local inference server
+func NewRecorderWithDetector(cfg *RecorderConfig, stream stream.Source, detector vad.Detector) (*Recorder, error) {
+	return newRecorder(cfg, stream, func() (*vad.VAD, error) {
+		return vad.NewVADWithDetector(cfg.VADConfig, detector)
+	})
+}
+
+func newRecorder(cfg *RecorderConfig, stream stream.Source, newVAD func() (*vad.VAD, error)) (*Recorder, error) {
 	if cfg == nil {
 		return nil, ErrInvalidRecorderConfig
 	}
+	if cfg.PreRollTime < 0 || cfg.PostRollTime < 0 {
+		return nil, fmt.Errorf("%w: PreRollTime and PostRollTime must not be negative", ErrInvalidRecorderConfig)
+	}
+	if cfg.TriggerTimeout < 0 {
+		return nil, fmt.Errorf("%w: TriggerTimeout must not be negative", ErrInvalidRecorderConfig)
+	}
+
+	vad, err := newVAD()
+	if err != nil {
+		return nil, err
+	}
 
-	vad := vad.NewVAD(cfg.VADConfig)
 	return &Recorder{
 		cfg:    cfg,
 		stream: stream,
 		vad:    vad,
-
-		quit: make(chan bool),
+		timeline: timeline{
+			channels: cfg.InputChannels,
+			rate:     cfg.SampleRate,
+		},
 	}, nil
 }
 
+// Record captures until quit fires or MaxTime passes. The pending read is
+// cancelled, so a stalled device cannot hold up the stop.
 func (r *Recorder) Record(format Format, quit chan bool) (*bytes.Buffer, error) {
-	timerChan := make(chan bool)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*time.Duration(r.cfg.MaxTime))
+	defer cancel()
 	go func() {
-		time.Sleep(time.Millisecond * time.Duration(r.cfg.MaxTime))
-		timerChan <- true
+		select {
+		case <-quit:
+			cancel()
+		case <-ctx.Done():
+		}
 	}()
 
-	fullStream := []int32{}
+	r.prev = nil
+	fullStream := r.newRecording()
 	for {
-		buffer, err := r.stream.Read()
+		buffer, err := r.stream.Read(ctx)
+		if ctx.Err() != nil {
+			return encode(format, fullStream)
+		}
 		if err != nil {
 			return nil, err
 		}
 
-		currStream := make([]int32, r.cfg.FramesPerBuffer)
-		copy(currStream, buffer)
-		fullStream = append(fullStream, currStream...)
-		select {
-		case <-quit:
-			switch format {
-			case AIFF:
-				return codec.NewDefaultAIFF(fullStream).EncodeAIFF()
-			case WAV:
-				return codec.NewDefaultWAV(fullStream).EncodeWAV()
-			}
-		case <-timerChan:
-			switch format {
-			case AIFF:
-				return codec.NewDefaultAIFF(fullStream).EncodeAIFF()
-			case WAV:
-				return codec.NewDefaultWAV(fullStream).EncodeWAV()
-			}
-		default:
+		r.track(buffer)
+		fullStream = append(fullStream, buffer.Samples...)
+		buffer.Release()
+	}
+}
+
+// LastSpan reports where the last recording sits on the source's timeline
+func (r *Recorder) LastSpan() Span {
+	return r.span
+}
+
+// NoiseFloor is the VAD's current noise floor as an RMS amplitude, for
+// diagnostics
+func (r *Recorder) NoiseFloor() float64 {
+	return r.vad.NoiseFloor()
+}
+
+// Speaker is the input channel the VAD hears speaking, -1 when none is. Set
+// a ChannelPolicy in the VADConfig to tell the channels apart.
+func (r *Recorder) Speaker() int {
+	return r.vad.Speaker()
+}
+
+// track extends the current span with a recorded buffer
+func (r *Recorder) track(buffer *stream.Buffer) {
+	if r.prev == nil {
+		r.span = Span{
+			StartIndex: buffer.Index,
+			Start:      buffer.Time,
 		}
+	} else if gap := stream.Gap(r.prev, buffer); gap > 0 {
+		log.Printf("dropout -- %d frames missing at %d", gap, r.prev.End())
+		r.span.Dropped += gap
 	}
+
+	r.span.EndIndex = buffer.End()
+	r.span.End = buffer.Time.Add(time.Duration(float64(buffer.Frames) / r.cfg.SampleRate * float64(time.Second)))
+	r.prev = buffer
 }
 
+// RecordVAD waits for speech and records until silence, padded with
+// PreRollTime before the speech and PostRollTime after it. Speech that
+// resumes within the post-roll continues the recording. With DropNonSpeech
+// in the VADConfig, a recording the VAD classifies as music or noise is
+// discarded and RecordVAD waits for speech again. An interrupt while
+// waiting returns context.Canceled; an interrupt while recording stops and
+// returns what was captured, as does the source ending.
 func (r *Recorder) RecordVAD(format Format) (*bytes.Buffer, error) {
 	log.Printf("Listening...")
-	speechCh := make(chan bool)
 	signalCh := make(chan os.Signal, 1)
 	signal.Notify(signalCh, os.Interrupt)
+	defer signal.Stop(signalCh)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-signalCh:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
 
 	err := r.stream.Start()
 	if err != nil {
@@ -116,102 +263,204 @@ func (r *Recorder) RecordVAD(format Format) (*bytes.Buffer, error) {
 	}
 	defer r.stream.Close()
 
-	go func() {
-		detectStop := make(chan bool)
-		for {
-			if r.vad.DetectSpeech(detectStop) {
-				break
-			}
-
-			quit := false
-			select {
-			case <-signalCh:
-				r.quit <- true
-				detectStop <- true
-				quit = true
-			default:
+	r.vad.Reset()
+	r.timeline.reset()
+	preRoll := uint64(r.samples(r.cfg.PreRollTime))
+	postRoll := uint64(r.samples(r.cfg.PostRollTime))
+
+	// without a start trigger, any speech is recorded; with one, speech
+	// that begins within the timeout after it fired, from where it fired
+	armed := r.start == nil
+	var armedAt uint64
+	timeout := uint64(r.samples(r.cfg.TriggerTimeout))
+	cueTail := uint64(r.samples(r.cfg.VADConfig.VoiceTimeframe))
+	if r.start != nil {
+		r.start.Reset()
+	}
+	if r.stop != nil {
+		r.stop.Reset()
+	}
+	if r.markers != nil {
+		r.markers.Reset()
+	}
+	var heard []tone.Event
+
+	// while listening, the samples a SpeechStart and its pre-roll can reach
+	// back to, from offset first
+	keep := int(preRoll) + r.vad.Lookback()
+	history := make([]int32, 0, 2*keep)
+	var first uint64
+
+	var (
+		fullStream  []int32
+		offset      uint64 // samples read
+		start       uint64 // offset of fullStream[0]
+		speechStart uint64
+		speechEnd   uint64
+		recording   bool
+		ending      bool
+		spoken      bool // speech in the recording has ended and been kept
+	)
+	for !ending || offset < speechEnd+postRoll {
+		buffer, err := r.stream.Read(ctx)
+		if err != nil {
+			if !recording {
+				if ctx.Err() != nil {
+					return nil, ctx.Err()
+				}
+				log.Printf("stream error -- %s", err)
+				return nil, err
 			}
-
-			if quit {
+			if ctx.Err() != nil || endOfStream(err) {
+				if !ending {
+					speechEnd = offset
+				}
 				break
 			}
-		}
-
-		speechCh <- true
-	}()
-
-	for {
-		buffer, err := r.stream.Read()
-		if err != nil {
-			log.Printf("stream error -- %s", err)
 			return nil, err
 		}
-		r.vad.AddBuffer(buffer)
 
-		quit := false
-		select {
-		case <-speechCh:
-			quit = true
-		case <-r.quit:
-			quit = true
-		default:
-			continue
+		r.timeline.add(offset, buffer)
+		if recording {
+			fullStream = append(fullStream, buffer.Samples...)
+		} else {
+			history = append(history, buffer.Samples...)
+		}
+		events := r.vad.Process(buffer.Samples)
+		triggered := !recording && r.start != nil && r.start.Process(buffer.Samples)
+		stopped := r.stop != nil && r.stop.Process(buffer.Samples)
+		if r.markers != nil {
+			heard = append(heard, r.markers.Process(buffer.Samples)...)
+		}
+		offset += uint64(len(buffer.Samples))
+		buffer.Release()
+
+		// begin starts recording speech from an offset, with the pre-roll
+		// reaching back no further than what was read or the trigger
+		begin := func(at uint64) {
+			log.Printf("Waiting...")
+			recording = true
+			spoken = false
+			speechStart = at
+			if speechStart < armedAt {
+				speechStart = armedAt
+			}
+			start = first
+			if armedAt > start {
+				start = armedAt
+			}
+			if speechStart > start+preRoll {
+				start = speechStart - preRoll
+			}
+			fullStream = append(r.newRecording(), history[start-first:]...)
 		}
 
-		if quit {
-			break
+		for _, event := range events {
+			switch event.Type {
+			case vad.SpeechStart:
+				ending = false
+				if recording || !armed {
+					continue
+				}
+				begin(event.Offset)
+			case vad.SpeechEnd:
+				if !recording {
+					continue
+				}
+				if r.start != nil && speechStart == armedAt && event.Offset < armedAt+cueTail {
+					// only the end of the cue: wait for the speech after
+					// it, keeping what was read since
+					recording = false
+					history = append(history[:start-first], fullStream...)
+					continue
+				}
+				if r.cfg.VADConfig.NonSpeech == vad.DropNonSpeech && event.Class != vad.SpeechClass {
+					if spoken {
+						// resumed as music or noise: end with the speech
+						// before it
+						ending = true
+						continue
+					}
+					log.Printf("Dropped %s...", event.Class)
+					recording = false
+					history = append(history[:start-first], fullStream...)
+					continue
+				}
+				ending = true
+				spoken = true
+				speechEnd = event.Offset
+			}
 		}
-	}
 
-	log.Printf("Waiting...")
-	go func() {
-		detectStop := make(chan bool)
-		for {
-			if r.vad.DetectSilence(detectStop) {
-				break
+		if triggered {
+			log.Printf("Triggered...")
+			armed = true
+			armedAt = offset
+
+			// speech running on from the cue is recorded from its end
+			if r.vad.Speaking() {
+				begin(armedAt)
 			}
+		} else if !recording && r.start != nil && armed && offset-armedAt > timeout {
+			log.Printf("Trigger timed out...")
+			armed = false
+		}
 
-			quit := false
-			select {
-			case <-signalCh:
-				r.quit <- true
-				detectStop <- true
-				quit = true
-			default:
+		if recording && stopped {
+			ending = true
+			postRoll = 0
+			speechEnd = offset
+			if c, ok := r.stop.(CueTrigger); ok && c.CueOffset() < offset {
+				speechEnd = c.CueOffset()
 			}
-			if quit {
-				break
+			if speechEnd < start {
+				speechEnd = start
 			}
 		}
 
-		speechCh <- true
-	}()
-
-	fullStream := []int32{}
-	for {
-		buffer, err := r.stream.Read()
-		if err != nil {
-			return nil, err
+		if !recording && len(history) > keep {
+			drop := len(history) - keep
+			first += uint64(drop)
+			history = history[:copy(history, history[drop:])]
+			r.timeline.trim(first)
 		}
-		r.vad.AddBuffer(buffer)
-		fullStream = append(fullStream, buffer...)
+	}
 
-		quit := false
-		select {
-		case <-speechCh:
-			quit = true
-		case <-r.quit:
-			quit = true
-		default:
+	// the silence window that ended the speech may run past the post-roll
+	end := speechEnd + postRoll
+	if end > offset {
+		end = offset
+	}
+	fullStream = fullStream[:end-start]
+
+	r.span = Span{}
+	var startDropped, endDropped uint64
+	r.span.StartIndex, r.span.Start, startDropped = r.timeline.at(start)
+	r.span.EndIndex, r.span.End, endDropped = r.timeline.at(end)
+	r.span.SpeechStartIndex, _, _ = r.timeline.at(speechStart)
+	r.span.SpeechEndIndex, _, _ = r.timeline.at(speechEnd)
+	r.span.Dropped = endDropped - startDropped
+
+	for _, e := range heard {
+		if e.Offset < start || e.Offset >= end {
 			continue
 		}
-
-		if quit {
-			break
-		}
+		m := Marker{Symbol: e.Symbol}
+		m.Index, m.Time, _ = r.timeline.at(e.Offset)
+		r.span.Markers = append(r.span.Markers, m)
 	}
 
 	log.Printf("Stopped...")
+	return encode(format, fullStream)
+}
+
+// endOfStream reports whether a source ran out rather than failed: a
+// PCMSource at the end of its input, or an ingest session whose client left
+func endOfStream(err error) bool {
+	return errors.Is(err, io.EOF) || errors.Is(err, ingest.ErrSessionClosed)
+}
+
+func encode(format Format, fullStream []int32) (*bytes.Buffer, error) {
 	switch format {
 	case AIFF:
 		return codec.NewDefaultAIFF(fullStream).EncodeAIFF()
@@ -0,0 +1,82 @@
+package recorder
+
+import (
+	"context"
+	"runtime"
+	"testing"
+
+	"github.com/garlicgarrison/go-recorder/stream"
+)
+
+// benchSource hands out n buffers, then fires quit and waits to be cancelled
+type benchSource struct {
+	pool   *stream.BufferPool
+	clock  *stream.Clock
+	size   int
+	n      int
+	quit   chan bool
+	pooled bool
+}
+
+func (s *benchSource) Start() error { return nil }
+func (s *benchSource) Close() error { return nil }
+
+func (s *benchSource) Read(ctx context.Context) (*stream.Buffer, error) {
+	if s.n == 0 {
+		close(s.quit)
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	s.n--
+
+	if !s.pooled {
+		return s.clock.Stamp(make([]int32, s.size)), nil
+	}
+
+	buffer := s.pool.Get()
+	s.clock.StampBuffer(buffer)
+	return buffer, nil
+}
+
+// ten seconds of default-config audio per op
+func benchmarkRecord(b *testing.B, pooled bool) {
+	cfg := DefaultRecorderConfig()
+	buffers := int(10*cfg.SampleRate) / cfg.FramesPerBuffer
+	pool := stream.NewBufferPool(cfg.FramesPerBuffer)
+
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		src := &benchSource{
+			pool:   pool,
+			clock:  stream.NewClock(cfg.SampleRate, cfg.InputChannels),
+			size:   cfg.FramesPerBuffer,
+			n:      buffers,
+			quit:   make(chan bool),
+			pooled: pooled,
+		}
+
+		r, err := NewRecorder(cfg, src)
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		_, err = r.Record(WAV, src.quit)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	runtime.ReadMemStats(&after)
+	b.ReportMetric(float64(after.NumGC-before.NumGC)/float64(b.N), "gc/op")
+}
+
+func BenchmarkRecordPooled(b *testing.B) {
+	benchmarkRecord(b, true)
+}
+
+func BenchmarkRecordUnpooled(b *testing.B) {
+	benchmarkRecord(b, false)
+}
@@ -0,0 +1,87 @@
+package recorder
+
+import (
+	"log"
+	"sort"
+	"time"
+
+	"github.com/garlicgarrison/go-recorder/stream"
+)
+
+// timeline maps offsets in the samples read, as the VAD counts them, back to
+// the source's frame indexes and capture times, across dropouts
+type timeline struct {
+	channels int
+	rate     float64
+
+	marks   []mark
+	end     uint64 // source frame index after the last buffer
+	dropped uint64
+}
+
+// mark is where a buffer starts
+type mark struct {
+	offset uint64
+	index  uint64
+	time   time.Time
+
+	// frames lost to dropouts before the buffer, since the reset
+	dropped uint64
+}
+
+func (t *timeline) reset() {
+	t.marks = t.marks[:0]
+	t.dropped = 0
+}
+
+// add marks a buffer whose first sample is at offset
+func (t *timeline) add(offset uint64, buffer *stream.Buffer) {
+	if len(t.marks) > 0 && buffer.Index > t.end {
+		gap := buffer.Index - t.end
+		log.Printf("dropout -- %d frames missing at %d", gap, t.end)
+		t.dropped += gap
+	}
+
+	t.marks = append(t.marks, mark{
+		offset:  offset,
+		index:   buffer.Index,
+		time:    buffer.Time,
+		dropped: t.dropped,
+	})
+	t.end = buffer.End()
+}
+
+// trim forgets the buffers that end before offset
+func (t *timeline) trim(offset uint64) {
+	i := t.find(offset)
+	if i > 0 {
+		t.marks = t.marks[:copy(t.marks, t.marks[i:])]
+	}
+}
+
+// find is the position of the last mark at or before offset
+func (t *timeline) find(offset uint64) int {
+	i := sort.Search(len(t.marks), func(i int) bool {
+		return t.marks[i].offset > offset
+	})
+	if i > 0 {
+		i--
+	}
+	return i
+}
+
+// at returns the frame index and capture time of the sample at offset, and
+// the frames dropped before it since the reset
+func (t *timeline) at(offset uint64) (uint64, time.Time, uint64) {
+	if len(t.marks) == 0 {
+		return 0, time.Time{}, 0
+	}
+
+	m := t.marks[t.find(offset)]
+	if offset < m.offset {
+		offset = m.offset
+	}
+	frames := (offset - m.offset) / uint64(t.channels)
+	at := m.time.Add(time.Duration(float64(frames) / t.rate * float64(time.Second)))
+	return m.index + frames, at, m.dropped
+}
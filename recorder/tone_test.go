@@ -0,0 +1,100 @@
+package recorder
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/garlicgarrison/go-recorder/stream"
+	"github.com/garlicgarrison/go-recorder/tone"
+	"github.com/stretchr/testify/assert"
+)
+
+const phoneRate = 8000
+
+// phone builds a call at 8kHz out of hiss, keys and a 200Hz voice
+type phone struct {
+	rng     *rand.Rand
+	samples []int32
+}
+
+func (p *phone) hiss(ms int) int {
+	at := len(p.samples)
+	for i := 0; i < ms*8; i++ {
+		p.samples = append(p.samples, int32(p.rng.NormFloat64()*1e6))
+	}
+	return at
+}
+
+func (p *phone) voice(ms int) int {
+	at := len(p.samples)
+	for i := 0; i < ms*8; i++ {
+		p.samples = append(p.samples, int32(3e8*math.Sin(2*math.Pi*200*float64(i)/phoneRate)))
+	}
+	return at
+}
+
+func (p *phone) key(row, column float64) int {
+	at := len(p.samples)
+	for i := 0; i < 100*8; i++ {
+		t := float64(i) / phoneRate
+		p.samples = append(p.samples, int32(3e8*(math.Sin(2*math.Pi*row*t)+math.Sin(2*math.Pi*column*t))))
+	}
+	return at
+}
+
+func dtmf(t *testing.T) *tone.DTMFDetector {
+	cfg := tone.DefaultDTMFConfig()
+	cfg.SampleRate = phoneRate
+	d, err := tone.NewDTMFDetector(cfg)
+	assert.NoError(t, err)
+	return d
+}
+
+func TestToneTriggers(t *testing.T) {
+	// press 1 to start, 2 is a marker, # to stop
+	p := &phone{rng: rand.New(rand.NewSource(1))}
+	p.hiss(1000)
+	p.key(697, 1209)
+	p.hiss(200)
+	p.voice(1000)
+	p.hiss(200)
+	two := p.key(697, 1336)
+	p.hiss(200)
+	p.voice(500)
+	p.hiss(100)
+	hash := p.key(941, 1477)
+	p.hiss(2000)
+
+	cfg := DefaultRecorderConfig()
+	cfg.SampleRate = phoneRate
+	cfg.FramesPerBuffer = 160
+	cfg.VADConfig.SampleRate = phoneRate
+	cfg.VADConfig.FramesPerBuffer = 160
+
+	r, err := NewRecorder(cfg, &scriptSource{
+		clock:   stream.NewClock(cfg.SampleRate, cfg.InputChannels),
+		size:    cfg.FramesPerBuffer,
+		samples: p.samples,
+	})
+	assert.NoError(t, err)
+	r.SetStartTrigger(tone.NewTrigger(dtmf(t), "1"))
+	r.SetStopTrigger(tone.NewTrigger(dtmf(t), "#"))
+	r.SetMarkers(dtmf(t))
+
+	b, err := r.RecordVAD(WAV)
+	assert.NoError(t, err)
+	recorded := decode(t, b)
+
+	// the recording stops where the # began, with no post-roll
+	span := r.LastSpan()
+	assert.InDelta(t, hash, span.EndIndex, 205)
+	assert.Equal(t, p.samples[span.StartIndex:span.EndIndex], recorded)
+	assert.LessOrEqual(t, span.StartIndex, span.SpeechStartIndex)
+
+	assert.Len(t, span.Markers, 1)
+	if len(span.Markers) == 1 {
+		assert.Equal(t, "2", span.Markers[0].Symbol)
+		assert.InDelta(t, two, span.Markers[0].Index, 205)
+	}
+}
@@ -0,0 +1,56 @@
+package recorder
+
+import (
+	"time"
+
+	"github.com/garlicgarrison/go-recorder/tone"
+)
+
+// Trigger watches the stream for a cue, such as a *keyword.Spotter for a
+// spoken phrase or a *tone.Trigger for a DTMF key
+type Trigger interface {
+	// Process takes the next interleaved samples and reports whether the
+	// cue ended in them
+	Process(samples []int32) bool
+
+	// Reset forgets the samples so far
+	Reset()
+}
+
+// CueTrigger is a Trigger that knows where its cue began, in samples since
+// its reset, such as a *tone.Trigger
+type CueTrigger interface {
+	Trigger
+
+	CueOffset() uint64
+}
+
+// Marker is a tone heard during a recording, such as a DTMF key or a sync
+// beep
+type Marker struct {
+	Symbol string
+	Index  uint64
+	Time   time.Time
+}
+
+// SetStartTrigger puts a trigger in front of the VAD: RecordVAD ignores
+// speech until the trigger fires, then records the speech that follows it
+// within TriggerTimeout. The cue itself is left out of the recording. nil
+// removes the trigger.
+func (r *Recorder) SetStartTrigger(trigger Trigger) {
+	r.start = trigger
+}
+
+// SetStopTrigger ends RecordVAD's speech when the trigger fires during it,
+// without the post-roll. A CueTrigger ends it where its cue began, leaving
+// the cue out; any other trigger where it fired. nil removes the trigger.
+func (r *Recorder) SetStopTrigger(trigger Trigger) {
+	r.stop = trigger
+}
+
+// SetMarkers has RecordVAD run a tone detector over the stream and report
+// the tones heard during each recording in its Span's Markers, in order.
+// The detector must not also be behind a trigger. nil removes it.
+func (r *Recorder) SetMarkers(detector tone.Detector) {
+	r.markers = detector
+}
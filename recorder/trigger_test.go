@@ -0,0 +1,134 @@
+package recorder
+
+import (
+	"io"
+	"testing"
+
+	"github.com/garlicgarrison/go-recorder/keyword"
+	"github.com/garlicgarrison/go-recorder/stream"
+	"github.com/stretchr/testify/assert"
+)
+
+var _ Trigger = (*keyword.Spotter)(nil)
+
+// bufferTrigger fires on the buffers it was told to, counting from 0
+type bufferTrigger struct {
+	at     map[int]bool
+	buffer int
+	resets int
+}
+
+func (b *bufferTrigger) Process(samples []int32) bool {
+	fired := b.at[b.buffer]
+	b.buffer++
+	return fired
+}
+
+func (b *bufferTrigger) Reset() {
+	b.resets++
+}
+
+// speech has loud buffers over the given ranges, quiet ones elsewhere, 150
+// buffers in all
+func speech(ranges ...[2]int) []int32 {
+	samples := sine(1e6, 64*150)
+	for _, r := range ranges {
+		copy(samples[64*r[0]:], sine(1e9, 64*(r[1]-r[0])))
+	}
+	return samples
+}
+
+func recordTriggered(t *testing.T, cfg *RecorderConfig, samples []int32, at ...int) (*Recorder, []int32, error) {
+	trigger := &bufferTrigger{at: map[int]bool{}}
+	for _, buffer := range at {
+		trigger.at[buffer] = true
+	}
+
+	r, err := NewRecorder(cfg, &scriptSource{
+		clock:   stream.NewClock(cfg.SampleRate, cfg.InputChannels),
+		size:    cfg.FramesPerBuffer,
+		samples: samples,
+	})
+	assert.NoError(t, err)
+	r.SetStartTrigger(trigger)
+
+	recorded, err := r.RecordVAD(WAV)
+	assert.Equal(t, 1, trigger.resets)
+	if err != nil {
+		return r, nil, err
+	}
+	return r, decode(t, recorded), nil
+}
+
+func TestStartTrigger(t *testing.T) {
+	// the speech before the trigger is ignored, the speech after recorded
+	samples := speech([2]int{20, 40}, [2]int{70, 100})
+	r, recorded, err := recordTriggered(t, vadConfig(), samples, 60)
+	assert.NoError(t, err)
+
+	span := r.LastSpan()
+	assert.Equal(t, uint64(64*70), span.SpeechStartIndex)
+	assert.Equal(t, uint64(64*70-300), span.StartIndex)
+	assert.Equal(t, samples[span.StartIndex:span.EndIndex], recorded)
+}
+
+func TestStartTriggerPreRoll(t *testing.T) {
+	// the pre-roll does not reach back into the cue
+	samples := speech([2]int{20, 30}, [2]int{52, 80})
+	r, _, err := recordTriggered(t, vadConfig(), samples, 50)
+	assert.NoError(t, err)
+
+	span := r.LastSpan()
+	assert.Equal(t, uint64(64*52), span.SpeechStartIndex)
+	assert.Equal(t, uint64(64*51), span.StartIndex)
+}
+
+func TestStartTriggerRunOn(t *testing.T) {
+	// speech running on from the cue is recorded from where it fired
+	samples := speech([2]int{20, 80})
+	r, recorded, err := recordTriggered(t, vadConfig(), samples, 40)
+	assert.NoError(t, err)
+
+	span := r.LastSpan()
+	assert.Equal(t, uint64(64*41), span.SpeechStartIndex)
+	assert.Equal(t, uint64(64*41), span.StartIndex)
+	assert.Equal(t, uint64(64*81), span.SpeechEndIndex)
+	assert.Equal(t, samples[span.StartIndex:span.EndIndex], recorded)
+}
+
+func TestStartTriggerCueTail(t *testing.T) {
+	// the cue ends just after the trigger fires, then the speech follows
+	samples := speech([2]int{20, 40}, [2]int{60, 90})
+	r, recorded, err := recordTriggered(t, vadConfig(), samples, 38)
+	assert.NoError(t, err)
+
+	span := r.LastSpan()
+	assert.Equal(t, uint64(64*60), span.SpeechStartIndex)
+	assert.Equal(t, uint64(64*60-300), span.StartIndex)
+	assert.Equal(t, samples[span.StartIndex:span.EndIndex], recorded)
+}
+
+func TestStartTriggerCueTailPreRoll(t *testing.T) {
+	// the trigger fires before the VAD hears the cue, so the cue is
+	// recorded and abandoned after its speech started; the speech after
+	// it still comes from the right place in the stream
+	samples := speech([2]int{20, 26}, [2]int{60, 90})
+	r, recorded, err := recordTriggered(t, vadConfig(), samples, 22)
+	assert.NoError(t, err)
+
+	span := r.LastSpan()
+	assert.Equal(t, uint64(64*60), span.SpeechStartIndex)
+	assert.Equal(t, samples[span.StartIndex:span.EndIndex], recorded)
+}
+
+func TestStartTriggerTimeout(t *testing.T) {
+	samples := speech([2]int{60, 90})
+	cfg := vadConfig()
+	cfg.TriggerTimeout = 1000
+	_, _, err := recordTriggered(t, cfg, samples, 20)
+	assert.ErrorIs(t, err, io.EOF)
+
+	cfg.TriggerTimeout = -1
+	_, err = NewRecorder(cfg, nil)
+	assert.ErrorIs(t, err, ErrInvalidRecorderConfig)
+}
@@ -0,0 +1,215 @@
+package recorder
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"testing"
+
+	"github.com/garlicgarrison/go-recorder/codec"
+	"github.com/garlicgarrison/go-recorder/ingest"
+	"github.com/garlicgarrison/go-recorder/stream"
+	"github.com/garlicgarrison/go-recorder/vad"
+	"github.com/stretchr/testify/assert"
+)
+
+// scriptSource plays back samples in buffers of size, then reports EOF
+type scriptSource struct {
+	clock   *stream.Clock
+	size    int
+	samples []int32
+}
+
+func (s *scriptSource) Start() error { return nil }
+func (s *scriptSource) Close() error { return nil }
+
+func (s *scriptSource) Read(ctx context.Context) (*stream.Buffer, error) {
+	if len(s.samples) < s.size {
+		return nil, io.EOF
+	}
+
+	samples := s.samples[:s.size]
+	s.samples = s.samples[s.size:]
+	return s.clock.Stamp(samples), nil
+}
+
+// sine fills n samples with a sine of the given amplitude
+func sine(amplitude float64, n int) []int32 {
+	samples := make([]int32, n)
+	for i := range samples {
+		samples[i] = int32(amplitude * math.Sin(float64(i)/3))
+	}
+	return samples
+}
+
+func vadConfig() *RecorderConfig {
+	cfg := DefaultRecorderConfig()
+	cfg.SampleRate = 1000
+	cfg.VADConfig.SampleRate = 1000
+	return cfg
+}
+
+func recordVAD(t *testing.T, cfg *RecorderConfig, samples []int32) (*Recorder, []int32) {
+	src := &scriptSource{
+		clock:   stream.NewClock(cfg.SampleRate, cfg.InputChannels),
+		size:    cfg.FramesPerBuffer,
+		samples: samples,
+	}
+
+	r, err := NewRecorder(cfg, src)
+	assert.NoError(t, err)
+
+	b, err := r.RecordVAD(WAV)
+	assert.NoError(t, err)
+	return r, decode(t, b)
+}
+
+func decode(t *testing.T, b *bytes.Buffer) []int32 {
+	wav := &codec.WAVFile{}
+	assert.NoError(t, wav.DecodeWAV(b))
+	return wav.Data
+}
+
+func TestRecordVADPadding(t *testing.T) {
+	// 50 quiet buffers, 30 loud, 30 quiet. Smoothing places the end of
+	// the speech a buffer late, at 81.
+	samples := sine(1e6, 64*50)
+	samples = append(samples, sine(1e9, 64*30)...)
+	samples = append(samples, sine(1e6, 64*30)...)
+
+	cfg := vadConfig()
+	r, recorded := recordVAD(t, cfg, samples)
+
+	span := r.LastSpan()
+	assert.Equal(t, uint64(64*50), span.SpeechStartIndex)
+	assert.Equal(t, uint64(64*81), span.SpeechEndIndex)
+	assert.Equal(t, uint64(64*50-300), span.StartIndex)
+	assert.Equal(t, uint64(64*81+300), span.EndIndex)
+	assert.Equal(t, samples[span.StartIndex:span.EndIndex], recorded)
+
+	// without padding the recording is the speech alone
+	cfg.PreRollTime = 0
+	cfg.PostRollTime = 0
+	r, recorded = recordVAD(t, cfg, samples)
+	span = r.LastSpan()
+	assert.Equal(t, uint64(64*50), span.StartIndex)
+	assert.Equal(t, uint64(64*81), span.EndIndex)
+	assert.Equal(t, samples[64*50:64*81], recorded)
+}
+
+// closingSource is a scriptSource whose client disconnects at the end
+type closingSource struct {
+	*scriptSource
+}
+
+func (s closingSource) Read(ctx context.Context) (*stream.Buffer, error) {
+	buffer, err := s.scriptSource.Read(ctx)
+	if errors.Is(err, io.EOF) {
+		return nil, ingest.ErrSessionClosed
+	}
+	return buffer, err
+}
+
+func TestRecordVADEndOfStream(t *testing.T) {
+	// 16 quiet buffers, then speech until the input runs out
+	samples := sine(1e6, 64*16)
+	samples = append(samples, sine(1e9, 64*30)...)
+
+	cfg := vadConfig()
+	pcm := make([]byte, 4*len(samples))
+	for i, s := range samples {
+		binary.LittleEndian.PutUint32(pcm[4*i:], uint32(s))
+	}
+	file, err := stream.NewPCMSource(bytes.NewReader(pcm), &stream.PCMConfig{
+		Format:          stream.S32LE,
+		SampleRate:      cfg.SampleRate,
+		InputChannels:   cfg.InputChannels,
+		FramesPerBuffer: cfg.FramesPerBuffer,
+	})
+	assert.NoError(t, err)
+
+	session := closingSource{&scriptSource{
+		clock:   stream.NewClock(cfg.SampleRate, cfg.InputChannels),
+		size:    cfg.FramesPerBuffer,
+		samples: samples,
+	}}
+
+	for _, src := range []stream.Source{file, session} {
+		r, err := NewRecorder(cfg, src)
+		assert.NoError(t, err)
+
+		b, err := r.RecordVAD(WAV)
+		assert.NoError(t, err)
+		if err != nil {
+			continue
+		}
+
+		span := r.LastSpan()
+		assert.Equal(t, uint64(64*16), span.SpeechStartIndex)
+		assert.Equal(t, uint64(len(samples)), span.SpeechEndIndex)
+		assert.Equal(t, uint64(len(samples)), span.EndIndex)
+		assert.Equal(t, samples[span.StartIndex:], decode(t, b))
+	}
+}
+
+func TestRecordVADEarlySpeech(t *testing.T) {
+	// the pre-roll cannot reach back past what was read
+	samples := sine(1e6, 64*10)
+	samples = append(samples, sine(1e9, 64*30)...)
+	samples = append(samples, sine(1e6, 64*30)...)
+
+	cfg := vadConfig()
+	cfg.PreRollTime = 5000
+	r, recorded := recordVAD(t, cfg, samples)
+
+	span := r.LastSpan()
+	assert.Equal(t, uint64(64*10), span.SpeechStartIndex)
+	assert.Equal(t, uint64(0), span.StartIndex)
+	assert.Equal(t, samples[:span.EndIndex], recorded)
+}
+
+func TestRecordVADDetector(t *testing.T) {
+	samples := sine(1e6, 64*20)
+	samples = append(samples, sine(1e9, 64*30)...)
+	samples = append(samples, sine(1e6, 64*30)...)
+
+	// the detector replaces the configured method
+	cfg := vadConfig()
+	cfg.VADConfig.Method = "neural"
+	_, err := NewRecorder(cfg, nil)
+	assert.Error(t, err)
+	cfg.VADConfig.Method = ""
+
+	frames := 0
+	src := &scriptSource{
+		clock:   stream.NewClock(cfg.SampleRate, cfg.InputChannels),
+		size:    cfg.FramesPerBuffer,
+		samples: samples,
+	}
+	r, err := NewRecorderWithDetector(cfg, src, vad.DetectorFunc(func(frame []int32) float64 {
+		frames++
+		for _, s := range frame {
+			if s > 1e8 {
+				return 1
+			}
+		}
+		return 0
+	}))
+	assert.NoError(t, err)
+
+	_, err = r.RecordVAD(WAV)
+	assert.NoError(t, err)
+	assert.Greater(t, frames, 0)
+	assert.Equal(t, uint64(64*20), r.LastSpan().SpeechStartIndex)
+	assert.Equal(t, uint64(64*51), r.LastSpan().SpeechEndIndex)
+}
+
+func TestRecorderConfigPadding(t *testing.T) {
+	cfg := DefaultRecorderConfig()
+	cfg.PostRollTime = -1
+	_, err := NewRecorder(cfg, nil)
+	assert.ErrorIs(t, err, ErrInvalidRecorderConfig)
+}
@@ -0,0 +1,195 @@
+package resample
+
+import (
+	"errors"
+	"math"
+)
+
+// Quality trades CPU for fidelity
+type Quality string
+
+const (
+	// Linear interpolates between neighbouring frames. It is cheap but
+	// aliases when downsampling.
+	Linear Quality = "linear"
+
+	// Sinc is a Blackman-windowed sinc filter of SincTaps taps, low-passed
+	// below the lower of the two rates. It adds SincTaps/2 frames of delay.
+	Sinc Quality = "sinc"
+
+	SincTaps = 32
+)
+
+var (
+	ErrInvalidRatio    = errors.New("ratio must be positive")
+	ErrInvalidChannels = errors.New("channels must be positive")
+	ErrUnknownQuality  = errors.New("unknown resampler quality")
+)
+
+// Resampler converts interleaved samples by a ratio of output frames to
+// input frames. It keeps its position between calls so a stream can be fed
+// buffer by buffer, and the ratio can be changed at any time to follow a
+// drifting clock.
+type Resampler struct {
+	channels int
+	ratio    float64
+	quality  Quality
+
+	// position of the next output frame, in input frames relative to the
+	// start of the next buffer; negative positions fall in prev, the tail
+	// of the previous buffer
+	pos  float64
+	prev []int32
+
+	// sinc only: prev followed by the current buffer
+	work []int32
+}
+
+// New returns a Linear resampler
+func New(channels int, ratio float64) (*Resampler, error) {
+	return NewWithQuality(channels, ratio, Linear)
+}
+
+func NewWithQuality(channels int, ratio float64, quality Quality) (*Resampler, error) {
+	if channels <= 0 {
+		return nil, ErrInvalidChannels
+	}
+	if ratio <= 0 {
+		return nil, ErrInvalidRatio
+	}
+
+	history := 1
+	switch quality {
+	case Linear:
+	case Sinc:
+		history = SincTaps
+	default:
+		return nil, ErrUnknownQuality
+	}
+
+	return &Resampler{
+		channels: channels,
+		ratio:    ratio,
+		quality:  quality,
+		prev:     make([]int32, history*channels),
+	}, nil
+}
+
+func (r *Resampler) Quality() Quality {
+	return r.quality
+}
+
+func (r *Resampler) Ratio() float64 {
+	return r.ratio
+}
+
+func (r *Resampler) SetRatio(ratio float64) error {
+	if ratio <= 0 {
+		return ErrInvalidRatio
+	}
+
+	r.ratio = ratio
+	return nil
+}
+
+// Process appends the resampled frames of in to out and returns it
+func (r *Resampler) Process(in []int32, out []int32) []int32 {
+	if r.quality == Sinc {
+		return r.processSinc(in, out)
+	}
+
+	frames := len(in) / r.channels
+	if frames == 0 {
+		return out
+	}
+
+	step := 1 / r.ratio
+	for r.pos < float64(frames-1) {
+		i := int(math.Floor(r.pos))
+		frac := r.pos - float64(i)
+		for c := 0; c < r.channels; c++ {
+			var a int32
+			if i < 0 {
+				a = r.prev[c]
+			} else {
+				a = in[i*r.channels+c]
+			}
+			b := in[(i+1)*r.channels+c]
+			out = append(out, int32(float64(a)+frac*(float64(b)-float64(a))))
+		}
+		r.pos += step
+	}
+
+	r.pos -= float64(frames)
+	copy(r.prev, in[(frames-1)*r.channels:frames*r.channels])
+
+	return out
+}
+
+func (r *Resampler) processSinc(in []int32, out []int32) []int32 {
+	frames := len(in) / r.channels
+	if frames == 0 {
+		return out
+	}
+
+	// frame i of in is frame i+history of work
+	history := len(r.prev) / r.channels
+	r.work = append(append(r.work[:0], r.prev...), in[:frames*r.channels]...)
+
+	half := SincTaps / 2
+	cutoff := math.Min(1, r.ratio)
+	step := 1 / r.ratio
+	for r.pos+float64(half) < float64(frames) {
+		center := int(math.Floor(r.pos))
+		frac := r.pos - float64(center)
+
+		for c := 0; c < r.channels; c++ {
+			acc := 0.0
+			for k := -half + 1; k <= half; k++ {
+				x := float64(r.work[(center+k+history)*r.channels+c])
+				acc += x * kernel(float64(k)-frac, cutoff, half)
+			}
+			out = append(out, clamp(acc))
+		}
+		r.pos += step
+	}
+
+	r.pos -= float64(frames)
+	copy(r.prev, r.work[len(r.work)-len(r.prev):])
+
+	return out
+}
+
+// kernel is a windowed sinc low-pass at cutoff, as a fraction of Nyquist
+func kernel(t, cutoff float64, half int) float64 {
+	if math.Abs(t) >= float64(half) {
+		return 0
+	}
+
+	sinc := 1.0
+	if x := math.Pi * cutoff * t; x != 0 {
+		sinc = math.Sin(x) / x
+	}
+
+	phase := math.Pi * t / float64(half)
+	window := 0.42 + 0.5*math.Cos(phase) + 0.08*math.Cos(2*phase)
+
+	return cutoff * sinc * window
+}
+
+func clamp(v float64) int32 {
+	if v >= math.MaxInt32 {
+		return math.MaxInt32
+	} else if v <= math.MinInt32 {
+		return math.MinInt32
+	}
+	return int32(math.Round(v))
+}
+
+// Reset forgets the previous buffer, for use after a discontinuity
+func (r *Resampler) Reset() {
+	r.pos = 0
+	for i := range r.prev {
+		r.prev[i] = 0
+	}
+}
@@ -0,0 +1,95 @@
+package resample
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func sine(freq, rate float64, frames, channels int) []int32 {
+	data := make([]int32, frames*channels)
+	for i := 0; i < frames; i++ {
+		v := int32(1e9 * math.Sin(2*math.Pi*freq*float64(i)/rate))
+		for c := 0; c < channels; c++ {
+			data[i*channels+c] = v
+		}
+	}
+	return data
+}
+
+func TestResampleLength(t *testing.T) {
+	for _, ratio := range []float64{0.5, 1, 1.0001, 2, 44100.0 / 22050.0, 16000.0 / 44100.0} {
+		r, err := New(2, ratio)
+		assert.NoError(t, err)
+
+		in := sine(440, 22050, 22016, 2)
+		out := []int32{}
+		for i := 0; i < len(in); i += 128 {
+			out = r.Process(in[i:i+128], out)
+		}
+
+		expected := 22016 * ratio
+		assert.InDelta(t, expected, float64(len(out)/2), 2, "ratio %f", ratio)
+	}
+}
+
+func TestResampleContinuity(t *testing.T) {
+	r, err := New(1, 16000.0/22050.0)
+	assert.NoError(t, err)
+
+	in := sine(200, 22050, 22016, 1)
+	out := []int32{}
+	for i := 0; i < len(in); i += 64 {
+		out = r.Process(in[i:i+64], out)
+	}
+
+	expected := sine(200, 16000, len(out), 1)
+	for i := range out {
+		assert.InDelta(t, float64(expected[i]), float64(out[i]), 2e6, "frame %d", i)
+	}
+}
+
+func TestResampleSinc(t *testing.T) {
+	r, err := NewWithQuality(1, 16000.0/22050.0, Sinc)
+	assert.NoError(t, err)
+	assert.Equal(t, Sinc, r.Quality())
+
+	in := sine(200, 22050, 22016, 1)
+	out := []int32{}
+	for i := 0; i < len(in); i += 64 {
+		out = r.Process(in[i:i+64], out)
+	}
+
+	// the filter holds back SincTaps/2 frames of input
+	assert.InDelta(t, 22016*16000.0/22050.0, float64(len(out)), SincTaps)
+
+	expected := sine(200, 16000, len(out), 1)
+	for i := SincTaps; i < len(out); i++ {
+		assert.InDelta(t, float64(expected[i]), float64(out[i]), 1e7, "frame %d", i)
+	}
+}
+
+func TestResampleSincAntiAlias(t *testing.T) {
+	// 12kHz is above the 8kHz Nyquist of the output; linear folds it back,
+	// sinc filters it out
+	peak := func(quality Quality) float64 {
+		r, err := NewWithQuality(1, 16000.0/44100.0, quality)
+		assert.NoError(t, err)
+
+		out := r.Process(sine(12000, 44100, 44100, 1), nil)
+		max := 0.0
+		for _, v := range out[SincTaps:] {
+			max = math.Max(max, math.Abs(float64(v)))
+		}
+		return max
+	}
+
+	assert.Greater(t, peak(Linear), 5e8)
+	assert.Less(t, peak(Sinc), 5e7)
+}
+
+func TestResampleQuality(t *testing.T) {
+	_, err := NewWithQuality(1, 1, Quality("cubic"))
+	assert.ErrorIs(t, err, ErrUnknownQuality)
+}
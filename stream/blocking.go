@@ -0,0 +1,68 @@
+package stream
+
+import "context"
+
+// blockingReader runs blocking device reads on one long-lived goroutine so
+// a read can be given up on without costing a goroutine and channel each
+// time. A read given up on stays in flight, and the next read takes its
+// result rather than starting another.
+type blockingReader struct {
+	reads   chan func() error
+	results chan error
+
+	// the device the read in flight is from, nil if there is none. Only
+	// used by the single caller of read.
+	pending interface{}
+}
+
+func newBlockingReader() *blockingReader {
+	r := &blockingReader{
+		reads:   make(chan func() error),
+		results: make(chan error, 1),
+	}
+	go r.run()
+	return r
+}
+
+func (r *blockingReader) run() {
+	for read := range r.reads {
+		r.results <- read()
+	}
+}
+
+// close ends the goroutine once the read in flight, if any, is done
+func (r *blockingReader) close() {
+	close(r.reads)
+}
+
+// read returns once device's read fills its buffer, or with ctx's error
+// once ctx ends. A read still in flight from device counts as this one if
+// it succeeded. One that failed, or is from a device since replaced, is
+// discarded and a new read started.
+func (r *blockingReader) read(ctx context.Context, device interface{}, read func() error) error {
+	if r.pending == nil && ctx.Done() == nil {
+		return read()
+	}
+
+	if r.pending != nil {
+		select {
+		case err := <-r.results:
+			stale := r.pending != device
+			r.pending = nil
+			if err == nil && !stale {
+				return nil
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	r.reads <- read
+	select {
+	case err := <-r.results:
+		return err
+	case <-ctx.Done():
+		r.pending = device
+		return ctx.Err()
+	}
+}
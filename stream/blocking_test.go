@@ -0,0 +1,69 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// a read given up on is not lost: the next read returns what it captured
+func TestBlockingReaderCancel(t *testing.T) {
+	r := newBlockingReader()
+	defer r.close()
+
+	device := new(int)
+	captured := make(chan int32)
+	var buffer int32
+	read := func() error {
+		buffer = <-captured
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.ErrorIs(t, r.read(ctx, device, read), context.Canceled)
+
+	go func() { captured <- 1 }()
+	assert.NoError(t, r.read(context.Background(), device, read))
+	assert.Equal(t, int32(1), buffer)
+
+	// no read is left in flight, so the next one starts afresh
+	go func() { captured <- 2 }()
+	assert.NoError(t, r.read(context.Background(), device, read))
+	assert.Equal(t, int32(2), buffer)
+}
+
+// a read in flight that failed, or is from a replaced device, is discarded
+func TestBlockingReaderStale(t *testing.T) {
+	r := newBlockingReader()
+	defer r.close()
+
+	errAborted := errors.New("aborted")
+	reads := 0
+	finish := make(chan error)
+	read := func() error {
+		reads++
+		return <-finish
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	first, second := new(int), new(int)
+	assert.ErrorIs(t, r.read(ctx, first, read), context.Canceled)
+	go func() {
+		finish <- errAborted
+		finish <- nil
+	}()
+	assert.NoError(t, r.read(context.Background(), first, read))
+	assert.Equal(t, 2, reads)
+
+	assert.ErrorIs(t, r.read(ctx, first, read), context.Canceled)
+	go func() {
+		finish <- nil
+		finish <- nil
+	}()
+	assert.NoError(t, r.read(context.Background(), second, read))
+	assert.Equal(t, 4, reads)
+}
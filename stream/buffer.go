@@ -0,0 +1,155 @@
+package stream
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Buffer is one read's worth of interleaved samples and when they were
+// captured.
+//
+// Buffers from a BufferPool are reference counted: whoever receives one from
+// Read owns a reference and should Release it once done with the samples,
+// so the pool can hand them out again. A buffer that is never released is
+// simply garbage collected, so forgetting is only a missed reuse.
+type Buffer struct {
+	Samples []int32
+	Frames  int
+
+	// frames the source produced before this buffer, counting any that were
+	// dropped, so a jump between consecutive buffers is a dropout
+	Index uint64
+
+	// PortAudio's ADC clock at the first frame, zero for sources without one
+	ADCTime time.Duration
+
+	// wall-clock time of the first frame
+	Time time.Time
+
+	refs int32
+	pool *BufferPool
+}
+
+// Retain adds a reference for another consumer, who must Release it too
+func (b *Buffer) Retain() *Buffer {
+	if b.pool != nil {
+		atomic.AddInt32(&b.refs, 1)
+	}
+	return b
+}
+
+// Release drops a reference. The samples must not be used afterwards.
+func (b *Buffer) Release() {
+	if b.pool == nil {
+		return
+	}
+	if atomic.AddInt32(&b.refs, -1) == 0 {
+		b.pool.pool.Put(b)
+	}
+}
+
+// BufferPool recycles buffers of a fixed number of samples
+type BufferPool struct {
+	size int
+	pool *sync.Pool
+}
+
+func NewBufferPool(samples int) *BufferPool {
+	p := &BufferPool{
+		size: samples,
+	}
+	p.pool = &sync.Pool{
+		New: func() interface{} {
+			return &Buffer{
+				Samples: make([]int32, samples),
+				pool:    p,
+			}
+		},
+	}
+
+	return p
+}
+
+// Get returns a buffer holding one reference. Its samples are not cleared.
+func (p *BufferPool) Get() *Buffer {
+	b := p.pool.Get().(*Buffer)
+	b.refs = 1
+	return b
+}
+
+// End is the index right after the buffer's last frame
+func (b *Buffer) End() uint64 {
+	return b.Index + uint64(b.Frames)
+}
+
+// rawSpan is where a buffer ended, kept after it is released
+type rawSpan struct {
+	end     uint64
+	adcEnd  time.Duration
+	timeEnd time.Time
+}
+
+// Gap returns how many frames are missing between prev and next
+func Gap(prev, next *Buffer) uint64 {
+	if prev == nil || next.Index <= prev.End() {
+		return 0
+	}
+	return next.Index - prev.End()
+}
+
+// Clock stamps buffers from sources without a hardware clock. The first
+// stamped frame is taken to be captured now, and every later one a sample
+// period after the last.
+type Clock struct {
+	sampleRate float64
+	channels   int
+	index      uint64
+	start      time.Time
+}
+
+func NewClock(sampleRate float64, channels int) *Clock {
+	return &Clock{
+		sampleRate: sampleRate,
+		channels:   channels,
+	}
+}
+
+// Stamp wraps samples in a Buffer and advances the clock past them
+func (c *Clock) Stamp(samples []int32) *Buffer {
+	b := &Buffer{
+		Samples: samples,
+	}
+	c.StampBuffer(b)
+
+	return b
+}
+
+// StampBuffer times a buffer that already holds its samples, such as one
+// from a BufferPool
+func (c *Clock) StampBuffer(b *Buffer) {
+	if c.start.IsZero() {
+		c.start = time.Now()
+	}
+
+	b.Frames = len(b.Samples) / c.channels
+	b.Index = c.index
+	b.ADCTime = 0
+	b.Time = c.start.Add(c.offset(c.index))
+	c.index += uint64(b.Frames)
+}
+
+// Skip advances the clock over frames that were lost
+func (c *Clock) Skip(frames uint64) {
+	c.index += frames
+}
+
+// Reset starts counting from zero at the next Stamp
+func (c *Clock) Reset() {
+	c.index = 0
+	c.start = time.Time{}
+}
+
+func (c *Clock) offset(frames uint64) time.Duration {
+	return time.Duration(float64(frames) / c.sampleRate * float64(time.Second))
+}
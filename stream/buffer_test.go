@@ -0,0 +1,76 @@
+package stream
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClockStamp(t *testing.T) {
+	c := NewClock(1000, 2)
+
+	first := c.Stamp(make([]int32, 20))
+	assert.Equal(t, uint64(0), first.Index)
+	assert.Equal(t, 10, first.Frames)
+
+	c.Skip(5)
+	second := c.Stamp(make([]int32, 20))
+	assert.Equal(t, uint64(15), second.Index)
+	assert.Equal(t, 15*time.Millisecond, second.Time.Sub(first.Time))
+	assert.Equal(t, uint64(5), Gap(first, second))
+	assert.Equal(t, uint64(0), Gap(nil, first))
+
+	c.Reset()
+	assert.Equal(t, uint64(0), c.Stamp(make([]int32, 2)).Index)
+}
+
+func TestBufferPoolRefs(t *testing.T) {
+	p := NewBufferPool(4)
+
+	b := p.Get()
+	assert.Len(t, b.Samples, 4)
+	b.Retain()
+	b.Release()
+	assert.Equal(t, int32(1), b.refs)
+	b.Release()
+	assert.Equal(t, int32(0), b.refs)
+
+	// buffers from outside a pool ignore reference counting
+	unpooled := &Buffer{}
+	unpooled.Retain().Release()
+}
+
+func BenchmarkPCMSourceRead(b *testing.B) {
+	cfg := DefaultPCMConfig()
+	raw := make([]byte, cfg.FramesPerBuffer*cfg.Format.Width())
+	s, err := NewPCMSource(&repeatReader{raw}, cfg)
+	if err != nil {
+		b.Fatal(err)
+	}
+	s.Start()
+
+	ctx := context.Background()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		buffer, err := s.Read(ctx)
+		if err != nil {
+			b.Fatal(err)
+		}
+		buffer.Release()
+	}
+}
+
+// repeatReader never runs out
+type repeatReader struct {
+	data []byte
+}
+
+func (r *repeatReader) Read(p []byte) (int, error) {
+	n := 0
+	for n < len(p) {
+		n += copy(p[n:], r.data)
+	}
+	return n, nil
+}
@@ -0,0 +1,368 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/garlicgarrison/go-recorder/resample"
+)
+
+const (
+	DefaultDriftWarmup = 2 * time.Second
+
+	// weight of each new drift measurement
+	DefaultDriftSmoothing = 0.01
+
+	// fraction of the fill-level difference, in seconds, corrected per second
+	DefaultAlignGain = 0.1
+
+	// the resampling ratio never moves further than this from nominal
+	MaxDriftCorrection = 0.005
+)
+
+var (
+	ErrEmptyGroup = errors.New("capture group has no members")
+)
+
+// GroupMember is one device in a capture group
+type GroupMember struct {
+	Name       string
+	Source     Source
+	SampleRate float64
+	Channels   int
+}
+
+type GroupConfig struct {
+	// frames per buffer returned by Read, at the reference rate
+	FramesPerBuffer int
+
+	// time spent measuring before drift correction kicks in
+	DriftWarmup time.Duration
+
+	DriftSmoothing float64
+	AlignGain      float64
+}
+
+// DriftEstimate is a member's clock measured against the reference
+type DriftEstimate struct {
+	Name string
+
+	NominalRate   float64
+	EstimatedRate float64 // in reference-clock samples per second
+	PPM           float64
+
+	// output frames per input frame currently applied
+	Ratio float64
+}
+
+func DefaultGroupConfig() *GroupConfig {
+	return &GroupConfig{
+		FramesPerBuffer: DefaultFramesPerBuffer,
+		DriftWarmup:     DefaultDriftWarmup,
+		DriftSmoothing:  DefaultDriftSmoothing,
+		AlignGain:       DefaultAlignGain,
+	}
+}
+
+// Group captures several sources together and aligns them to the first
+// member's clock. Every other member is resampled, and its ratio is steered
+// by its measured sample rate and by how far its queue has drifted from the
+// reference's.
+//
+// Read returns one interleaved buffer holding every member's channels in
+// member order; ReadMembers returns the aligned buffers separately.
+type Group struct {
+	cfg     *GroupConfig
+	members []*groupMember
+	clock   *Clock
+
+	mutex   *sync.Mutex
+	ready   *sync.Cond
+	now     func() time.Time // times the warmup, time.Now but in tests
+	started time.Time
+	aligned bool
+	err     error
+	cancel  context.CancelFunc
+	wg      *sync.WaitGroup
+}
+
+type groupMember struct {
+	GroupMember
+
+	resampler *resample.Resampler
+	received  int       // input frames
+	heard     time.Time // when the last buffer came in
+	drift     float64   // device speed relative to the reference, 1 is none
+	pending   []int32   // resampled to the reference rate
+}
+
+func NewGroup(cfg *GroupConfig, members ...GroupMember) (*Group, error) {
+	if len(members) == 0 {
+		return nil, ErrEmptyGroup
+	}
+	if cfg == nil {
+		cfg = DefaultGroupConfig()
+	}
+
+	g := &Group{
+		cfg:   cfg,
+		mutex: &sync.Mutex{},
+		now:   time.Now,
+		wg:    &sync.WaitGroup{},
+	}
+	g.ready = sync.NewCond(g.mutex)
+
+	reference := members[0].SampleRate
+	for _, m := range members {
+		r, err := resample.New(m.Channels, reference/m.SampleRate)
+		if err != nil {
+			return nil, err
+		}
+
+		g.members = append(g.members, &groupMember{
+			GroupMember: m,
+			resampler:   r,
+			drift:       1,
+		})
+	}
+
+	return g, nil
+}
+
+// Start starts every member back to back, then begins reading them
+func (g *Group) Start() error {
+	for i, m := range g.members {
+		err := m.Source.Start()
+		if err != nil {
+			for _, started := range g.members[:i] {
+				started.Source.Close()
+			}
+			return err
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	channels := 0
+	for _, m := range g.members {
+		channels += m.Channels
+	}
+
+	g.mutex.Lock()
+	g.clock = NewClock(g.members[0].SampleRate, channels)
+	g.started = g.now()
+	g.aligned = false
+	g.err = nil
+	g.cancel = cancel
+	for _, m := range g.members {
+		m.received = 0
+		m.drift = 1
+		m.pending = m.pending[:0]
+		m.resampler.Reset()
+	}
+	g.mutex.Unlock()
+
+	for _, m := range g.members {
+		g.wg.Add(1)
+		go g.capture(ctx, m)
+	}
+
+	return nil
+}
+
+func (g *Group) Close() error {
+	g.mutex.Lock()
+	cancel := g.cancel
+	g.mutex.Unlock()
+	if cancel != nil {
+		cancel()
+	}
+	g.wg.Wait()
+
+	var err error
+	for _, m := range g.members {
+		if closeErr := m.Source.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}
+
+	return err
+}
+
+func (g *Group) capture(ctx context.Context, m *groupMember) {
+	defer g.wg.Done()
+
+	for {
+		buffer, err := m.Source.Read(ctx)
+		if err != nil {
+			g.fail(err)
+			return
+		}
+		g.receive(m, buffer)
+	}
+}
+
+// receive queues a member's buffer resampled to the reference rate
+func (g *Group) receive(m *groupMember, buffer *Buffer) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	m.received += buffer.Frames
+	m.heard = g.now()
+	m.pending = m.resampler.Process(buffer.Samples, m.pending)
+	buffer.Release()
+	g.steer(m)
+	g.ready.Broadcast()
+}
+
+// steer updates a member's resampling ratio. Called with the lock held.
+func (g *Group) steer(m *groupMember) {
+	reference := g.members[0]
+	if m == reference || g.now().Sub(g.started) < g.cfg.DriftWarmup || reference.received == 0 {
+		return
+	}
+
+	// how fast the member runs against the reference, in nominal terms
+	measured := (float64(m.received) / m.SampleRate) / (float64(reference.received) / reference.SampleRate)
+	m.drift += g.cfg.DriftSmoothing * (measured - m.drift)
+
+	// seconds the member has queued beyond the reference. The reference has
+	// recorded more since its last buffer came in, so that is counted too.
+	queued := float64(len(reference.pending)/reference.Channels) + m.heard.Sub(reference.heard).Seconds()*reference.SampleRate
+	offset := (float64(len(m.pending)/m.Channels) - queued) / reference.SampleRate
+
+	correction := 1/m.drift - 1 - g.cfg.AlignGain*offset
+	if correction > MaxDriftCorrection {
+		correction = MaxDriftCorrection
+	} else if correction < -MaxDriftCorrection {
+		correction = -MaxDriftCorrection
+	}
+
+	m.resampler.SetRatio(reference.SampleRate / m.SampleRate * (1 + correction))
+}
+
+func (g *Group) fail(err error) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	if g.err == nil {
+		g.err = err
+	}
+	g.ready.Broadcast()
+}
+
+// Drift reports each member's clock against the reference
+func (g *Group) Drift() []DriftEstimate {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	estimates := make([]DriftEstimate, len(g.members))
+	for i, m := range g.members {
+		estimates[i] = DriftEstimate{
+			Name:          m.Name,
+			NominalRate:   m.SampleRate,
+			EstimatedRate: m.SampleRate * m.drift,
+			PPM:           (m.drift - 1) * 1e6,
+			Ratio:         m.resampler.Ratio(),
+		}
+	}
+
+	return estimates
+}
+
+// ReadMembers waits for the next aligned buffer from every member
+func (g *Group) ReadMembers(ctx context.Context) ([][]int32, error) {
+	frames := g.cfg.FramesPerBuffer
+
+	// wake the wait below if ctx ends first
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			g.mutex.Lock()
+			g.ready.Broadcast()
+			g.mutex.Unlock()
+		case <-done:
+		}
+	}()
+
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	for !g.filled(frames) {
+		if g.err != nil {
+			return nil, g.err
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		g.ready.Wait()
+	}
+
+	// members started at slightly different times, so the first read drops
+	// the head start of everyone ahead of the slowest
+	if !g.aligned {
+		shortest := -1
+		for _, m := range g.members {
+			queued := len(m.pending) / m.Channels
+			if shortest < 0 || queued < shortest {
+				shortest = queued
+			}
+		}
+		for _, m := range g.members {
+			extra := len(m.pending) - shortest*m.Channels
+			m.pending = append(m.pending[:0], m.pending[extra:]...)
+		}
+		g.aligned = true
+	}
+
+	buffers := make([][]int32, len(g.members))
+	for i, m := range g.members {
+		n := frames * m.Channels
+		buffers[i] = make([]int32, n)
+		copy(buffers[i], m.pending[:n])
+		m.pending = append(m.pending[:0], m.pending[n:]...)
+	}
+
+	return buffers, nil
+}
+
+func (g *Group) filled(frames int) bool {
+	for _, m := range g.members {
+		if len(m.pending) < frames*m.Channels {
+			return false
+		}
+	}
+	return true
+}
+
+// Read returns every member's channels interleaved frame by frame, stamped
+// on the reference clock
+func (g *Group) Read(ctx context.Context) (*Buffer, error) {
+	buffers, err := g.ReadMembers(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	channels := 0
+	for _, m := range g.members {
+		channels += m.Channels
+	}
+
+	frames := g.cfg.FramesPerBuffer
+	toRet := make([]int32, frames*channels)
+	offset := 0
+	for i, m := range g.members {
+		for f := 0; f < frames; f++ {
+			copy(toRet[f*channels+offset:], buffers[i][f*m.Channels:(f+1)*m.Channels])
+		}
+		offset += m.Channels
+	}
+
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	return g.clock.Stamp(toRet), nil
+}
@@ -0,0 +1,132 @@
+package stream
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGroupInterleave(t *testing.T) {
+	a := &testSource{max: 9, release: make(chan struct{})}
+	b := &testSource{max: 7, release: make(chan struct{})}
+
+	cfg := DefaultGroupConfig()
+	cfg.FramesPerBuffer = 4
+	g, err := NewGroup(cfg,
+		GroupMember{Name: "a", Source: a, SampleRate: 16000, Channels: 1},
+		GroupMember{Name: "b", Source: b, SampleRate: 16000, Channels: 1},
+	)
+	assert.NoError(t, err)
+	assert.NoError(t, g.Start())
+
+	// a gets a head start of two buffers, which alignment drops. The last
+	// release of each ends the source, which also means the buffer before
+	// it has been queued.
+	for i := 0; i < 2; i++ {
+		a.release <- struct{}{}
+	}
+	for i := 0; i < 8; i++ {
+		a.release <- struct{}{}
+		b.release <- struct{}{}
+	}
+
+	buffer, err := g.Read(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, buffer.Samples, 8)
+	assert.Equal(t, 4, buffer.Frames)
+	for f := 0; f < 4; f++ {
+		assert.Equal(t, buffer.Samples[2*f]-2, buffer.Samples[2*f+1], "frame %d", f)
+	}
+
+	estimates := g.Drift()
+	assert.Len(t, estimates, 2)
+	assert.Equal(t, 1.0, estimates[1].Ratio)
+
+	assert.NoError(t, g.Close())
+}
+
+func TestGroupReadCancel(t *testing.T) {
+	g, err := NewGroup(nil, GroupMember{Source: &testSource{release: make(chan struct{})}, SampleRate: 16000, Channels: 1})
+	assert.NoError(t, err)
+	assert.NoError(t, g.Start())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = g.Read(ctx)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.NoError(t, g.Close())
+}
+
+// b's crystal runs 500 ppm fast. Buffers are fed straight to receive in the
+// order the devices would finish them, on a clock that follows the audio.
+func TestGroupDrift(t *testing.T) {
+	const (
+		rate   = 16000.0
+		ppm    = 500.0
+		frames = 16
+	)
+	signal := func(seconds float64) int32 {
+		return int32(1e8 * math.Sin(2*math.Pi*3*seconds))
+	}
+
+	cfg := DefaultGroupConfig()
+	cfg.FramesPerBuffer = 160
+	g, err := NewGroup(cfg,
+		GroupMember{Name: "a", Source: &testSource{release: make(chan struct{})}, SampleRate: rate, Channels: 1},
+		GroupMember{Name: "b", Source: &testSource{release: make(chan struct{})}, SampleRate: rate, Channels: 1},
+	)
+	assert.NoError(t, err)
+
+	start := time.Unix(1000, 0)
+	now := start
+	g.now = func() time.Time { return now }
+	assert.NoError(t, g.Start())
+	defer g.Close()
+
+	rates := []float64{rate, rate * (1 + ppm/1e6)}
+	sent := []int{0, 0}
+	var aligned [][]int32
+	for now.Sub(start) < time.Minute {
+		// the member whose next buffer is done first
+		m := 0
+		if float64(sent[1]+frames)/rates[1] < float64(sent[0]+frames)/rates[0] {
+			m = 1
+		}
+		samples := make([]int32, frames)
+		for i := range samples {
+			samples[i] = signal(float64(sent[m]+i) / rates[m])
+		}
+		sent[m] += frames
+		now = start.Add(time.Duration(float64(sent[m]) / rates[m] * float64(time.Second)))
+		g.receive(g.members[m], &Buffer{Samples: samples, Frames: frames})
+
+		g.mutex.Lock()
+		filled := g.filled(cfg.FramesPerBuffer)
+		g.mutex.Unlock()
+		if filled {
+			aligned, err = g.ReadMembers(context.Background())
+			assert.NoError(t, err)
+		}
+	}
+
+	estimates := g.Drift()
+	assert.InDelta(t, ppm, estimates[1].PPM, 20)
+	assert.InDelta(t, rates[1]/rate, estimates[1].EstimatedRate/rate, 20e-6)
+	assert.InDelta(t, rate/rates[1], estimates[1].Ratio, 20e-6)
+	assert.Equal(t, 1.0, estimates[0].Ratio)
+
+	// a minute in, uncorrected b would be 480 frames ahead. What is left is
+	// the estimate's error over AlignGain, under two frames here. Least
+	// squares gives the lag of b behind a in frames.
+	var num, den float64
+	a, b := aligned[0], aligned[1]
+	for i := 1; i < len(a)-1; i++ {
+		slope := float64(a[i+1]-a[i-1]) / 2
+		num += float64(a[i]-b[i]) * slope
+		den += slope * slope
+	}
+	assert.InDelta(t, 0, num/den, 3)
+}
@@ -0,0 +1,245 @@
+package stream
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"os"
+	"strings"
+	"sync"
+)
+
+// SampleFormat is the layout of one raw PCM sample
+type SampleFormat string
+
+const (
+	U8    SampleFormat = "u8"
+	S16LE SampleFormat = "s16le"
+	S16BE SampleFormat = "s16be"
+	S24LE SampleFormat = "s24le" // packed, 3 bytes per sample
+	S32LE SampleFormat = "s32le"
+	S32BE SampleFormat = "s32be"
+	F32LE SampleFormat = "f32le"
+)
+
+var (
+	ErrInvalidPCMConfig   = errors.New("invalid pcm config")
+	ErrUnknownFormat      = errors.New("unknown sample format")
+	ErrPCMSourceClosed    = errors.New("pcm source closed")
+	ErrPCMSourceNotActive = errors.New("pcm source not started")
+)
+
+// ParseSampleFormat accepts the project names as well as the spellings used
+// by arecord (S16_LE) and ffmpeg (s16le, f32le)
+func ParseSampleFormat(name string) (SampleFormat, error) {
+	name = strings.ToLower(strings.ReplaceAll(name, "_", ""))
+	switch SampleFormat(name) {
+	case U8, S16LE, S16BE, S24LE, S32LE, S32BE, F32LE:
+		return SampleFormat(name), nil
+	case "s243le":
+		return S24LE, nil
+	case "float32le", "floatle":
+		return F32LE, nil
+	}
+
+	return "", ErrUnknownFormat
+}
+
+// Width is the number of bytes in one sample
+func (f SampleFormat) Width() int {
+	switch f {
+	case U8:
+		return 1
+	case S16LE, S16BE:
+		return 2
+	case S24LE:
+		return 3
+	case S32LE, S32BE, F32LE:
+		return 4
+	}
+
+	return 0
+}
+
+// Decode converts one sample to a full-scale int32 like PortAudio returns
+func (f SampleFormat) Decode(b []byte) int32 {
+	switch f {
+	case U8:
+		return (int32(b[0]) - 128) << 24
+	case S16LE:
+		return int32(int16(binary.LittleEndian.Uint16(b))) << 16
+	case S16BE:
+		return int32(int16(binary.BigEndian.Uint16(b))) << 16
+	case S24LE:
+		return int32(uint32(b[0])<<8 | uint32(b[1])<<16 | uint32(b[2])<<24)
+	case S32LE:
+		return int32(binary.LittleEndian.Uint32(b))
+	case S32BE:
+		return int32(binary.BigEndian.Uint32(b))
+	case F32LE:
+		v := float64(math.Float32frombits(binary.LittleEndian.Uint32(b)))
+		if v >= 1 {
+			return math.MaxInt32
+		} else if v <= -1 {
+			return math.MinInt32
+		}
+		return int32(v * math.MaxInt32)
+	}
+
+	return 0
+}
+
+type PCMConfig struct {
+	Format          SampleFormat
+	SampleRate      float64
+	InputChannels   int
+	FramesPerBuffer int
+}
+
+func DefaultPCMConfig() *PCMConfig {
+	return &PCMConfig{
+		Format:          S16LE,
+		SampleRate:      DefaultSampleRate,
+		InputChannels:   DefaultInputChannels,
+		FramesPerBuffer: DefaultFramesPerBuffer,
+	}
+}
+
+// PCMSource reads raw interleaved PCM from any io.Reader, such as stdin, a
+// named pipe or a TCP connection, and returns fixed-size int32 buffers. The
+// last buffer is padded with silence and followed by io.EOF.
+//
+// Buffers are stamped as if the first one was captured when it was read
+// and the rest followed at the declared rate.
+type PCMSource struct {
+	cfg *PCMConfig
+	r   io.Reader
+
+	// only set when the source opened the reader itself
+	closer io.Closer
+
+	mutex   *sync.Mutex
+	started bool
+	closed  bool
+	raw     []byte
+	clock   *Clock
+	pool    *BufferPool
+}
+
+func NewPCMSource(r io.Reader, cfg *PCMConfig) (*PCMSource, error) {
+	if cfg == nil {
+		cfg = DefaultPCMConfig()
+	}
+	if cfg.Format.Width() == 0 {
+		return nil, ErrUnknownFormat
+	}
+	if cfg.InputChannels <= 0 || cfg.FramesPerBuffer <= 0 || cfg.SampleRate <= 0 {
+		return nil, ErrInvalidPCMConfig
+	}
+
+	return &PCMSource{
+		cfg:   cfg,
+		r:     r,
+		mutex: &sync.Mutex{},
+		raw:   make([]byte, cfg.FramesPerBuffer*cfg.InputChannels*cfg.Format.Width()),
+		clock: NewClock(cfg.SampleRate, cfg.InputChannels),
+		pool:  NewBufferPool(cfg.FramesPerBuffer * cfg.InputChannels),
+	}, nil
+}
+
+// OpenPCM reads from a file or named pipe, or stdin when path is "-". The
+// file is closed with the source.
+func OpenPCM(path string, cfg *PCMConfig) (*PCMSource, error) {
+	if path == "-" {
+		return NewPCMSource(os.Stdin, cfg)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	s, err := NewPCMSource(f, cfg)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	s.closer = f
+
+	return s, nil
+}
+
+func (s *PCMSource) Config() *PCMConfig {
+	return s.cfg
+}
+
+func (s *PCMSource) Start() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.closed && s.closer != nil {
+		return ErrPCMSourceClosed
+	}
+
+	s.started = true
+	s.closed = false
+	return nil
+}
+
+// Close stops the source. A reader passed to NewPCMSource stays open and
+// the source can be started again; one opened by OpenPCM is closed.
+func (s *PCMSource) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.started = false
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+
+	if s.closer != nil {
+		return s.closer.Close()
+	}
+	return nil
+}
+
+// Read cannot interrupt a blocked io.Reader, so cancelling ctx only takes
+// effect once the pending read returns
+func (s *PCMSource) Read(ctx context.Context) (*Buffer, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if !s.started {
+		return nil, ErrPCMSourceNotActive
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	n, err := io.ReadFull(s.r, s.raw)
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		// pad the final partial buffer, the next read returns io.EOF
+		for i := n; i < len(s.raw); i++ {
+			s.raw[i] = 0
+		}
+		if s.cfg.Format == U8 {
+			for i := n; i < len(s.raw); i++ {
+				s.raw[i] = 128
+			}
+		}
+	} else if err != nil {
+		return nil, err
+	}
+
+	width := s.cfg.Format.Width()
+	toRet := s.pool.Get()
+	for i := range toRet.Samples {
+		toRet.Samples[i] = s.cfg.Format.Decode(s.raw[i*width : (i+1)*width])
+	}
+	s.clock.StampBuffer(toRet)
+
+	return toRet, nil
+}
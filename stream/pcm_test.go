@@ -0,0 +1,84 @@
+package stream
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPCMSourceFormats(t *testing.T) {
+	tests := []struct {
+		format   SampleFormat
+		raw      []byte
+		expected []int32
+	}{
+		{U8, []byte{128, 255, 0, 192}, []int32{0, 127 << 24, math.MinInt32, 64 << 24}},
+		{S16LE, []byte{0x00, 0x40, 0x00, 0x80}, []int32{0x4000 << 16, math.MinInt32}},
+		{S16BE, []byte{0x40, 0x00, 0xff, 0xff}, []int32{0x4000 << 16, -1 << 16}},
+		{S24LE, []byte{0x56, 0x34, 0x12, 0xff, 0xff, 0xff}, []int32{0x123456 << 8, -1 << 8}},
+		{S32LE, []byte{0x78, 0x56, 0x34, 0x12, 0xff, 0xff, 0xff, 0xff}, []int32{0x12345678, -1}},
+		{S32BE, []byte{0x12, 0x34, 0x56, 0x78, 0x80, 0, 0, 0}, []int32{0x12345678, math.MinInt32}},
+		{F32LE, []byte{0, 0, 0, 0x3f, 0, 0, 0x80, 0xbf}, []int32{math.MaxInt32 / 2, math.MinInt32}},
+	}
+
+	for _, test := range tests {
+		cfg := DefaultPCMConfig()
+		cfg.Format = test.format
+		cfg.FramesPerBuffer = len(test.expected)
+
+		s, err := NewPCMSource(bytes.NewReader(test.raw), cfg)
+		assert.NoError(t, err)
+		assert.NoError(t, s.Start())
+
+		buffer, err := s.Read(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, test.expected, buffer.Samples, string(test.format))
+
+		_, err = s.Read(context.Background())
+		assert.ErrorIs(t, err, io.EOF)
+	}
+}
+
+func TestPCMSourcePadsLastBuffer(t *testing.T) {
+	cfg := DefaultPCMConfig()
+	cfg.InputChannels = 2
+	cfg.FramesPerBuffer = 2
+
+	s, err := NewPCMSource(bytes.NewReader([]byte{1, 0, 2, 0, 3, 0, 4, 0, 5, 0, 6, 0}), cfg)
+	assert.NoError(t, err)
+	assert.NoError(t, s.Start())
+
+	buffer, err := s.Read(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []int32{1 << 16, 2 << 16, 3 << 16, 4 << 16}, buffer.Samples)
+	assert.Equal(t, uint64(0), buffer.Index)
+
+	buffer, err = s.Read(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []int32{5 << 16, 6 << 16, 0, 0}, buffer.Samples)
+	assert.Equal(t, uint64(2), buffer.Index)
+
+	_, err = s.Read(context.Background())
+	assert.ErrorIs(t, err, io.EOF)
+}
+
+func TestParseSampleFormat(t *testing.T) {
+	for name, expected := range map[string]SampleFormat{
+		"S16_LE":   S16LE,
+		"s16le":    S16LE,
+		"S24_3LE":  S24LE,
+		"FLOAT_LE": F32LE,
+		"f32le":    F32LE,
+	} {
+		format, err := ParseSampleFormat(name)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, format, name)
+	}
+
+	_, err := ParseSampleFormat("mp3")
+	assert.ErrorIs(t, err, ErrUnknownFormat)
+}
@@ -0,0 +1,763 @@
+//go:build cgo && !noportaudio
+
+package stream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/garlicgarrison/go-recorder/resample"
+	"github.com/gordonklaus/portaudio"
+)
+
+// standardRates are tried, along with the requested rate and the device's
+// default, when negotiating the rate to open the device at
+var standardRates = []float64{8000, 11025, 16000, 22050, 32000, 44100, 48000, 88200, 96000}
+
+// Singleton
+//
+// Lifecycle methods and Read are safe to call from different goroutines.
+// Only one Read runs at a time.
+type Stream struct {
+	// counters are accessed atomically and kept first for 64-bit alignment
+	overruns        uint64
+	droppedSamples  uint64
+	underruns       uint64
+	inputOverflows  uint64
+	inputUnderflows uint64
+	heard           int64  // callback mode: UnixNano of the last callback or (re)start
+	flush           uint32 // set when the reader should drop stale samples
+
+	cfg    *StreamConfig
+	stream *portaudio.Stream
+	mutex  *sync.Mutex // serializes Read
+	buffer []int32
+	device string  // name of the opened device, used to find it again
+	native float64 // rate the device was opened at, guarded by lifecycle
+
+	// every Buffer handed out comes from here
+	pool *BufferPool
+
+	// blocking mode: frames read so far and the device's input latency
+	index   uint64
+	latency time.Duration
+
+	// blocking mode: does the cancellable device reads
+	blocking *blockingReader
+
+	// lifecycle guards state and the channels that wake waiting readers
+	lifecycle *sync.Mutex
+	state     StreamState
+	halted    chan struct{} // closed when the stream leaves Started
+	unpaused  chan struct{} // closed when the stream leaves Paused
+
+	ring  *ringBuffer
+	ready chan struct{}
+
+	// callback mode: the callback's frame count and the timing of each
+	// callback, and the entry covering the reader's position
+	captured uint64
+	meta     *metaRing
+	current  captureMeta
+
+	// when the device runs at another rate: resampled samples not yet
+	// handed out, the output frame count, and the last device buffer
+	resampler *resample.Resampler
+	pending   []int32
+	outIndex  uint64
+	raw       rawSpan
+}
+
+func NewStream(cfg *StreamConfig) (*Stream, error) {
+	err := portaudio.Initialize()
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Stream{
+		cfg:       cfg,
+		mutex:     &sync.Mutex{},
+		lifecycle: &sync.Mutex{},
+		state:     Opened,
+		halted:    closedChan(),
+		unpaused:  closedChan(),
+	}
+
+	if cfg.Mode == CallbackMode {
+		size := cfg.RingBufferSize
+		if size <= 0 {
+			size = DefaultRingBufferSize
+		}
+		s.ring = newRingBuffer(size)
+		s.ready = make(chan struct{}, 1)
+		s.meta = newMetaRing(size/(cfg.FramesPerBuffer*cfg.InputChannels) + 2)
+	} else {
+		s.blocking = newBlockingReader()
+	}
+	s.pool = NewBufferPool(cfg.FramesPerBuffer * cfg.InputChannels)
+
+	err = s.open()
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func closedChan() chan struct{} {
+	c := make(chan struct{})
+	close(c)
+	return c
+}
+
+func (s *Stream) open() error {
+	s.buffer = make([]int32, s.cfg.FramesPerBuffer*s.cfg.InputChannels)
+
+	device, err := s.inputDevice()
+	if err != nil {
+		return err
+	}
+
+	params := portaudio.HighLatencyParameters(device, nil)
+	params.Input.Channels = s.cfg.InputChannels
+	params.Output.Channels = 0
+	params.FramesPerBuffer = s.cfg.FramesPerBuffer
+	params.SampleRate, err = s.negotiateRate(device, params)
+	if err != nil {
+		return err
+	}
+	if params.SampleRate != s.cfg.SampleRate {
+		log.Printf("%s does not support %gHz, opening at %gHz", device.Name, s.cfg.SampleRate, params.SampleRate)
+	}
+
+	var stream *portaudio.Stream
+	if s.ring != nil {
+		stream, err = portaudio.OpenStream(params, s.callback)
+	} else {
+		stream, err = portaudio.OpenStream(params, s.buffer)
+	}
+	if err != nil {
+		return err
+	}
+
+	s.stream = stream
+	s.device = device.Name
+	s.native = params.SampleRate
+	s.latency = device.DefaultHighInputLatency
+	if info := stream.Info(); info != nil {
+		s.latency = info.InputLatency
+	}
+	return nil
+}
+
+// negotiateRate returns the requested rate if the device supports it.
+// Otherwise it picks the lowest supported rate above the requested one, so
+// nothing is lost when resampling down, or failing that the highest below.
+func (s *Stream) negotiateRate(device *portaudio.DeviceInfo, params portaudio.StreamParameters) (float64, error) {
+	candidates := append([]float64{s.cfg.SampleRate, device.DefaultSampleRate}, standardRates...)
+
+	best := 0.0
+	for _, rate := range candidates {
+		if rate <= 0 {
+			continue
+		}
+
+		params.SampleRate = rate
+		if portaudio.IsFormatSupported(params, s.buffer) != nil {
+			continue
+		}
+		if rate == s.cfg.SampleRate {
+			return rate, nil
+		}
+
+		above, bestAbove := rate > s.cfg.SampleRate, best > s.cfg.SampleRate
+		switch {
+		case best == 0:
+			best = rate
+		case above && (!bestAbove || rate < best):
+			best = rate
+		case !above && !bestAbove && rate > best:
+			best = rate
+		}
+	}
+
+	if best == 0 {
+		return 0, ErrUnsupportedRate
+	}
+	return best, nil
+}
+
+// NativeRate is the rate the device was opened at. Reads are resampled to
+// the configured rate when the two differ.
+func (s *Stream) NativeRate() float64 {
+	s.lifecycle.Lock()
+	defer s.lifecycle.Unlock()
+
+	return s.native
+}
+
+// inputDevice looks the device up by name so a reopen finds the same
+// microphone even if the system default has changed since
+func (s *Stream) inputDevice() (*portaudio.DeviceInfo, error) {
+	name := s.cfg.DeviceName
+	if name == "" {
+		name = s.device
+	}
+	if name == "" {
+		return portaudio.DefaultInputDevice()
+	}
+
+	devices, err := portaudio.Devices()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, device := range devices {
+		if device.Name == name && device.MaxInputChannels > 0 {
+			return device, nil
+		}
+	}
+
+	return nil, ErrDeviceNotFound
+}
+
+// DeviceName is the name of the opened input device
+func (s *Stream) DeviceName() string {
+	s.lifecycle.Lock()
+	defer s.lifecycle.Unlock()
+
+	return s.device
+}
+
+// reopen replaces a failed device stream with a new one on the same device
+// and starts it. With rescan PortAudio is reinitialized so devices plugged
+// in since it started are visible, which closes every other PortAudio
+// stream in the process.
+func (s *Stream) reopen(rescan bool) error {
+	s.lifecycle.Lock()
+	defer s.lifecycle.Unlock()
+
+	if s.state != Started {
+		return ErrNotStarted
+	}
+
+	if s.stream != nil {
+		s.stream.Abort()
+		s.stream.Close()
+		s.stream = nil
+	}
+
+	if rescan {
+		portaudio.Terminate()
+		err := portaudio.Initialize()
+		if err != nil {
+			return err
+		}
+	}
+
+	err := s.open()
+	if err != nil {
+		return err
+	}
+
+	err = s.stream.Start()
+	if err != nil {
+		s.stream.Close()
+		s.stream = nil
+		return err
+	}
+
+	atomic.StoreUint32(&s.flush, 1)
+	atomic.StoreInt64(&s.heard, time.Now().UnixNano())
+	return nil
+}
+
+func (s *Stream) State() StreamState {
+	s.lifecycle.Lock()
+	defer s.lifecycle.Unlock()
+
+	return s.state
+}
+
+// setState must be called with the lifecycle lock held
+func (s *Stream) setState(state StreamState) {
+	if s.state == Started {
+		close(s.halted)
+	}
+	if s.state == Paused {
+		close(s.unpaused)
+	}
+
+	switch state {
+	case Started:
+		s.halted = make(chan struct{})
+	case Paused:
+		s.unpaused = make(chan struct{})
+	}
+
+	s.state = state
+}
+
+// Start begins capturing from an opened or stopped stream, and reopens the
+// device if the stream was closed
+func (s *Stream) Start() error {
+	s.lifecycle.Lock()
+	defer s.lifecycle.Unlock()
+
+	switch s.state {
+	case Opened, Stopped:
+	case Closed:
+		err := s.open()
+		if err != nil {
+			log.Printf("open default stream error -- %s", err)
+			return err
+		}
+	default:
+		return &TransitionError{From: s.state, To: Started}
+	}
+
+	err := s.stream.Start()
+	if err != nil {
+		return err
+	}
+
+	atomic.StoreUint32(&s.flush, 1)
+	atomic.StoreInt64(&s.heard, time.Now().UnixNano())
+	s.setState(Started)
+	return nil
+}
+
+// Pause stops the device but keeps it open. Reads wait until Resume.
+func (s *Stream) Pause() error {
+	s.lifecycle.Lock()
+	defer s.lifecycle.Unlock()
+
+	if s.state != Started {
+		return &TransitionError{From: s.state, To: Paused}
+	}
+
+	if s.stream != nil {
+		err := s.stream.Abort()
+		if err != nil {
+			return err
+		}
+	}
+
+	s.setState(Paused)
+	return nil
+}
+
+// Resume restarts a paused stream. Samples buffered before the pause are
+// discarded.
+func (s *Stream) Resume() error {
+	s.lifecycle.Lock()
+	defer s.lifecycle.Unlock()
+
+	if s.state != Paused {
+		return &TransitionError{From: s.state, To: Started}
+	}
+	if s.stream == nil {
+		return portaudio.BadStreamPtr
+	}
+
+	err := s.stream.Start()
+	if err != nil {
+		return err
+	}
+
+	atomic.StoreUint32(&s.flush, 1)
+	atomic.StoreInt64(&s.heard, time.Now().UnixNano())
+	s.setState(Started)
+	return nil
+}
+
+// Stop stops a started or paused stream. Pending reads return ErrNotStarted.
+func (s *Stream) Stop() error {
+	s.lifecycle.Lock()
+	defer s.lifecycle.Unlock()
+
+	return s.stop()
+}
+
+func (s *Stream) stop() error {
+	switch s.state {
+	case Started:
+		// abort rather than stop so a blocked read returns right away.
+		// After a failed reopen there is no device stream left to abort.
+		if s.stream != nil {
+			err := s.stream.Abort()
+			if err != nil {
+				return err
+			}
+		}
+	case Paused:
+	default:
+		return &TransitionError{From: s.state, To: Stopped}
+	}
+
+	s.setState(Stopped)
+	return nil
+}
+
+// Close stops the stream if needed and releases the device
+func (s *Stream) Close() error {
+	s.lifecycle.Lock()
+	defer s.lifecycle.Unlock()
+
+	switch s.state {
+	case Closed:
+		return &TransitionError{From: s.state, To: Closed}
+	case Started, Paused:
+		err := s.stop()
+		if err != nil {
+			return err
+		}
+	}
+
+	if s.stream != nil {
+		err := s.stream.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	s.setState(Closed)
+	return nil
+}
+
+// wait blocks while the stream is paused and returns the channel that is
+// closed when the stream next leaves Started
+func (s *Stream) wait(ctx context.Context) (chan struct{}, error) {
+	for {
+		s.lifecycle.Lock()
+		state, halted, unpaused := s.state, s.halted, s.unpaused
+		s.lifecycle.Unlock()
+
+		switch state {
+		case Started:
+			return halted, nil
+		case Paused:
+			select {
+			case <-unpaused:
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		default:
+			return nil, ErrNotStarted
+		}
+	}
+}
+
+// Read returns the next buffer. It waits while the stream is paused and
+// returns ErrNotStarted once it is stopped or closed. Cancelling ctx gives
+// up on the read without stopping the stream; in blocking mode the device
+// read carries on, and the next Read returns what it captured.
+func (s *Stream) Read(ctx context.Context) (*Buffer, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	native := s.NativeRate()
+	if native == s.cfg.SampleRate {
+		return s.readDevice(ctx, native)
+	}
+	return s.readResampled(ctx, native)
+}
+
+// readResampled reads device buffers at the native rate until a buffer's
+// worth at the configured rate is ready. Index counts frames at the
+// configured rate.
+func (s *Stream) readResampled(ctx context.Context, native float64) (*Buffer, error) {
+	ratio := s.cfg.SampleRate / native
+	if s.resampler == nil {
+		r, err := resample.NewWithQuality(s.cfg.InputChannels, ratio, s.resampleQuality())
+		if err != nil {
+			return nil, err
+		}
+		s.resampler = r
+	} else if s.resampler.Ratio() != ratio {
+		// reopened at a different rate
+		s.resampler.SetRatio(ratio)
+		s.resampler.Reset()
+		s.pending = s.pending[:0]
+	}
+
+	need := s.cfg.FramesPerBuffer * s.cfg.InputChannels
+	for len(s.pending) < need {
+		raw, err := s.readDevice(ctx, native)
+		if err != nil {
+			return nil, err
+		}
+
+		if s.raw.timeEnd.IsZero() {
+			s.outIndex = uint64(float64(raw.Index) * ratio)
+		} else if raw.Index != s.raw.end {
+			// a dropout or a restart: what is pending no longer lines up
+			// with what follows
+			if raw.Index > s.raw.end {
+				s.outIndex += uint64(float64(raw.Index-s.raw.end)*ratio) + uint64(len(s.pending)/s.cfg.InputChannels)
+			}
+			s.resampler.Reset()
+			s.pending = s.pending[:0]
+		}
+
+		s.pending = s.resampler.Process(raw.Samples, s.pending)
+		duration := s.frameDuration(uint64(raw.Frames), native)
+		s.raw = rawSpan{
+			end:     raw.End(),
+			adcEnd:  raw.ADCTime + duration,
+			timeEnd: raw.Time.Add(duration),
+		}
+		raw.Release()
+	}
+
+	// the pending frames end where the last device buffer ended
+	behind := s.frameDuration(uint64(len(s.pending)/s.cfg.InputChannels), s.cfg.SampleRate)
+	buffer := s.pool.Get()
+	buffer.Frames = s.cfg.FramesPerBuffer
+	buffer.Index = s.outIndex
+	buffer.ADCTime = s.raw.adcEnd - behind
+	buffer.Time = s.raw.timeEnd.Add(-behind)
+	copy(buffer.Samples, s.pending)
+
+	s.pending = s.pending[:copy(s.pending, s.pending[need:])]
+	s.outIndex += uint64(buffer.Frames)
+	return buffer, nil
+}
+
+func (s *Stream) resampleQuality() resample.Quality {
+	if s.cfg.ResampleQuality == "" {
+		return resample.Sinc
+	}
+	return s.cfg.ResampleQuality
+}
+
+// readDevice returns the next buffer at the device's rate
+func (s *Stream) readDevice(ctx context.Context, native float64) (*Buffer, error) {
+	if s.ring != nil {
+		return s.readRing(ctx, native)
+	}
+
+	for {
+		_, err := s.wait(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		err = s.readBlocking(ctx)
+		if errors.Is(err, portaudio.InputOverflowed) {
+			// the buffer still holds valid samples, the device just dropped
+			// some before them
+			atomic.AddUint64(&s.inputOverflows, 1)
+		} else if err != nil {
+			if s.State() != Started {
+				// paused or stopped underneath us, wait decides which
+				continue
+			}
+			return nil, err
+		}
+
+		// the read returns once the last frame is in, so the first was
+		// captured a buffer and the input latency ago
+		elapsed := s.frameDuration(uint64(s.cfg.FramesPerBuffer), native) + s.latency
+		toRet := s.pool.Get()
+		toRet.Frames = s.cfg.FramesPerBuffer
+		toRet.Index = s.index
+		toRet.ADCTime = s.streamTime() - elapsed
+		toRet.Time = time.Now().Add(-elapsed)
+		copy(toRet.Samples, s.buffer)
+		s.index += uint64(toRet.Frames)
+
+		return toRet, nil
+	}
+}
+
+func (s *Stream) frameDuration(frames uint64, rate float64) time.Duration {
+	return time.Duration(float64(frames) / rate * float64(time.Second))
+}
+
+func (s *Stream) streamTime() time.Duration {
+	s.lifecycle.Lock()
+	defer s.lifecycle.Unlock()
+
+	if s.stream == nil {
+		return 0
+	}
+	return s.stream.Time()
+}
+
+func (s *Stream) readBlocking(ctx context.Context) error {
+	s.lifecycle.Lock()
+	stream := s.stream
+	s.lifecycle.Unlock()
+	if stream == nil {
+		return portaudio.BadStreamPtr
+	}
+
+	return s.blocking.read(ctx, stream, stream.Read)
+}
+
+// readRing waits until a full buffer has been captured. PortAudio stops
+// calling back when the device goes away rather than reporting an error, so
+// a wait with no callback for StallTimeout fails with ErrStalled.
+func (s *Stream) readRing(ctx context.Context, native float64) (*Buffer, error) {
+	buffer := s.pool.Get()
+	toRet := buffer.Samples
+	n := 0
+	start := uint64(0)
+	waited := false
+	var stall *time.Timer
+	for {
+		halted, err := s.wait(ctx)
+		if err != nil {
+			buffer.Release()
+			return nil, err
+		}
+
+		// anything captured before the last start or resume is stale
+		if atomic.CompareAndSwapUint32(&s.flush, 1, 0) {
+			s.ring.Reset()
+			n = 0
+		}
+
+		if n == 0 {
+			start = s.ring.ReadPos()
+		}
+		n += s.ring.Read(toRet[n:])
+		if n == len(toRet) {
+			s.stampRing(buffer, start, native)
+			return buffer, nil
+		}
+
+		if !waited {
+			atomic.AddUint64(&s.underruns, 1)
+			waited = true
+		}
+
+		silent := time.Since(time.Unix(0, atomic.LoadInt64(&s.heard)))
+		if silent >= s.stallTimeout() {
+			buffer.Release()
+			return nil, fmt.Errorf("%w: no callback for %s", ErrStalled, silent.Round(time.Millisecond))
+		}
+		wake := s.stallTimeout() - silent
+		if stall == nil {
+			stall = time.NewTimer(wake)
+			defer stall.Stop()
+		} else {
+			if !stall.Stop() {
+				select {
+				case <-stall.C:
+				default:
+				}
+			}
+			stall.Reset(wake)
+		}
+
+		select {
+		case <-s.ready:
+		case <-halted:
+		case <-stall.C:
+		case <-ctx.Done():
+			buffer.Release()
+			return nil, ctx.Err()
+		}
+	}
+}
+
+func (s *Stream) stallTimeout() time.Duration {
+	if s.cfg.StallTimeout <= 0 {
+		return DefaultStallTimeout
+	}
+	return s.cfg.StallTimeout
+}
+
+// stampRing times samples read from ring position start using the entry
+// the callback left for them. Samples the callback dropped still count
+// towards the index, so they show up as a gap.
+func (s *Stream) stampRing(buffer *Buffer, start uint64, native float64) {
+	for {
+		next, ok := s.meta.Peek()
+		if !ok || next.pos > start {
+			break
+		}
+		s.current = next
+		s.meta.Pop()
+	}
+
+	frames := (start - s.current.pos) / uint64(s.cfg.InputChannels)
+	offset := s.frameDuration(frames, native)
+	buffer.Frames = s.cfg.FramesPerBuffer
+	buffer.Index = s.current.index + frames
+	buffer.ADCTime = s.current.adc + offset
+	buffer.Time = s.current.wall.Add(offset)
+}
+
+// callback runs on the PortAudio thread. It must not block or allocate.
+func (s *Stream) callback(in []int32, timeInfo portaudio.StreamCallbackTimeInfo, flags portaudio.StreamCallbackFlags) {
+	if flags&portaudio.InputOverflow != 0 {
+		atomic.AddUint64(&s.inputOverflows, 1)
+	}
+	if flags&portaudio.InputUnderflow != 0 {
+		atomic.AddUint64(&s.inputUnderflows, 1)
+	}
+
+	// the entry goes in before the samples so the reader never sees
+	// samples without one
+	now := time.Now()
+	atomic.StoreInt64(&s.heard, now.UnixNano())
+
+	s.meta.Push(captureMeta{
+		pos:   s.ring.WritePos(),
+		index: s.captured,
+		adc:   timeInfo.InputBufferAdcTime,
+		wall:  now.Add(timeInfo.InputBufferAdcTime - timeInfo.CurrentTime),
+	})
+	s.captured += uint64(len(in) / s.cfg.InputChannels)
+
+	n := s.ring.Write(in)
+	if n < len(in) {
+		atomic.AddUint64(&s.overruns, 1)
+		atomic.AddUint64(&s.droppedSamples, uint64(len(in)-n))
+	}
+
+	select {
+	case s.ready <- struct{}{}:
+	default:
+	}
+}
+
+// Stats is safe to call from any goroutine while the stream is running
+func (s *Stream) Stats() Stats {
+	stats := Stats{
+		Mode:            BlockingMode,
+		State:           s.State(),
+		Overruns:        atomic.LoadUint64(&s.overruns),
+		DroppedSamples:  atomic.LoadUint64(&s.droppedSamples),
+		Underruns:       atomic.LoadUint64(&s.underruns),
+		InputOverflows:  atomic.LoadUint64(&s.inputOverflows),
+		InputUnderflows: atomic.LoadUint64(&s.inputUnderflows),
+		NativeRate:      s.NativeRate(),
+	}
+	if stats.NativeRate != s.cfg.SampleRate {
+		stats.ResampleQuality = s.resampleQuality()
+	}
+	if s.ring != nil {
+		stats.Mode = CallbackMode
+		stats.Buffered = s.ring.Len()
+	}
+
+	return stats
+}
+
+// Terminates portaudio
+func (s *Stream) Terminate() {
+	if s.blocking != nil {
+		s.blocking.close()
+		s.blocking = nil
+	}
+	portaudio.Terminate()
+}
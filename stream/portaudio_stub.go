@@ -0,0 +1,47 @@
+//go:build !cgo || noportaudio
+
+package stream
+
+import "context"
+
+// Stream is unavailable in builds without cgo or with the noportaudio tag.
+// Every other Source, and the rest of the module, still works.
+type Stream struct {
+	cfg *StreamConfig
+}
+
+func NewStream(cfg *StreamConfig) (*Stream, error) {
+	return nil, ErrNoPortAudio
+}
+
+func (s *Stream) Start() error  { return ErrNoPortAudio }
+func (s *Stream) Pause() error  { return ErrNoPortAudio }
+func (s *Stream) Resume() error { return ErrNoPortAudio }
+func (s *Stream) Stop() error   { return ErrNoPortAudio }
+func (s *Stream) Close() error  { return ErrNoPortAudio }
+
+func (s *Stream) Read(ctx context.Context) (*Buffer, error) {
+	return nil, ErrNoPortAudio
+}
+
+func (s *Stream) State() StreamState {
+	return Closed
+}
+
+func (s *Stream) Stats() Stats {
+	return Stats{State: Closed}
+}
+
+func (s *Stream) DeviceName() string {
+	return ""
+}
+
+func (s *Stream) NativeRate() float64 {
+	return 0
+}
+
+func (s *Stream) Terminate() {}
+
+func (s *Stream) reopen(rescan bool) error {
+	return ErrNoPortAudio
+}
@@ -0,0 +1,366 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultInitialBackoff = 250 * time.Millisecond
+	DefaultMaxBackoff     = 10 * time.Second
+	DefaultBackoffFactor  = 2.0
+	EventChanSize         = 16
+)
+
+// GapFill decides what Read returns while the device is gone
+type GapFill string
+
+const (
+	// FillSilence keeps Read returning zeroed buffers in real time, so the
+	// recording keeps its length across the outage
+	FillSilence GapFill = "silence"
+
+	// MarkGap blocks Read until the device is back and reports the missing
+	// span in the Reconnected event
+	MarkGap GapFill = "mark"
+)
+
+type EventType string
+
+const (
+	Disconnected EventType = "disconnected"
+	Reconnected  EventType = "reconnected"
+	RetryFailed  EventType = "retry_failed"
+)
+
+// Event reports a change in the device connection
+type Event struct {
+	Type   EventType
+	Device string
+	Time   time.Time
+	Err    error
+
+	// attempts since the disconnect, including the one that succeeded
+	Attempt int
+
+	// Reconnected only: how long the device was gone and how many samples
+	// that is at the configured rate
+	Gap        time.Duration
+	GapSamples int
+}
+
+type ReconnectConfig struct {
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	BackoffFactor  float64
+
+	Fill GapFill
+
+	// reinitialize PortAudio before each attempt so a replugged device is
+	// visible; this closes every other PortAudio stream in the process
+	RescanDevices bool
+}
+
+func DefaultReconnectConfig() *ReconnectConfig {
+	return &ReconnectConfig{
+		InitialBackoff: DefaultInitialBackoff,
+		MaxBackoff:     DefaultMaxBackoff,
+		BackoffFactor:  DefaultBackoffFactor,
+		Fill:           FillSilence,
+		RescanDevices:  true,
+	}
+}
+
+// ResilientStream is a Stream that survives the device going away. Read
+// errors, including ErrStalled from a callback stream the device stopped
+// calling back, start a background loop that reopens the same device, by
+// name, with exponential backoff until it comes back or the stream is
+// closed.
+//
+// Buffers are restamped so indexes run on across reconnects: with
+// FillSilence the silence takes up the gap, with MarkGap the index jumps
+// over it.
+type ResilientStream struct {
+	*Stream
+
+	rcfg   *ReconnectConfig
+	events chan Event
+	device device                               // the Stream but in tests
+	after  func(time.Duration) <-chan time.Time // waits out backoffs, time.After but in tests
+	now    func() time.Time                     // times outages, time.Now but in tests
+
+	// frames added to the device's indexes for silence and marked gaps, and
+	// where the last buffer returned ended; the buffer itself may be back
+	// in its pool
+	offset uint64
+	end    rawSpan
+
+	mutex      *sync.Mutex
+	lostAt     time.Time
+	skip       uint64        // frames to jump over on the next device buffer
+	reconnects chan struct{} // closed when the current outage ends
+	stop       chan struct{}
+}
+
+// device is what a ResilientStream needs of its Stream
+type device interface {
+	Read(ctx context.Context) (*Buffer, error)
+	Close() error
+	DeviceName() string
+	reopen(rescan bool) error
+}
+
+func NewResilientStream(cfg *StreamConfig, rcfg *ReconnectConfig) (*ResilientStream, error) {
+	if rcfg == nil {
+		rcfg = DefaultReconnectConfig()
+	}
+
+	s, err := NewStream(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ResilientStream{
+		Stream: s,
+		rcfg:   rcfg,
+		events: make(chan Event, EventChanSize),
+		device: s,
+		after:  time.After,
+		now:    time.Now,
+		mutex:  &sync.Mutex{},
+		stop:   make(chan struct{}),
+	}, nil
+}
+
+// Events delivers connection changes. Events are dropped if nobody keeps up.
+func (r *ResilientStream) Events() <-chan Event {
+	return r.events
+}
+
+func (r *ResilientStream) Start() error {
+	r.mutex.Lock()
+	select {
+	case <-r.stop:
+		r.stop = make(chan struct{})
+	default:
+	}
+	r.mutex.Unlock()
+
+	return r.Stream.Start()
+}
+
+// Close gives up on any reconnect in progress and closes the stream
+func (r *ResilientStream) Close() error {
+	r.mutex.Lock()
+	select {
+	case <-r.stop:
+	default:
+		close(r.stop)
+	}
+	r.mutex.Unlock()
+
+	return r.device.Close()
+}
+
+func (r *ResilientStream) Read(ctx context.Context) (*Buffer, error) {
+	for {
+		r.mutex.Lock()
+		reconnects := r.reconnects
+		r.mutex.Unlock()
+
+		if reconnects != nil {
+			samples, err := r.waitGap(ctx, reconnects)
+			if err != nil {
+				return nil, err
+			}
+			if samples != nil {
+				return r.silence(samples), nil
+			}
+			continue
+		}
+
+		buffer, err := r.device.Read(ctx)
+		if err == nil {
+			r.mutex.Lock()
+			r.offset += r.skip
+			r.skip = 0
+			r.mutex.Unlock()
+
+			buffer.Index += r.offset
+			r.remember(buffer)
+			return buffer, nil
+		}
+		if ctx.Err() != nil || errors.Is(err, ErrNotStarted) {
+			return nil, err
+		}
+
+		log.Printf("device lost -- %s", err)
+		r.disconnect(err)
+	}
+}
+
+// waitGap returns a silent buffer or nil once the device is back
+func (r *ResilientStream) waitGap(ctx context.Context, reconnects chan struct{}) ([]int32, error) {
+	if r.rcfg.Fill == MarkGap {
+		select {
+		case <-reconnects:
+			return nil, nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	timer := time.NewTimer(r.bufferDuration())
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return make([]int32, r.cfg.FramesPerBuffer*r.cfg.InputChannels), nil
+	case <-reconnects:
+		return nil, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// silence stamps a fill buffer right after the last one returned
+func (r *ResilientStream) silence(samples []int32) *Buffer {
+	buffer := &Buffer{
+		Samples: samples,
+		Frames:  r.cfg.FramesPerBuffer,
+		Time:    r.now(),
+	}
+	if !r.end.timeEnd.IsZero() {
+		buffer.Index = r.end.end
+		buffer.ADCTime = r.end.adcEnd
+		buffer.Time = r.end.timeEnd
+	}
+
+	r.offset += uint64(buffer.Frames)
+	r.remember(buffer)
+	return buffer
+}
+
+// remember keeps where a buffer handed out ends
+func (r *ResilientStream) remember(buffer *Buffer) {
+	duration := time.Duration(float64(buffer.Frames) / r.cfg.SampleRate * float64(time.Second))
+	r.end = rawSpan{
+		end:     buffer.End(),
+		adcEnd:  buffer.ADCTime + duration,
+		timeEnd: buffer.Time.Add(duration),
+	}
+}
+
+func (r *ResilientStream) bufferDuration() time.Duration {
+	return time.Duration(float64(r.cfg.FramesPerBuffer) / r.cfg.SampleRate * float64(time.Second))
+}
+
+func (r *ResilientStream) disconnect(err error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.reconnects != nil {
+		return
+	}
+
+	r.lostAt = r.now()
+	r.reconnects = make(chan struct{})
+	r.emit(Event{
+		Type:   Disconnected,
+		Device: r.device.DeviceName(),
+		Time:   r.lostAt,
+		Err:    err,
+	})
+
+	go r.reconnect(r.stop)
+}
+
+func (r *ResilientStream) reconnect(stop chan struct{}) {
+	backoff := r.rcfg.InitialBackoff
+	if backoff <= 0 {
+		backoff = DefaultInitialBackoff
+	}
+
+	for attempt := 1; ; attempt++ {
+		select {
+		case <-r.after(backoff):
+		case <-stop:
+			r.reconnected()
+			return
+		}
+
+		err := r.device.reopen(r.rcfg.RescanDevices)
+		if errors.Is(err, ErrNotStarted) {
+			// stopped or closed while we were waiting
+			r.reconnected()
+			return
+		}
+		if err != nil {
+			r.emit(Event{
+				Type:    RetryFailed,
+				Device:  r.device.DeviceName(),
+				Time:    r.now(),
+				Err:     err,
+				Attempt: attempt,
+			})
+
+			backoff = r.nextBackoff(backoff)
+			continue
+		}
+
+		now := r.now()
+		r.mutex.Lock()
+		gap := now.Sub(r.lostAt)
+		if r.rcfg.Fill == MarkGap {
+			r.skip += uint64(gap.Seconds() * r.cfg.SampleRate)
+		}
+		r.mutex.Unlock()
+
+		r.emit(Event{
+			Type:       Reconnected,
+			Device:     r.device.DeviceName(),
+			Time:       now,
+			Attempt:    attempt,
+			Gap:        gap,
+			GapSamples: int(gap.Seconds() * r.cfg.SampleRate),
+		})
+		r.reconnected()
+		return
+	}
+}
+
+func (r *ResilientStream) nextBackoff(backoff time.Duration) time.Duration {
+	factor := r.rcfg.BackoffFactor
+	if factor < 1 {
+		factor = DefaultBackoffFactor
+	}
+	max := r.rcfg.MaxBackoff
+	if max <= 0 {
+		max = DefaultMaxBackoff
+	}
+
+	backoff = time.Duration(float64(backoff) * factor)
+	if backoff > max {
+		backoff = max
+	}
+	return backoff
+}
+
+func (r *ResilientStream) reconnected() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	close(r.reconnects)
+	r.reconnects = nil
+}
+
+func (r *ResilientStream) emit(e Event) {
+	select {
+	case r.events <- e:
+	default:
+		log.Printf("event channel is full -- discarding %s event", e.Type)
+	}
+}
@@ -0,0 +1,254 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	errTestUnplugged = errors.New("test device unplugged")
+	errTestNoDevice  = errors.New("test device not found")
+)
+
+// testDevice hands out its buffers in order, failing a read for each nil
+// one, and fails its first fail reopens
+type testDevice struct {
+	mutex   sync.Mutex
+	buffers []*Buffer
+	fail    int
+	reopens int
+	closed  bool
+}
+
+func (d *testDevice) Read(ctx context.Context) (*Buffer, error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if d.closed || len(d.buffers) == 0 {
+		return nil, ErrNotStarted
+	}
+	buffer := d.buffers[0]
+	d.buffers = d.buffers[1:]
+	if buffer == nil {
+		return nil, errTestUnplugged
+	}
+	return buffer, nil
+}
+
+func (d *testDevice) Close() error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	d.closed = true
+	return nil
+}
+
+func (d *testDevice) DeviceName() string {
+	return "test"
+}
+
+func (d *testDevice) reopen(rescan bool) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if d.closed {
+		return ErrNotStarted
+	}
+	d.reopens++
+	if d.reopens <= d.fail {
+		return errTestNoDevice
+	}
+	return nil
+}
+
+// testClock moves on by each backoff waited out, at once
+type testClock struct {
+	mutex sync.Mutex
+	now   time.Time
+	waits []time.Duration
+}
+
+func (c *testClock) Now() time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.now
+}
+
+func (c *testClock) After(d time.Duration) <-chan time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.waits = append(c.waits, d)
+	c.now = c.now.Add(d)
+	fired := make(chan time.Time, 1)
+	fired <- c.now
+	return fired
+}
+
+func testResilient(rcfg *ReconnectConfig, device *testDevice, clock *testClock) *ResilientStream {
+	cfg := DefaultStreamConfig()
+	cfg.SampleRate = 1000
+	cfg.FramesPerBuffer = 10
+	return &ResilientStream{
+		Stream: &Stream{cfg: cfg},
+		rcfg:   rcfg,
+		events: make(chan Event, EventChanSize),
+		device: device,
+		after:  clock.After,
+		now:    clock.Now,
+		mutex:  &sync.Mutex{},
+		stop:   make(chan struct{}),
+	}
+}
+
+func nextEvent(t *testing.T, r *ResilientStream) Event {
+	select {
+	case e := <-r.events:
+		return e
+	case <-time.After(time.Second):
+		t.Fatal("no event")
+		return Event{}
+	}
+}
+
+// fill silence picks up where the last buffer ended, even once the consumer
+// has released it and the pool has handed it out again
+func TestResilientSilence(t *testing.T) {
+	r := testResilient(DefaultReconnectConfig(), &testDevice{}, &testClock{})
+
+	pool := NewBufferPool(10)
+	b := pool.Get()
+	b.Frames = 10
+	b.Index = 40
+	b.ADCTime = time.Second
+	b.Time = time.Unix(100, 0)
+	r.remember(b)
+	b.Release()
+
+	reused := pool.Get()
+	reused.Index = 0
+	reused.ADCTime = 0
+	reused.Time = time.Time{}
+
+	fill := r.silence(make([]int32, 10))
+	assert.Equal(t, uint64(50), fill.Index)
+	assert.Equal(t, time.Second+10*time.Millisecond, fill.ADCTime)
+	assert.Equal(t, time.Unix(100, 0).Add(10*time.Millisecond), fill.Time)
+
+	fill = r.silence(make([]int32, 10))
+	assert.Equal(t, uint64(60), fill.Index)
+	assert.Equal(t, uint64(20), r.offset)
+}
+
+func TestResilientBackoff(t *testing.T) {
+	rcfg := DefaultReconnectConfig()
+	rcfg.MaxBackoff = time.Second
+	rcfg.BackoffFactor = 3
+	r := testResilient(rcfg, &testDevice{}, &testClock{})
+
+	backoff := 100 * time.Millisecond
+	for _, want := range []time.Duration{300, 900, 1000, 1000} {
+		backoff = r.nextBackoff(backoff)
+		assert.Equal(t, want*time.Millisecond, backoff)
+	}
+
+	// out of range settings fall back to the defaults
+	rcfg.MaxBackoff = 0
+	rcfg.BackoffFactor = 0.5
+	assert.Equal(t, 2*time.Second, r.nextBackoff(time.Second))
+	assert.Equal(t, DefaultMaxBackoff, r.nextBackoff(8*time.Second))
+}
+
+// failed attempts are reported and back off further each time, and the gap
+// runs from the disconnect to the attempt that worked
+func TestResilientReconnectEvents(t *testing.T) {
+	rcfg := DefaultReconnectConfig()
+	rcfg.InitialBackoff = 100 * time.Millisecond
+	clock := &testClock{now: time.Unix(100, 0)}
+	r := testResilient(rcfg, &testDevice{fail: 2}, clock)
+
+	r.disconnect(errTestUnplugged)
+
+	e := nextEvent(t, r)
+	assert.Equal(t, Disconnected, e.Type)
+	assert.Equal(t, "test", e.Device)
+	assert.Equal(t, time.Unix(100, 0), e.Time)
+	assert.ErrorIs(t, e.Err, errTestUnplugged)
+
+	for attempt := 1; attempt <= 2; attempt++ {
+		e = nextEvent(t, r)
+		assert.Equal(t, RetryFailed, e.Type)
+		assert.Equal(t, attempt, e.Attempt)
+		assert.ErrorIs(t, e.Err, errTestNoDevice)
+	}
+
+	e = nextEvent(t, r)
+	assert.Equal(t, Reconnected, e.Type)
+	assert.Equal(t, 3, e.Attempt)
+	assert.Equal(t, 700*time.Millisecond, e.Gap)
+	assert.Equal(t, 700, e.GapSamples)
+	assert.Equal(t, time.Unix(100, 0).Add(700*time.Millisecond), e.Time)
+
+	clock.mutex.Lock()
+	assert.Equal(t, []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond}, clock.waits)
+	clock.mutex.Unlock()
+}
+
+// with MarkGap Read waits out the outage and the index jumps over it
+func TestResilientMarkGap(t *testing.T) {
+	rcfg := DefaultReconnectConfig()
+	rcfg.InitialBackoff = 500 * time.Millisecond
+	rcfg.Fill = MarkGap
+	device := &testDevice{
+		buffers: []*Buffer{
+			{Samples: make([]int32, 10), Frames: 10, Index: 0},
+			nil,
+			{Samples: make([]int32, 10), Frames: 10, Index: 10},
+			{Samples: make([]int32, 10), Frames: 10, Index: 20},
+		},
+	}
+	r := testResilient(rcfg, device, &testClock{now: time.Unix(100, 0)})
+
+	for _, want := range []uint64{0, 510, 520} {
+		buffer, err := r.Read(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, want, buffer.Index)
+	}
+
+	assert.Equal(t, Disconnected, nextEvent(t, r).Type)
+	assert.Equal(t, 500, nextEvent(t, r).GapSamples)
+}
+
+// closing gives up on the reconnect without another attempt, and a Read
+// waiting on it returns
+func TestResilientCloseReconnecting(t *testing.T) {
+	rcfg := DefaultReconnectConfig()
+	rcfg.Fill = MarkGap
+	device := &testDevice{buffers: []*Buffer{nil}}
+	r := testResilient(rcfg, device, &testClock{})
+	r.after = func(time.Duration) <-chan time.Time { return nil }
+
+	read := make(chan error)
+	go func() {
+		_, err := r.Read(context.Background())
+		read <- err
+	}()
+	assert.Equal(t, Disconnected, nextEvent(t, r).Type)
+
+	assert.NoError(t, r.Close())
+	select {
+	case err := <-read:
+		assert.ErrorIs(t, err, ErrNotStarted)
+	case <-time.After(time.Second):
+		t.Fatal("Read still waiting on the reconnect")
+	}
+
+	assert.Equal(t, 0, device.reopens)
+	assert.Empty(t, r.events)
+}
@@ -0,0 +1,148 @@
+package stream
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// ringBuffer is a lock-free single-producer single-consumer sample queue.
+// The PortAudio callback is the only writer and Stream.Read is the only
+// reader, so the two positions are the only shared state.
+type ringBuffer struct {
+	// read and write are accessed atomically and kept first for 64-bit
+	// alignment on 32-bit platforms (Raspberry Pi)
+	read  uint64
+	write uint64
+
+	data []int32
+	mask uint64
+}
+
+// newRingBuffer preallocates room for at least size samples, rounded up to
+// a power of two so positions can be wrapped with a mask.
+func newRingBuffer(size int) *ringBuffer {
+	n := 1
+	for n < size {
+		n <<= 1
+	}
+
+	return &ringBuffer{
+		data: make([]int32, n),
+		mask: uint64(n - 1),
+	}
+}
+
+func (r *ringBuffer) Cap() int {
+	return len(r.data)
+}
+
+// Len returns the number of samples waiting to be read
+func (r *ringBuffer) Len() int {
+	return int(atomic.LoadUint64(&r.write) - atomic.LoadUint64(&r.read))
+}
+
+// Write copies as much of p as fits and returns the number of samples written.
+// It never blocks, so it is safe to call from the audio callback.
+func (r *ringBuffer) Write(p []int32) int {
+	write := atomic.LoadUint64(&r.write)
+	free := len(r.data) - int(write-atomic.LoadUint64(&r.read))
+	if len(p) > free {
+		p = p[:free]
+	}
+
+	for i, sample := range p {
+		r.data[(write+uint64(i))&r.mask] = sample
+	}
+	atomic.StoreUint64(&r.write, write+uint64(len(p)))
+
+	return len(p)
+}
+
+// Read copies up to len(p) samples into p and returns the number read
+func (r *ringBuffer) Read(p []int32) int {
+	read := atomic.LoadUint64(&r.read)
+	available := int(atomic.LoadUint64(&r.write) - read)
+	if len(p) > available {
+		p = p[:available]
+	}
+
+	for i := range p {
+		p[i] = r.data[(read+uint64(i))&r.mask]
+	}
+	atomic.StoreUint64(&r.read, read+uint64(len(p)))
+
+	return len(p)
+}
+
+// Reset drops everything buffered. It only moves the read position, so it
+// belongs to the consumer like Read.
+func (r *ringBuffer) Reset() {
+	atomic.StoreUint64(&r.read, atomic.LoadUint64(&r.write))
+}
+
+// ReadPos is the absolute position of the next sample Read returns
+func (r *ringBuffer) ReadPos() uint64 {
+	return atomic.LoadUint64(&r.read)
+}
+
+// WritePos is the absolute position the next written sample will take
+func (r *ringBuffer) WritePos() uint64 {
+	return atomic.LoadUint64(&r.write)
+}
+
+// captureMeta records where a callback's samples landed in the ring and
+// when they were captured
+type captureMeta struct {
+	pos   uint64 // ring position of the first sample
+	index uint64 // frame index of the first sample
+	adc   time.Duration
+	wall  time.Time
+}
+
+// metaRing is a single-producer single-consumer queue of captureMeta, one
+// entry per callback, written and read alongside a ringBuffer
+type metaRing struct {
+	read  uint64
+	write uint64
+
+	data []captureMeta
+	mask uint64
+}
+
+func newMetaRing(size int) *metaRing {
+	n := 1
+	for n < size {
+		n <<= 1
+	}
+
+	return &metaRing{
+		data: make([]captureMeta, n),
+		mask: uint64(n - 1),
+	}
+}
+
+// Push adds an entry, or reports false if the ring is full
+func (r *metaRing) Push(m captureMeta) bool {
+	write := atomic.LoadUint64(&r.write)
+	if write-atomic.LoadUint64(&r.read) == uint64(len(r.data)) {
+		return false
+	}
+
+	r.data[write&r.mask] = m
+	atomic.StoreUint64(&r.write, write+1)
+	return true
+}
+
+// Peek returns the oldest entry without removing it
+func (r *metaRing) Peek() (captureMeta, bool) {
+	read := atomic.LoadUint64(&r.read)
+	if read == atomic.LoadUint64(&r.write) {
+		return captureMeta{}, false
+	}
+
+	return r.data[read&r.mask], true
+}
+
+func (r *metaRing) Pop() {
+	atomic.AddUint64(&r.read, 1)
+}
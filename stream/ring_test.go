@@ -0,0 +1,75 @@
+package stream
+
+import (
+	"runtime"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRingBufferWrap(t *testing.T) {
+	r := newRingBuffer(5)
+	assert.Equal(t, 8, r.Cap())
+
+	out := make([]int32, 4)
+	for i := 0; i < 10; i++ {
+		n := r.Write([]int32{1, 2, 3, 4, 5, 6})
+		assert.Equal(t, 6, n)
+
+		assert.Equal(t, 4, r.Read(out))
+		assert.Equal(t, []int32{1, 2, 3, 4}, out)
+		assert.Equal(t, 2, r.Read(out))
+		assert.Equal(t, []int32{5, 6}, out[:2])
+	}
+}
+
+func TestRingBufferOverrun(t *testing.T) {
+	r := newRingBuffer(8)
+	assert.Equal(t, 6, r.Write(make([]int32, 6)))
+	assert.Equal(t, 2, r.Write(make([]int32, 6)))
+	assert.Equal(t, 0, r.Write(make([]int32, 1)))
+	assert.Equal(t, 8, r.Len())
+
+	r.Reset()
+	assert.Equal(t, 0, r.Len())
+}
+
+func TestRingBufferConcurrent(t *testing.T) {
+	const total = 1 << 16
+	r := newRingBuffer(64)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		next := int32(0)
+		chunk := make([]int32, 7)
+		for next < total {
+			for i := range chunk {
+				chunk[i] = next + int32(i)
+			}
+			n := r.Write(chunk)
+			if n == 0 {
+				runtime.Gosched()
+			}
+			next += int32(n)
+		}
+	}()
+
+	expected := int32(0)
+	buf := make([]int32, 5)
+	for expected < total {
+		n := r.Read(buf)
+		if n == 0 {
+			runtime.Gosched()
+		}
+		for _, sample := range buf[:n] {
+			if sample != expected {
+				t.Fatalf("expected %d, got %d", expected, sample)
+			}
+			expected++
+		}
+	}
+	wg.Wait()
+}
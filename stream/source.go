@@ -0,0 +1,11 @@
+package stream
+
+import "context"
+
+// Source produces timestamped buffers of interleaved samples. Stream is the PortAudio
+// implementation; anything else that satisfies it can drive a Recorder.
+type Source interface {
+	Start() error
+	Read(ctx context.Context) (*Buffer, error)
+	Close() error
+}
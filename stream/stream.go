@@ -2,137 +2,138 @@ package stream
 
 import (
 	"errors"
-	"log"
-	"sync"
+	"fmt"
+	"time"
 
-	"github.com/gordonklaus/portaudio"
+	"github.com/garlicgarrison/go-recorder/resample"
 )
 
 const (
 	DefaultInputChannels   = 1
 	DefaultSampleRate      = 22050
 	DefaultFramesPerBuffer = 64
+	DefaultRingBufferSize  = 16384 // samples, ~740ms at the default rate
+	DefaultStallTimeout    = time.Second
 )
 
+// StreamState is a step in the stream lifecycle:
+//
+//	Opened -> Started <-> Paused -> Stopped -> Closed
+//
+// A stopped stream can be started again, and starting a closed stream
+// reopens the device.
 type StreamState string
 
 const (
-	Closed  = "closed"
-	Started = "started"
-	Opened  = "opened"
+	Opened  StreamState = "opened"
+	Started StreamState = "started"
+	Paused  StreamState = "paused"
+	Stopped StreamState = "stopped"
+	Closed  StreamState = "closed"
+)
+
+// CaptureMode selects how samples are pulled from PortAudio
+type CaptureMode string
+
+const (
+	// BlockingMode reads from PortAudio on the caller's goroutine
+	BlockingMode CaptureMode = "blocking"
+
+	// CallbackMode lets PortAudio push samples into a preallocated ring
+	// buffer from its own thread, so a slow consumer only shrinks the
+	// ring's headroom instead of overflowing the device
+	CallbackMode CaptureMode = "callback"
 )
 
 var (
-	ErrAlreadyStarted = errors.New("stream already started")
-	ErrAlreadyOpened  = errors.New("stream already opened")
+	ErrAlreadyStarted    = errors.New("stream already started")
+	ErrAlreadyOpened     = errors.New("stream already opened")
+	ErrInvalidTransition = errors.New("invalid stream state transition")
+	ErrNotStarted        = errors.New("stream not started")
+	ErrDeviceNotFound    = errors.New("input device not found")
+	ErrNoPortAudio       = errors.New("built without portaudio")
+	ErrUnsupportedRate   = errors.New("device supports none of the candidate sample rates")
+	ErrStalled           = errors.New("device stopped delivering audio")
 )
 
-type StreamConfig struct {
-	SampleRate      float64
-	InputChannels   int
-	FramesPerBuffer int
+// TransitionError is returned when a lifecycle method is called from a
+// state it cannot leave. It matches ErrInvalidTransition, and
+// ErrAlreadyStarted when starting a started stream.
+type TransitionError struct {
+	From StreamState
+	To   StreamState
 }
 
-// Singleton
-type Stream struct {
-	cfg    *StreamConfig
-	stream *portaudio.Stream
-	mutex  *sync.Mutex
-	state  StreamState
-	buffer []int32
+func (e *TransitionError) Error() string {
+	return fmt.Sprintf("cannot move stream from %s to %s", e.From, e.To)
 }
 
-func DefaultStreamConfig() *StreamConfig {
-	return &StreamConfig{
-		SampleRate:      DefaultSampleRate,
-		InputChannels:   DefaultInputChannels,
-		FramesPerBuffer: DefaultFramesPerBuffer,
+func (e *TransitionError) Is(target error) bool {
+	switch target {
+	case ErrInvalidTransition:
+		return true
+	case ErrAlreadyStarted:
+		return e.From == Started && e.To == Started
 	}
+
+	return false
 }
 
-func NewStream(cfg *StreamConfig) (*Stream, error) {
-	err := portaudio.Initialize()
-	if err != nil {
-		return nil, err
-	}
+type StreamConfig struct {
+	SampleRate      float64
+	InputChannels   int
+	FramesPerBuffer int
 
-	buffer := make([]int32, cfg.FramesPerBuffer)
-	stream, err := portaudio.OpenDefaultStream(
-		cfg.InputChannels,
-		0,
-		cfg.SampleRate,
-		cfg.FramesPerBuffer,
-		buffer,
-	)
-	if err != nil {
-		return nil, err
-	}
+	Mode CaptureMode
 
-	return &Stream{
-		cfg:    cfg,
-		stream: stream,
-		mutex:  &sync.Mutex{},
-		state:  Opened,
-		buffer: buffer,
-	}, nil
-}
+	// samples, only used in CallbackMode
+	RingBufferSize int
 
-func (s *Stream) Start() error {
-	switch s.state {
-	case Opened:
-		return s.stream.Start()
-	case Closed:
-		buffer := make([]int32, s.cfg.FramesPerBuffer)
-		stream, err := portaudio.OpenDefaultStream(
-			s.cfg.InputChannels,
-			0,
-			s.cfg.SampleRate,
-			s.cfg.FramesPerBuffer,
-			buffer,
-		)
-		if err != nil {
-			log.Printf("open default stream error -- %s", err)
-			return err
-		}
-
-		s.buffer = buffer
-		s.stream = stream
-		s.state = Started
-		stream.Start()
-
-		return nil
-	case Started:
-		return ErrAlreadyStarted
-	}
+	// CallbackMode only: Read fails with ErrStalled when the device has not
+	// called back for this long, as when it is unplugged; 0 is
+	// DefaultStallTimeout
+	StallTimeout time.Duration
+
+	// empty opens the default input device
+	DeviceName string
 
-	return nil
+	// used when the device cannot run at SampleRate and is opened at the
+	// closest rate it supports instead; empty means resample.Sinc
+	ResampleQuality resample.Quality
 }
 
-func (s *Stream) Close() error {
-	err := s.stream.Close()
-	if err != nil {
-		return err
-	}
+// Stats counts capture dropouts since the stream was created
+type Stats struct {
+	Mode  CaptureMode
+	State StreamState
 
-	s.state = Closed
-	return nil
-}
+	// callback mode: callbacks that found the ring full, and the samples lost
+	Overruns       uint64
+	DroppedSamples uint64
 
-func (s *Stream) Read() ([]int32, error) {
-	s.mutex.Lock()
-	defer s.mutex.Unlock()
+	// callback mode: reads that had to wait for the device
+	Underruns uint64
 
-	err := s.stream.Read()
-	if err != nil {
-		return nil, err
-	}
+	// reported by PortAudio in either mode
+	InputOverflows  uint64
+	InputUnderflows uint64
+
+	// samples waiting in the ring buffer
+	Buffered int
 
-	toRet := make([]int32, s.cfg.FramesPerBuffer)
-	copy(toRet, s.buffer)
-	return toRet, nil
+	// the rate the device was opened at, and the resampler converting it
+	// to the configured rate, empty when the two match
+	NativeRate      float64
+	ResampleQuality resample.Quality
 }
 
-// Terminates portaudio
-func (s *Stream) Terminate() {
-	portaudio.Terminate()
+func DefaultStreamConfig() *StreamConfig {
+	return &StreamConfig{
+		SampleRate:      DefaultSampleRate,
+		InputChannels:   DefaultInputChannels,
+		FramesPerBuffer: DefaultFramesPerBuffer,
+		Mode:            BlockingMode,
+		RingBufferSize:  DefaultRingBufferSize,
+		ResampleQuality: resample.Sinc,
+	}
 }
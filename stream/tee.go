@@ -0,0 +1,339 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	DefaultQueueSize = 64
+)
+
+// QueuePolicy decides what a subscriber's queue does when it is full
+type QueuePolicy string
+
+const (
+	// DropOldest discards the oldest queued buffer to make room
+	DropOldest QueuePolicy = "drop_oldest"
+
+	// DropNewest discards the incoming buffer
+	DropNewest QueuePolicy = "drop_newest"
+
+	// Backpressure blocks the tee, and so every other subscriber, until
+	// the subscriber catches up
+	Backpressure QueuePolicy = "backpressure"
+)
+
+var (
+	ErrTeeClosed    = errors.New("tee closed")
+	ErrUnsubscribed = errors.New("subscriber closed")
+)
+
+type SubscriberConfig struct {
+	QueueSize int
+	Policy    QueuePolicy
+}
+
+// SubscriberStats describes how far a subscriber is behind the source
+type SubscriberStats struct {
+	Delivered uint64
+	Dropped   uint64
+
+	// buffers waiting to be read, and the most there have ever been
+	Queued    int
+	MaxQueued int
+}
+
+func DefaultSubscriberConfig() *SubscriberConfig {
+	return &SubscriberConfig{
+		QueueSize: DefaultQueueSize,
+		Policy:    DropOldest,
+	}
+}
+
+// Tee reads a single Source on its own goroutine and hands every buffer to
+// all of its subscribers. Buffers are shared between subscribers, so they
+// must be treated as read only. Dropped buffers show up as gaps in the
+// subscriber's buffer indexes.
+type Tee struct {
+	src Source
+
+	mutex   *sync.Mutex
+	subs    map[*Subscriber]*subscription
+	started bool
+	err     error
+	cancel  context.CancelFunc
+	done    chan struct{}
+}
+
+func NewTee(src Source) *Tee {
+	return &Tee{
+		src:   src,
+		mutex: &sync.Mutex{},
+		subs:  map[*Subscriber]*subscription{},
+	}
+}
+
+// Subscribe adds a consumer. It only sees buffers read after it subscribed.
+func (t *Tee) Subscribe(cfg *SubscriberConfig) *Subscriber {
+	if cfg == nil {
+		cfg = DefaultSubscriberConfig()
+	}
+	size := cfg.QueueSize
+	if size <= 0 {
+		size = DefaultQueueSize
+	}
+
+	s := &Subscriber{
+		tee:    t,
+		policy: cfg.Policy,
+		size:   size,
+	}
+	t.mutex.Lock()
+	s.current = newSubscription(size)
+	t.subs[s] = s.current
+	t.mutex.Unlock()
+
+	return s
+}
+
+// Start starts the source and the goroutine that fans it out. Calling it on
+// a running tee is a no-op so every subscriber can call it.
+func (t *Tee) Start() error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.started {
+		return nil
+	}
+
+	err := t.src.Start()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.started = true
+	t.err = nil
+	t.cancel = cancel
+	t.done = make(chan struct{})
+	go t.run(ctx, t.done)
+
+	return nil
+}
+
+// Close stops reading, closes the source and ends every subscriber
+func (t *Tee) Close() error {
+	t.mutex.Lock()
+	if !t.started {
+		t.mutex.Unlock()
+		return nil
+	}
+	t.started = false
+	t.cancel()
+	done := t.done
+	t.mutex.Unlock()
+
+	// the read is cancelled before the source goes away underneath it
+	<-done
+	return t.src.Close()
+}
+
+// Err returns the error that stopped the tee, if any
+func (t *Tee) Err() error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	return t.err
+}
+
+func (t *Tee) run(ctx context.Context, done chan struct{}) {
+	defer close(done)
+
+	for {
+		buffer, err := t.src.Read(ctx)
+		if ctx.Err() != nil {
+			t.finish(ErrTeeClosed)
+			return
+		}
+		if err != nil {
+			t.finish(err)
+			return
+		}
+
+		t.mutex.Lock()
+		subs := make([]*Subscriber, 0, len(t.subs))
+		queues := make([]*subscription, 0, len(t.subs))
+		for s, sub := range t.subs {
+			subs = append(subs, s)
+			queues = append(queues, sub)
+		}
+		t.mutex.Unlock()
+
+		// each subscriber gets its own reference to the shared buffer
+		for i, s := range subs {
+			s.deliver(ctx, queues[i], buffer.Retain())
+		}
+		buffer.Release()
+	}
+}
+
+// finish records why the tee stopped and wakes every blocked reader
+func (t *Tee) finish(err error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.err = err
+	for _, sub := range t.subs {
+		sub.end()
+	}
+	t.subs = map[*Subscriber]*subscription{}
+}
+
+func (t *Tee) remove(s *Subscriber) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if sub, ok := t.subs[s]; ok {
+		delete(t.subs, s)
+		sub.end()
+	}
+}
+
+// Subscriber is a Source fed by a Tee. Close unsubscribes it and Start
+// subscribes it again with an empty queue. Buffers from Read should be
+// released once used.
+type Subscriber struct {
+	// counters are accessed atomically and kept first for 64-bit alignment
+	delivered uint64
+	dropped   uint64
+	maxQueued int64
+
+	tee    *Tee
+	policy QueuePolicy
+	size   int
+
+	current *subscription // guarded by the tee's mutex
+}
+
+// subscription is the queue of one subscribe. Start replaces it rather than
+// reusing it, as the tee may still be delivering to the old one.
+type subscription struct {
+	queue  chan *Buffer
+	closed chan struct{}
+	once   *sync.Once
+}
+
+func newSubscription(size int) *subscription {
+	return &subscription{
+		queue:  make(chan *Buffer, size),
+		closed: make(chan struct{}),
+		once:   &sync.Once{},
+	}
+}
+
+func (sub *subscription) end() {
+	sub.once.Do(func() { close(sub.closed) })
+}
+
+func (s *Subscriber) subscription() *subscription {
+	s.tee.mutex.Lock()
+	defer s.tee.mutex.Unlock()
+
+	return s.current
+}
+
+func (s *Subscriber) Start() error {
+	s.tee.mutex.Lock()
+	select {
+	case <-s.current.closed:
+		s.current = newSubscription(s.size)
+		s.tee.subs[s] = s.current
+	default:
+	}
+	s.tee.mutex.Unlock()
+
+	return s.tee.Start()
+}
+
+func (s *Subscriber) Read(ctx context.Context) (*Buffer, error) {
+	sub := s.subscription()
+
+	// drain what was queued before looking at whether the tee has ended
+	select {
+	case buffer := <-sub.queue:
+		return buffer, nil
+	default:
+	}
+
+	select {
+	case buffer := <-sub.queue:
+		return buffer, nil
+	case <-sub.closed:
+		if err := s.tee.Err(); err != nil && !errors.Is(err, ErrTeeClosed) {
+			return nil, err
+		}
+		return nil, ErrUnsubscribed
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Close unsubscribes without stopping the tee
+func (s *Subscriber) Close() error {
+	s.tee.remove(s)
+	return nil
+}
+
+func (s *Subscriber) Stats() SubscriberStats {
+	return SubscriberStats{
+		Delivered: atomic.LoadUint64(&s.delivered),
+		Dropped:   atomic.LoadUint64(&s.dropped),
+		Queued:    len(s.subscription().queue),
+		MaxQueued: int(atomic.LoadInt64(&s.maxQueued)),
+	}
+}
+
+func (s *Subscriber) deliver(ctx context.Context, sub *subscription, buffer *Buffer) {
+	switch s.policy {
+	case Backpressure:
+		select {
+		case sub.queue <- buffer:
+		case <-sub.closed:
+			buffer.Release()
+			return
+		case <-ctx.Done():
+			buffer.Release()
+			return
+		}
+	case DropNewest:
+		select {
+		case sub.queue <- buffer:
+		default:
+			buffer.Release()
+			atomic.AddUint64(&s.dropped, 1)
+			return
+		}
+	default:
+		// the tee is the only sender, so after freeing a slot the send
+		// cannot fail
+		select {
+		case sub.queue <- buffer:
+		default:
+			select {
+			case oldest := <-sub.queue:
+				oldest.Release()
+				atomic.AddUint64(&s.dropped, 1)
+			default:
+			}
+			sub.queue <- buffer
+		}
+	}
+
+	atomic.AddUint64(&s.delivered, 1)
+	if queued := int64(len(sub.queue)); queued > atomic.LoadInt64(&s.maxQueued) {
+		atomic.StoreInt64(&s.maxQueued, queued)
+	}
+}
@@ -0,0 +1,153 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var errTestSourceDone = errors.New("test source done")
+
+// testSource hands out numbered buffers and then fails
+type testSource struct {
+	mutex   sync.Mutex
+	n       int
+	max     int
+	release chan struct{}
+}
+
+func (s *testSource) Start() error { return nil }
+func (s *testSource) Close() error { return nil }
+
+func (s *testSource) Read(ctx context.Context) (*Buffer, error) {
+	if s.release != nil {
+		select {
+		case <-s.release:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.n >= s.max {
+		return nil, errTestSourceDone
+	}
+	s.n++
+	return &Buffer{Samples: []int32{int32(s.n)}, Frames: 1, Index: uint64(s.n - 1)}, nil
+}
+
+func readAll(t *testing.T, s *Subscriber) []int32 {
+	got := []int32{}
+	for {
+		buffer, err := s.Read(context.Background())
+		if err != nil {
+			assert.ErrorIs(t, err, errTestSourceDone)
+			return got
+		}
+		got = append(got, buffer.Samples[0])
+	}
+}
+
+func TestTeeBackpressure(t *testing.T) {
+	tee := NewTee(&testSource{max: 100})
+	a := tee.Subscribe(&SubscriberConfig{QueueSize: 1, Policy: Backpressure})
+	b := tee.Subscribe(&SubscriberConfig{QueueSize: 4, Policy: Backpressure})
+	assert.NoError(t, tee.Start())
+
+	var wg sync.WaitGroup
+	results := make([][]int32, 2)
+	for i, s := range []*Subscriber{a, b} {
+		wg.Add(1)
+		go func(i int, s *Subscriber) {
+			defer wg.Done()
+			results[i] = readAll(t, s)
+		}(i, s)
+	}
+	wg.Wait()
+
+	for _, got := range results {
+		assert.Len(t, got, 100)
+		for i, v := range got {
+			assert.Equal(t, int32(i+1), v)
+		}
+	}
+	assert.Equal(t, uint64(0), a.Stats().Dropped)
+	assert.Equal(t, uint64(100), b.Stats().Delivered)
+}
+
+func TestTeeDropPolicies(t *testing.T) {
+	release := make(chan struct{})
+	tee := NewTee(&testSource{max: 10, release: release})
+	oldest := tee.Subscribe(&SubscriberConfig{QueueSize: 3, Policy: DropOldest})
+	newest := tee.Subscribe(&SubscriberConfig{QueueSize: 3, Policy: DropNewest})
+	assert.NoError(t, tee.Start())
+
+	// nobody reads until the source is exhausted
+	for i := 0; i < 11; i++ {
+		release <- struct{}{}
+	}
+
+	assert.Equal(t, []int32{8, 9, 10}, readAll(t, oldest))
+	assert.Equal(t, []int32{1, 2, 3}, readAll(t, newest))
+	assert.Equal(t, uint64(7), oldest.Stats().Dropped)
+	assert.Equal(t, uint64(7), newest.Stats().Dropped)
+	assert.Equal(t, 3, newest.Stats().MaxQueued)
+}
+
+func TestTeeUnsubscribe(t *testing.T) {
+	release := make(chan struct{})
+	tee := NewTee(&testSource{max: 10, release: release})
+	s := tee.Subscribe(nil)
+	assert.NoError(t, tee.Start())
+
+	assert.NoError(t, s.Close())
+	_, err := s.Read(context.Background())
+	assert.ErrorIs(t, err, ErrUnsubscribed)
+
+	assert.NoError(t, tee.Close())
+	assert.ErrorIs(t, tee.Err(), ErrTeeClosed)
+}
+
+func TestSubscriberReadCancel(t *testing.T) {
+	tee := NewTee(&testSource{max: 10, release: make(chan struct{})})
+	s := tee.Subscribe(nil)
+	assert.NoError(t, s.Start())
+	defer tee.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := s.Read(ctx)
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+// resubscribing while the tee delivers swaps the queue under the tee, so
+// this is clean under -race
+func TestSubscriberRestart(t *testing.T) {
+	tee := NewTee(&testSource{max: 1 << 30})
+	s := tee.Subscribe(&SubscriberConfig{QueueSize: 2, Policy: Backpressure})
+	assert.NoError(t, s.Start())
+	defer tee.Close()
+
+	for i := 0; i < 100; i++ {
+		buffer, err := s.Read(context.Background())
+		assert.NoError(t, err)
+		buffer.Release()
+
+		// what was queued is still read before the end
+		assert.NoError(t, s.Close())
+		for {
+			buffer, err = s.Read(context.Background())
+			if err != nil {
+				break
+			}
+			buffer.Release()
+		}
+		assert.ErrorIs(t, err, ErrUnsubscribed)
+		assert.NoError(t, s.Start())
+	}
+}
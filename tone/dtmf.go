@@ -0,0 +1,179 @@
+package tone
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/garlicgarrison/go-recorder/dsp"
+)
+
+const (
+	DefaultDTMFMinLevel    = -40.0 // dBFS of the block
+	DefaultDTMFMinDuration = 40    // milliseconds
+
+	// the classic block: 205 samples at 8kHz puts every DTMF frequency
+	// near the centre of a bin
+	dtmfBlockTime = 205.0 / 8000 // seconds
+
+	// the strongest tone of a group must beat the others by 6dB
+	dtmfPeakRatio = 4.0
+
+	// the row and column tone may differ by up to 8dB
+	dtmfMaxTwist = 6.3
+
+	// fraction of the block's power the two tones must hold
+	dtmfMinPurity = 0.7
+)
+
+var (
+	dtmfRows    = [4]float64{697, 770, 852, 941}
+	dtmfColumns = [4]float64{1209, 1336, 1477, 1633}
+	dtmfKeys    = [4][4]string{
+		{"1", "2", "3", "A"},
+		{"4", "5", "6", "B"},
+		{"7", "8", "9", "C"},
+		{"*", "0", "#", "D"},
+	}
+)
+
+type DTMFConfig struct {
+	SampleRate    float64
+	InputChannels int
+
+	// dB below full scale a block must reach to hold a key
+	MinLevel float64
+
+	// milliseconds a key must be held to count, rounded up to whole
+	// blocks, and released before it counts again
+	MinDuration int
+}
+
+func DefaultDTMFConfig() *DTMFConfig {
+	return &DTMFConfig{
+		SampleRate:    22050,
+		InputChannels: 1,
+		MinLevel:      DefaultDTMFMinLevel,
+		MinDuration:   DefaultDTMFMinDuration,
+	}
+}
+
+// DTMFDetector hears the keys of a phone keypad: each block's power at the
+// four row and four column frequencies is measured with the Goertzel
+// algorithm, and a key counts when one row and one column stand out, hold
+// most of the block's power, and last MinDuration.
+type DTMFDetector struct {
+	cfg      *DTMFConfig
+	handler  func(Event)
+	blocks   blocks
+	debounce debounce
+	minPower float64
+
+	rows, columns [4]*dsp.Goertzel
+}
+
+func NewDTMFDetector(cfg *DTMFConfig) (*DTMFDetector, error) {
+	switch {
+	case cfg == nil:
+		return nil, ErrInvalidConfig
+	case cfg.SampleRate < 2*dtmfColumns[3]*1.2:
+		return nil, fmt.Errorf("%w: SampleRate must be at least %gHz for DTMF", ErrInvalidConfig, math.Ceil(2*dtmfColumns[3]*1.2))
+	case cfg.InputChannels <= 0:
+		return nil, fmt.Errorf("%w: InputChannels must be positive", ErrInvalidConfig)
+	case cfg.MinLevel > 0:
+		return nil, fmt.Errorf("%w: MinLevel must not be above full scale", ErrInvalidConfig)
+	case cfg.MinDuration < 0:
+		return nil, fmt.Errorf("%w: MinDuration must not be negative", ErrInvalidConfig)
+	}
+
+	length := int(math.Round(cfg.SampleRate * dtmfBlockTime))
+	d := &DTMFDetector{
+		cfg:      cfg,
+		blocks:   newBlocks(cfg.InputChannels, length),
+		debounce: debounce{blocks: blocksFor(cfg.MinDuration, length, cfg.SampleRate)},
+		minPower: fromDBFS(cfg.MinLevel),
+	}
+	for i := range dtmfRows {
+		d.rows[i] = dsp.NewGoertzel(dtmfRows[i], cfg.SampleRate)
+		d.columns[i] = dsp.NewGoertzel(dtmfColumns[i], cfg.SampleRate)
+	}
+	return d, nil
+}
+
+// OnEvent sets a handler that Process calls for each key as it counts
+func (d *DTMFDetector) OnEvent(handler func(Event)) {
+	d.handler = handler
+}
+
+func (d *DTMFDetector) Process(samples []int32) []Event {
+	var events []Event
+	d.blocks.add(samples, func(block []float64, start uint64) {
+		if e, ok := d.debounce.next(d.key(block), start); ok {
+			events = append(events, e)
+			if d.handler != nil {
+				d.handler(e)
+			}
+		}
+	})
+	return events
+}
+
+// key is the key a block holds, "" for none
+func (d *DTMFDetector) key(block []float64) string {
+	power := meanSquare(block)
+	if power < d.minPower {
+		return ""
+	}
+
+	row, rowPower, ok := strongest(d.rows, block)
+	if !ok {
+		return ""
+	}
+	column, columnPower, ok := strongest(d.columns, block)
+	if !ok {
+		return ""
+	}
+
+	twist := rowPower / columnPower
+	if twist > dtmfMaxTwist || twist < 1/dtmfMaxTwist {
+		return ""
+	}
+	if rowPower+columnPower < dtmfMinPurity*power {
+		return ""
+	}
+	return dtmfKeys[row][column]
+}
+
+// strongest is the frequency of a group with the most power in a block,
+// and whether it stands out from the rest
+func strongest(group [4]*dsp.Goertzel, block []float64) (int, float64, bool) {
+	var powers [4]float64
+	best := 0
+	for i, g := range group {
+		powers[i] = g.Power(block)
+		if powers[i] > powers[best] {
+			best = i
+		}
+	}
+
+	for i, p := range powers {
+		if i != best && p*dtmfPeakRatio > powers[best] {
+			return 0, 0, false
+		}
+	}
+	return best, powers[best], true
+}
+
+func (d *DTMFDetector) Reset() {
+	d.blocks.reset()
+	d.debounce.reset()
+}
+
+// blocksFor is the number of blocks of length samples covering ms
+// milliseconds, at least one
+func blocksFor(ms, length int, rate float64) int {
+	n := int(math.Ceil(float64(ms) / 1000 * rate / float64(length)))
+	if n < 1 {
+		n = 1
+	}
+	return n
+}
@@ -0,0 +1,185 @@
+package tone
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// phoneConfig is the default config at the 8kHz the test calls are made at
+func phoneConfig() *DTMFConfig {
+	cfg := DefaultDTMFConfig()
+	cfg.SampleRate = 8000
+	return cfg
+}
+
+// press synthesizes a key held for ms milliseconds at 8kHz
+func press(key string, ms int) []int32 {
+	return pressAt(key, ms, 8000)
+}
+
+func pressAt(key string, ms int, rate float64) []int32 {
+	var row, column float64
+	for r := range dtmfKeys {
+		for c := range dtmfKeys[r] {
+			if dtmfKeys[r][c] == key {
+				row, column = dtmfRows[r], dtmfColumns[c]
+			}
+		}
+	}
+
+	samples := make([]int32, int(float64(ms)*rate/1000))
+	for i := range samples {
+		t := float64(i) / rate
+		samples[i] = int32(3e8 * (math.Sin(2*math.Pi*row*t) + math.Sin(2*math.Pi*column*t)))
+	}
+	return samples
+}
+
+func hiss(ms int, rng *rand.Rand) []int32 {
+	samples := make([]int32, ms*8)
+	for i := range samples {
+		samples[i] = int32(rng.NormFloat64() * 1e6)
+	}
+	return samples
+}
+
+// dial presses each key for 70ms with 60ms between, over hiss
+func dial(keys string, rng *rand.Rand) []int32 {
+	samples := hiss(100, rng)
+	for _, key := range keys {
+		tone := press(string(key), 70)
+		noise := hiss(70, rng)
+		for i := range tone {
+			tone[i] += noise[i]
+		}
+		samples = append(samples, tone...)
+		samples = append(samples, hiss(60, rng)...)
+	}
+	return samples
+}
+
+// feed passes samples in buffers of 64
+func feed(d Detector, samples []int32) []Event {
+	var events []Event
+	for i := 0; i < len(samples); i += 64 {
+		end := i + 64
+		if end > len(samples) {
+			end = len(samples)
+		}
+		events = append(events, d.Process(samples[i:end])...)
+	}
+	return events
+}
+
+func TestDTMF(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	d, err := NewDTMFDetector(phoneConfig())
+	assert.NoError(t, err)
+
+	events := feed(d, dial("1234567890*#ABCD", rng))
+	assert.Equal(t, "1234567890*#ABCD", Digits(events))
+
+	// each key is placed within a block of where it was pressed
+	for i, e := range events {
+		pressed := uint64(8 * (100 + 130*i))
+		assert.InDelta(t, pressed, e.Offset, 205, "key %s", e.Symbol)
+	}
+}
+
+func TestDTMFHeldAndRepeated(t *testing.T) {
+	rng := rand.New(rand.NewSource(2))
+	d, err := NewDTMFDetector(phoneConfig())
+	assert.NoError(t, err)
+
+	// a long press counts once, a repeated key twice
+	samples := append(hiss(100, rng), press("5", 500)...)
+	samples = append(samples, dial("55", rng)...)
+	assert.Equal(t, "555", Digits(feed(d, samples)))
+}
+
+// the default config hears keys in the default recorder's 22050Hz stream
+func TestDTMFDefaultRate(t *testing.T) {
+	d, err := NewDTMFDetector(DefaultDTMFConfig())
+	assert.NoError(t, err)
+
+	silence := make([]int32, 2205)
+	samples := append(silence, pressAt("7", 100, 22050)...)
+	samples = append(samples, silence...)
+	samples = append(samples, pressAt("#", 100, 22050)...)
+	assert.Equal(t, "7#", Digits(feed(d, samples)))
+}
+
+func TestDTMFRejects(t *testing.T) {
+	rng := rand.New(rand.NewSource(3))
+	d, err := NewDTMFDetector(phoneConfig())
+	assert.NoError(t, err)
+
+	// a single tone, a blip too short, speech-like harmonics and hiss
+	samples := hiss(100, rng)
+	blip := press("9", 20)
+	samples = append(samples, blip...)
+	samples = append(samples, hiss(100, rng)...)
+	for i := 0; i < 8*300; i++ {
+		t := float64(i) / 8000
+		amp := 0.0
+		for h := 1; h <= 20; h++ {
+			amp += math.Sin(2*math.Pi*130*float64(h)*t) / float64(h)
+		}
+		samples = append(samples, int32(3e8*amp))
+	}
+	for i := 0; i < 8*300; i++ {
+		samples = append(samples, int32(5e8*math.Sin(2*math.Pi*697*float64(i)/8000)))
+	}
+	assert.Empty(t, feed(d, samples))
+
+	// too quiet
+	quiet := press("1", 100)
+	for i := range quiet {
+		quiet[i] /= 1000
+	}
+	assert.Empty(t, feed(d, quiet))
+}
+
+func TestDTMFStereo(t *testing.T) {
+	rng := rand.New(rand.NewSource(4))
+	cfg := phoneConfig()
+	cfg.InputChannels = 2
+	d, err := NewDTMFDetector(cfg)
+	assert.NoError(t, err)
+
+	var events []Event
+	d.OnEvent(func(e Event) { events = append(events, e) })
+
+	mono := dial("#", rng)
+	stereo := make([]int32, 0, 2*len(mono))
+	for _, amp := range mono {
+		stereo = append(stereo, amp, amp/4)
+	}
+	feed(d, stereo)
+	assert.Equal(t, "#", Digits(events))
+	assert.InDelta(t, 2*8*100, events[0].Offset, 2*205)
+
+	d.Reset()
+	events = nil
+	feed(d, stereo)
+	assert.InDelta(t, 2*8*100, events[0].Offset, 2*205)
+}
+
+func TestDTMFConfig(t *testing.T) {
+	for _, breakConfig := range []func(*DTMFConfig){
+		func(c *DTMFConfig) { c.SampleRate = 1000 },
+		func(c *DTMFConfig) { c.InputChannels = 0 },
+		func(c *DTMFConfig) { c.MinLevel = 3 },
+		func(c *DTMFConfig) { c.MinDuration = -1 },
+	} {
+		cfg := DefaultDTMFConfig()
+		breakConfig(cfg)
+		_, err := NewDTMFDetector(cfg)
+		assert.ErrorIs(t, err, ErrInvalidConfig)
+	}
+	_, err := NewDTMFDetector(nil)
+	assert.ErrorIs(t, err, ErrInvalidConfig)
+}
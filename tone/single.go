@@ -0,0 +1,130 @@
+package tone
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/garlicgarrison/go-recorder/dsp"
+)
+
+const (
+	DefaultToneFrequency   = 1000.0 // Hz
+	DefaultToneMinLevel    = -40.0  // dBFS of the block
+	DefaultToneMinDuration = 100    // milliseconds
+	DefaultTonePurity      = 0.8
+	DefaultToneBlockTime   = 10 // milliseconds
+)
+
+type ToneConfig struct {
+	SampleRate    float64
+	InputChannels int
+
+	// Hz, and the symbol of its events, empty meaning the frequency, as
+	// in "1000Hz"
+	Frequency float64
+	Name      string
+
+	// dB below full scale a block must reach to hold the tone
+	MinLevel float64
+
+	// milliseconds the tone must last to count, rounded up to whole
+	// blocks, and stop before it counts again
+	MinDuration int
+
+	// fraction of a block's power that must be at the frequency
+	Purity float64
+
+	// milliseconds per block. Longer blocks tell nearby frequencies apart
+	// better, shorter ones place the tone more precisely.
+	BlockTime int
+}
+
+func DefaultToneConfig() *ToneConfig {
+	return &ToneConfig{
+		SampleRate:    22050,
+		InputChannels: 1,
+		Frequency:     DefaultToneFrequency,
+		MinLevel:      DefaultToneMinLevel,
+		MinDuration:   DefaultToneMinDuration,
+		Purity:        DefaultTonePurity,
+		BlockTime:     DefaultToneBlockTime,
+	}
+}
+
+// ToneDetector hears a single steady tone, such as a sync beep: a block
+// holds the tone when most of its power is at the frequency, measured with
+// the Goertzel algorithm
+type ToneDetector struct {
+	cfg      *ToneConfig
+	name     string
+	handler  func(Event)
+	blocks   blocks
+	debounce debounce
+	minPower float64
+	goertzel *dsp.Goertzel
+}
+
+func NewToneDetector(cfg *ToneConfig) (*ToneDetector, error) {
+	switch {
+	case cfg == nil:
+		return nil, ErrInvalidConfig
+	case cfg.SampleRate <= 0:
+		return nil, fmt.Errorf("%w: SampleRate must be positive", ErrInvalidConfig)
+	case cfg.InputChannels <= 0:
+		return nil, fmt.Errorf("%w: InputChannels must be positive", ErrInvalidConfig)
+	case cfg.Frequency <= 0 || cfg.Frequency >= cfg.SampleRate/2:
+		return nil, fmt.Errorf("%w: Frequency must be between 0 and half the SampleRate", ErrInvalidConfig)
+	case cfg.MinLevel > 0:
+		return nil, fmt.Errorf("%w: MinLevel must not be above full scale", ErrInvalidConfig)
+	case cfg.MinDuration < 0:
+		return nil, fmt.Errorf("%w: MinDuration must not be negative", ErrInvalidConfig)
+	case cfg.Purity <= 0 || cfg.Purity > 1:
+		return nil, fmt.Errorf("%w: Purity must be above 0 and at most 1", ErrInvalidConfig)
+	case cfg.BlockTime <= 0:
+		return nil, fmt.Errorf("%w: BlockTime must be positive", ErrInvalidConfig)
+	}
+
+	length := int(math.Max(1, math.Round(cfg.SampleRate*float64(cfg.BlockTime)/1000)))
+	name := cfg.Name
+	if name == "" {
+		name = fmt.Sprintf("%gHz", cfg.Frequency)
+	}
+
+	return &ToneDetector{
+		cfg:      cfg,
+		name:     name,
+		blocks:   newBlocks(cfg.InputChannels, length),
+		debounce: debounce{blocks: blocksFor(cfg.MinDuration, length, cfg.SampleRate)},
+		minPower: fromDBFS(cfg.MinLevel),
+		goertzel: dsp.NewGoertzel(cfg.Frequency, cfg.SampleRate),
+	}, nil
+}
+
+// OnEvent sets a handler that Process calls for each tone as it counts
+func (d *ToneDetector) OnEvent(handler func(Event)) {
+	d.handler = handler
+}
+
+func (d *ToneDetector) Process(samples []int32) []Event {
+	var events []Event
+	d.blocks.add(samples, func(block []float64, start uint64) {
+		symbol := ""
+		power := meanSquare(block)
+		if power >= d.minPower && d.goertzel.Power(block) >= d.cfg.Purity*power {
+			symbol = d.name
+		}
+
+		if e, ok := d.debounce.next(symbol, start); ok {
+			events = append(events, e)
+			if d.handler != nil {
+				d.handler(e)
+			}
+		}
+	})
+	return events
+}
+
+func (d *ToneDetector) Reset() {
+	d.blocks.reset()
+	d.debounce.reset()
+}
@@ -0,0 +1,204 @@
+// Package tone detects DTMF keys and single tones in a stream of buffers,
+// for control cues like "press 1 to start" and sync beeps.
+package tone
+
+import (
+	"errors"
+	"math"
+	"strings"
+
+	"github.com/garlicgarrison/go-recorder/dsp"
+)
+
+const (
+	// samples are full scale at this amplitude
+	fullScale = math.MaxInt32
+)
+
+var (
+	ErrInvalidConfig = errors.New("invalid tone config")
+)
+
+// Event is a tone heard long enough to count
+type Event struct {
+	// the DTMF key, or the Name of a single tone
+	Symbol string
+
+	// samples passed to Process since the detector was created or reset,
+	// up to the start of the block the tone was first heard in
+	Offset uint64
+}
+
+// Detector is a DTMFDetector or ToneDetector
+type Detector interface {
+	// Process takes the next interleaved samples and returns the tones
+	// that started counting in them
+	Process(samples []int32) []Event
+
+	// Reset forgets the samples so far and restarts the offsets
+	Reset()
+}
+
+// Digits joins the symbols of events, as the keys of a DTMF sequence
+func Digits(events []Event) string {
+	var b strings.Builder
+	for _, e := range events {
+		b.WriteString(e.Symbol)
+	}
+	return b.String()
+}
+
+// blocks cuts interleaved samples into mono blocks of a fixed length
+type blocks struct {
+	channels int
+	mixer    *dsp.Downmix
+	mono     []float64
+	block    []float64
+	frames   uint64 // mono samples taken
+	start    uint64 // offset of the block's first sample
+}
+
+func newBlocks(channels, length int) blocks {
+	return blocks{
+		channels: channels,
+		mixer:    dsp.NewDownmix(channels),
+		block:    make([]float64, 0, length),
+	}
+}
+
+// add takes samples and calls analyze with each full block and the offset
+// of its start
+func (b *blocks) add(samples []int32, analyze func(block []float64, start uint64)) {
+	b.mono = b.mixer.Add(samples, b.mono[:0])
+	for _, amp := range b.mono {
+		if len(b.block) == 0 {
+			b.start = b.frames * uint64(b.channels)
+		}
+		b.frames++
+
+		b.block = append(b.block, amp)
+		if len(b.block) == cap(b.block) {
+			analyze(b.block, b.start)
+			b.block = b.block[:0]
+		}
+	}
+}
+
+func (b *blocks) reset() {
+	b.block = b.block[:0]
+	b.frames = 0
+	b.start = 0
+	b.mixer.Reset()
+}
+
+// meanSquare is the power of a block
+func meanSquare(block []float64) float64 {
+	sum := 0.0
+	for _, x := range block {
+		sum += x * x
+	}
+	return sum / float64(len(block))
+}
+
+// fromDBFS converts a level in dB below full scale to a mean square
+func fromDBFS(db float64) float64 {
+	amplitude := fullScale * math.Pow(10, db/20)
+	return amplitude * amplitude / 2
+}
+
+// debounce confirms a symbol heard over enough consecutive blocks, and
+// releases it after as many blocks without it
+type debounce struct {
+	blocks int
+
+	candidate string
+	since     uint64
+	count     int
+
+	held   string
+	absent int
+}
+
+// next takes the symbol heard in a block, "" for none, and reports a
+// symbol confirmed by it
+func (d *debounce) next(symbol string, start uint64) (Event, bool) {
+	if d.held != "" {
+		if symbol == d.held {
+			d.absent = 0
+			return Event{}, false
+		}
+		d.absent++
+		if d.absent < d.blocks {
+			return Event{}, false
+		}
+		d.held = ""
+	}
+
+	if symbol == "" {
+		d.candidate = ""
+		d.count = 0
+		return Event{}, false
+	}
+	if symbol != d.candidate {
+		d.candidate = symbol
+		d.since = start
+		d.count = 0
+	}
+
+	d.count++
+	if d.count < d.blocks {
+		return Event{}, false
+	}
+
+	d.held = symbol
+	d.absent = 0
+	d.candidate = ""
+	d.count = 0
+	return Event{Symbol: symbol, Offset: d.since}, true
+}
+
+func (d *debounce) reset() {
+	*d = debounce{blocks: d.blocks}
+}
+
+// Trigger fires when a detector hears one of a set of symbols. It is a
+// recorder.Trigger, and knows where the cue began.
+type Trigger struct {
+	detector Detector
+	symbols  map[string]bool
+	cue      uint64
+}
+
+// NewTrigger fires on any of the symbols, or on any tone if none are given
+func NewTrigger(detector Detector, symbols ...string) *Trigger {
+	t := &Trigger{detector: detector}
+	if len(symbols) > 0 {
+		t.symbols = make(map[string]bool, len(symbols))
+		for _, s := range symbols {
+			t.symbols[s] = true
+		}
+	}
+	return t
+}
+
+func (t *Trigger) Process(samples []int32) bool {
+	fired := false
+	for _, e := range t.detector.Process(samples) {
+		if t.symbols == nil || t.symbols[e.Symbol] {
+			t.cue = e.Offset
+			fired = true
+		}
+	}
+	return fired
+}
+
+func (t *Trigger) Reset() {
+	t.detector.Reset()
+	t.cue = 0
+}
+
+// CueOffset is where the tone that last fired the trigger began, in
+// samples since the reset
+func (t *Trigger) CueOffset() uint64 {
+	return t.cue
+}
@@ -0,0 +1,92 @@
+package tone
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func beep(freq float64, ms int) []int32 {
+	samples := make([]int32, ms*8)
+	for i := range samples {
+		samples[i] = int32(5e8 * math.Sin(2*math.Pi*freq*float64(i)/8000))
+	}
+	return samples
+}
+
+func beepConfig() *ToneConfig {
+	cfg := DefaultToneConfig()
+	cfg.SampleRate = 8000
+	return cfg
+}
+
+func TestToneDetector(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	d, err := NewToneDetector(beepConfig())
+	assert.NoError(t, err)
+
+	// a sync beep, one too short, and one at another frequency
+	samples := hiss(200, rng)
+	samples = append(samples, beep(1000, 300)...)
+	samples = append(samples, hiss(200, rng)...)
+	samples = append(samples, beep(1000, 50)...)
+	samples = append(samples, hiss(200, rng)...)
+	samples = append(samples, beep(1400, 300)...)
+	samples = append(samples, hiss(200, rng)...)
+
+	events := feed(d, samples)
+	assert.Len(t, events, 1)
+	assert.Equal(t, "1000Hz", events[0].Symbol)
+	assert.InDelta(t, 8*200, events[0].Offset, 80)
+}
+
+func TestToneName(t *testing.T) {
+	cfg := beepConfig()
+	cfg.Frequency = 440
+	cfg.Name = "sync"
+	d, err := NewToneDetector(cfg)
+	assert.NoError(t, err)
+	assert.Equal(t, "sync", Digits(feed(d, beep(440, 200))))
+
+	for _, breakConfig := range []func(*ToneConfig){
+		func(c *ToneConfig) { c.Frequency = 4000 },
+		func(c *ToneConfig) { c.Purity = 0 },
+		func(c *ToneConfig) { c.BlockTime = 0 },
+		func(c *ToneConfig) { c.SampleRate = 0 },
+	} {
+		cfg := beepConfig()
+		breakConfig(cfg)
+		_, err := NewToneDetector(cfg)
+		assert.ErrorIs(t, err, ErrInvalidConfig)
+	}
+}
+
+func TestTrigger(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	d, err := NewDTMFDetector(phoneConfig())
+	assert.NoError(t, err)
+	trigger := NewTrigger(d, "#")
+
+	fired := 0
+	samples := dial("12#3", rng)
+	for i := 0; i < len(samples); i += 64 {
+		end := i + 64
+		if end > len(samples) {
+			end = len(samples)
+		}
+		if trigger.Process(samples[i:end]) {
+			fired++
+		}
+	}
+	assert.Equal(t, 1, fired)
+	assert.InDelta(t, 8*(100+130*2), trigger.CueOffset(), 205)
+
+	trigger.Reset()
+	assert.Equal(t, uint64(0), trigger.CueOffset())
+
+	// with no symbols any tone fires it
+	anyTone := NewTrigger(d)
+	assert.True(t, anyTone.Process(press("7", 100)))
+}
@@ -0,0 +1,168 @@
+package vad
+
+import (
+	"time"
+
+	"github.com/garlicgarrison/go-recorder/codec"
+)
+
+// Segment is a stretch of speech in a recording
+type Segment struct {
+	Start time.Duration
+	End   time.Duration
+
+	// mean square amplitude of the segment's samples
+	MeanEnergy float64
+
+	// mean smoothed speech probability of the segment's frames
+	Confidence float64
+
+	// with a NonSpeech config, what the segment sounds like
+	Class Class
+}
+
+// AnalyzeFile runs the VAD for cfg.Method over a decoded WAV file, at the
+// file's sample rate and channel count
+func AnalyzeFile(cfg *VADConfig, wav *codec.WAVFile) ([]Segment, error) {
+	if cfg == nil {
+		return nil, ErrInvalidVADConfig
+	}
+
+	fileCfg := *cfg
+	fileCfg.SampleRate = float64(wav.Header.SampleRate)
+	fileCfg.InputChannels = int(wav.Header.NumChannels)
+	return AnalyzeSamples(&fileCfg, wav.Data)
+}
+
+// AnalyzeSamples runs the VAD for cfg.Method over a whole recording of
+// interleaved samples
+func AnalyzeSamples(cfg *VADConfig, samples []int32) ([]Segment, error) {
+	v, err := NewVAD(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return v.Analyze(samples), nil
+}
+
+// Analyze runs the VAD over a whole recording from the start and returns
+// its speech segments, the last one closed at the end of the recording.
+// Live, a detector that calibrates measures the noise floor on whatever
+// comes first; here, if it has not calibrated yet, it measures it on the
+// quietest CalibrationTimeframe of the recording instead, so a recording
+// that opens with speech is not taken for background noise. With
+// DropNonSpeech, segments classified as music or noise are left out.
+func (v *VAD) Analyze(samples []int32) []Segment {
+	if c, ok := v.detector.(Calibrator); ok && !c.Calibrated() {
+		v.Process(v.quietest(samples))
+	}
+	v.Reset()
+
+	// the smoothed probability after each frame
+	probabilities := make([]float64, 0, len(samples)/v.frameSize)
+
+	var segments []Segment
+	var start uint64
+	add := func(end uint64, class Class) {
+		if v.cfg.NonSpeech == DropNonSpeech && class != SpeechClass {
+			return
+		}
+		s := v.segment(samples, probabilities, start, end)
+		s.Class = class
+		segments = append(segments, s)
+	}
+	for offset := 0; offset < len(samples); offset += v.frameSize {
+		end := offset + v.frameSize
+		if end > len(samples) {
+			end = len(samples)
+		}
+
+		for _, event := range v.Process(samples[offset:end]) {
+			if event.Type == SpeechStart {
+				start = event.Offset
+			} else {
+				add(event.Offset, event.Class)
+			}
+		}
+		if end-offset == v.frameSize {
+			probabilities = append(probabilities, v.probability)
+		}
+	}
+
+	if v.speaking {
+		var class Class
+		if v.classifier != nil {
+			class, _ = v.classifier.classifyRange(start, uint64(len(samples)))
+		}
+		add(uint64(len(samples)), class)
+	}
+	return segments
+}
+
+// quietest is the stretch of CalibrationTimeframe, in whole frames, with the
+// least energy
+func (v *VAD) quietest(samples []int32) []int32 {
+	frames := (v.cfg.window(v.cfg.CalibrationTimeframe) + v.frameSize - 1) / v.frameSize
+	length := frames * v.frameSize
+	if len(samples) <= length {
+		return samples
+	}
+
+	energies := make([]float64, len(samples)/v.frameSize)
+	for i := range energies {
+		for _, amp := range samples[i*v.frameSize : (i+1)*v.frameSize] {
+			energies[i] += float64(amp) * float64(amp)
+		}
+	}
+
+	best, sum := 0, 0.0
+	for i := 0; i < frames; i++ {
+		sum += energies[i]
+	}
+	least := sum
+	for i := frames; i < len(energies); i++ {
+		sum += energies[i] - energies[i-frames]
+		if sum < least {
+			least = sum
+			best = i - frames + 1
+		}
+	}
+
+	return samples[best*v.frameSize : best*v.frameSize+length]
+}
+
+// segment measures the samples from start to end, and the probabilities of
+// the frames starting in them
+func (v *VAD) segment(samples []int32, probabilities []float64, start, end uint64) Segment {
+	s := Segment{
+		Start: v.duration(start),
+		End:   v.duration(end),
+	}
+
+	if end > start {
+		energy := 0.0
+		for _, amp := range samples[start:end] {
+			energy += float64(amp) * float64(amp)
+		}
+		s.MeanEnergy = energy / float64(end-start)
+	}
+
+	first := int(start) / v.frameSize
+	last := (int(end) + v.frameSize - 1) / v.frameSize
+	if last > len(probabilities) {
+		last = len(probabilities)
+	}
+	if last > first {
+		sum := 0.0
+		for _, p := range probabilities[first:last] {
+			sum += p
+		}
+		s.Confidence = sum / float64(last-first)
+	}
+	return s
+}
+
+// duration is the time from the start to an offset in samples
+func (v *VAD) duration(offset uint64) time.Duration {
+	frames := float64(offset) / float64(v.cfg.InputChannels)
+	return time.Duration(frames / v.cfg.SampleRate * float64(time.Second))
+}
@@ -0,0 +1,52 @@
+package vad
+
+import (
+	"testing"
+	"time"
+
+	"github.com/garlicgarrison/go-recorder/codec"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAnalyzeSamples(t *testing.T) {
+	segments, err := AnalyzeSamples(testConfig(), utterance())
+	assert.NoError(t, err)
+	assert.Len(t, segments, 1)
+
+	// the same boundaries as the events of TestProcessEvents
+	assert.Equal(t, 64*50*time.Millisecond, segments[0].Start)
+	assert.Equal(t, 64*81*time.Millisecond, segments[0].End)
+	assert.Greater(t, segments[0].Confidence, 0.5)
+	assert.InDelta(t, 1e18/2*30/31, segments[0].MeanEnergy, 1e17)
+}
+
+func TestAnalyzeSpeechFirst(t *testing.T) {
+	samples := tone(1e9, 64*30)
+	samples = append(samples, tone(1e6, 64*30)...)
+	samples = append(samples, tone(1e9, 64*30)...)
+
+	// calibrated on the quiet middle, the opening speech is found, and the
+	// last segment is closed at the end
+	segments, err := AnalyzeSamples(testConfig(), samples)
+	assert.NoError(t, err)
+	assert.Len(t, segments, 2)
+	assert.Equal(t, time.Duration(0), segments[0].Start)
+	assert.Equal(t, 64*60*time.Millisecond, segments[1].Start)
+	assert.Equal(t, 64*90*time.Millisecond, segments[1].End)
+}
+
+func TestAnalyzeFile(t *testing.T) {
+	wav := codec.NewDefaultWAV(utterance())
+	wav.Header.SampleRate = 1000
+
+	expected, err := AnalyzeSamples(testConfig(), utterance())
+	assert.NoError(t, err)
+
+	cfg := DefaultVADConfig()
+	segments, err := AnalyzeFile(cfg, wav)
+	assert.NoError(t, err)
+	assert.Equal(t, expected, segments)
+
+	// the caller's config is left alone
+	assert.Equal(t, DefaultVADConfig(), cfg)
+}
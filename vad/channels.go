@@ -0,0 +1,230 @@
+package vad
+
+// ChannelPolicy is how a MultichannelDetector combines the probabilities of
+// its channels into the VAD's
+type ChannelPolicy string
+
+const (
+	// speech on any channel is speech: the highest probability
+	AnyChannel ChannelPolicy = "any"
+
+	// speech only when every channel has it: the lowest probability
+	AllChannels ChannelPolicy = "all"
+
+	// the probability of the channel with the most energy in the frame
+	LoudestChannel ChannelPolicy = "loudest"
+
+	// the mean of the probabilities, weighted by ChannelWeights
+	WeightedChannels ChannelPolicy = "weighted"
+)
+
+// MultichannelDetector deinterleaves frames and runs a detector and a VAD
+// per channel, so each channel has its own noise floor and its own speech
+// decisions, and combines the channels' probabilities by the ChannelPolicy.
+// With a mic per person it tells who is speaking.
+type MultichannelDetector struct {
+	cfg     *VADConfig
+	handler func(channel int, e Event)
+
+	detectors []Detector
+	vads      []*VAD
+
+	// the current frame, deinterleaved, and each channel's energy and
+	// probability in it
+	mono          [][]int32
+	energy        []float64
+	probabilities []float64
+}
+
+// NewMultichannelDetector builds each channel's detector with newDetector,
+// from a copy of cfg for one channel
+func NewMultichannelDetector(cfg *VADConfig, newDetector func(cfg *VADConfig) (Detector, error)) (*MultichannelDetector, error) {
+	err := cfg.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	mono := *cfg
+	mono.InputChannels = 1
+	mono.ChannelPolicy = ""
+	mono.ChannelWeights = nil
+
+	d := &MultichannelDetector{
+		cfg:           cfg,
+		detectors:     make([]Detector, cfg.InputChannels),
+		vads:          make([]*VAD, cfg.InputChannels),
+		mono:          make([][]int32, cfg.InputChannels),
+		energy:        make([]float64, cfg.InputChannels),
+		probabilities: make([]float64, cfg.InputChannels),
+	}
+
+	for ch := range d.detectors {
+		ch := ch
+		detector, err := newDetector(&mono)
+		if err != nil {
+			return nil, err
+		}
+		if detector == nil {
+			return nil, ErrInvalidVADConfig
+		}
+		d.detectors[ch] = detector
+
+		// the channel's VAD scores through the detector, leaving the raw
+		// probability behind for the policy
+		d.vads[ch], err = NewVADWithDetector(&mono, DetectorFunc(func(frame []int32) float64 {
+			d.probabilities[ch] = detector.Probability(frame)
+			return d.probabilities[ch]
+		}))
+		if err != nil {
+			return nil, err
+		}
+
+		d.vads[ch].OnEvent(func(e Event) {
+			if d.handler != nil {
+				e.Offset *= uint64(cfg.InputChannels)
+				d.handler(ch, e)
+			}
+		})
+	}
+	return d, nil
+}
+
+// OnChannelEvent sets a handler called for each channel's own events, their
+// offsets in the interleaved stream
+func (d *MultichannelDetector) OnChannelEvent(handler func(channel int, e Event)) {
+	d.handler = handler
+}
+
+func (d *MultichannelDetector) Probability(frame []int32) float64 {
+	channels := d.cfg.InputChannels
+	for ch := range d.mono {
+		d.mono[ch] = d.mono[ch][:0]
+		d.energy[ch] = 0
+	}
+	for i, amp := range frame {
+		ch := i % channels
+		d.mono[ch] = append(d.mono[ch], amp)
+		d.energy[ch] += float64(amp) * float64(amp)
+	}
+
+	for ch, v := range d.vads {
+		v.Process(d.mono[ch])
+	}
+	return d.combine()
+}
+
+// combine applies the policy to the channels' probabilities
+func (d *MultichannelDetector) combine() float64 {
+	switch d.cfg.ChannelPolicy {
+	case AllChannels:
+		p := d.probabilities[0]
+		for _, q := range d.probabilities[1:] {
+			if q < p {
+				p = q
+			}
+		}
+		return p
+	case LoudestChannel:
+		loudest := 0
+		for ch, e := range d.energy {
+			if e > d.energy[loudest] {
+				loudest = ch
+			}
+		}
+		return d.probabilities[loudest]
+	case WeightedChannels:
+		sum, weights := 0.0, 0.0
+		for ch, p := range d.probabilities {
+			w := 1.0
+			if d.cfg.ChannelWeights != nil {
+				w = d.cfg.ChannelWeights[ch]
+			}
+			sum += w * p
+			weights += w
+		}
+		return sum / weights
+	default:
+		p := d.probabilities[0]
+		for _, q := range d.probabilities[1:] {
+			if q > p {
+				p = q
+			}
+		}
+		return p
+	}
+}
+
+// Probabilities is each channel's probability for the last frame
+func (d *MultichannelDetector) Probabilities() []float64 {
+	return d.probabilities
+}
+
+// Speaking reports whether each channel is between its own SpeechStart and
+// SpeechEnd
+func (d *MultichannelDetector) Speaking() []bool {
+	speaking := make([]bool, len(d.vads))
+	for ch, v := range d.vads {
+		speaking[ch] = v.Speaking()
+	}
+	return speaking
+}
+
+// Speaker is the speaking channel with the highest smoothed probability, or
+// -1 when none is speaking
+func (d *MultichannelDetector) Speaker() int {
+	speaker := -1
+	for ch, v := range d.vads {
+		if v.Speaking() && (speaker < 0 || v.Probability() > d.vads[speaker].Probability()) {
+			speaker = ch
+		}
+	}
+	return speaker
+}
+
+// Reset returns every channel to silence, keeping their noise floors
+func (d *MultichannelDetector) Reset() {
+	for ch, v := range d.vads {
+		v.Reset()
+		d.probabilities[ch] = 0
+	}
+}
+
+// Calibrated reports whether every channel has measured its noise floor
+func (d *MultichannelDetector) Calibrated() bool {
+	for _, detector := range d.detectors {
+		if c, ok := detector.(Calibrator); ok && !c.Calibrated() {
+			return false
+		}
+	}
+	return true
+}
+
+func (d *MultichannelDetector) Recalibrate() {
+	for ch, v := range d.vads {
+		v.Reset()
+		if c, ok := d.detectors[ch].(Calibrator); ok {
+			c.Recalibrate()
+		}
+		d.probabilities[ch] = 0
+	}
+}
+
+// NoiseFloor is the mean of the channels' noise floors
+func (d *MultichannelDetector) NoiseFloor() float64 {
+	sum := 0.0
+	for _, floor := range d.NoiseFloors() {
+		sum += floor
+	}
+	return sum / float64(len(d.vads))
+}
+
+// NoiseFloors is each channel's noise floor as an RMS amplitude
+func (d *MultichannelDetector) NoiseFloors() []float64 {
+	floors := make([]float64, len(d.detectors))
+	for ch, detector := range d.detectors {
+		if c, ok := detector.(Calibrator); ok {
+			floors[ch] = c.NoiseFloor()
+		}
+	}
+	return floors
+}
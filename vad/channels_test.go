@@ -0,0 +1,123 @@
+package vad
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func interleave(left, right []int32) []int32 {
+	samples := make([]int32, 0, 2*len(left))
+	for i := range left {
+		samples = append(samples, left[i], right[i])
+	}
+	return samples
+}
+
+// interview has the left mic speak over buffers 50 to 80 and the right over
+// 100 to 130, each quiet while the other speaks
+func interview() []int32 {
+	quiet := tone(1e6, 64*20)
+	left := append(tone(1e6, 64*50), tone(1e9, 64*30)...)
+	left = append(left, tone(1e6, 64*70)...)
+	right := append(tone(1e6, 64*100), tone(1e9, 64*30)...)
+	right = append(right, quiet...)
+	return interleave(left, right)
+}
+
+func stereoVAD(t *testing.T, policy ChannelPolicy, weights []float64) *VAD {
+	cfg := testConfig()
+	cfg.InputChannels = 2
+	cfg.ChannelPolicy = policy
+	cfg.ChannelWeights = weights
+	v, err := NewVAD(cfg)
+	assert.NoError(t, err)
+	return v
+}
+
+type channelEvent struct {
+	channel int
+	event   Event
+}
+
+func TestChannelEvents(t *testing.T) {
+	v := stereoVAD(t, AnyChannel, nil)
+
+	var channelEvents []channelEvent
+	v.Detector().(*MultichannelDetector).OnChannelEvent(func(channel int, e Event) {
+		channelEvents = append(channelEvents, channelEvent{channel, e})
+	})
+	var speakers []int
+	v.OnEvent(func(e Event) {
+		if e.Type == SpeechStart {
+			speakers = append(speakers, v.Speaker())
+		}
+	})
+
+	events := v.Process(interview())
+	assert.Equal(t, 2, starts(events))
+	assert.Equal(t, []int{0, 1}, speakers)
+	assert.Equal(t, uint64(2*64*50), events[0].Offset)
+	assert.Equal(t, uint64(2*64*100), events[2].Offset)
+
+	// each channel has its own start and end, at the same offsets
+	assert.Len(t, channelEvents, 4)
+	assert.Equal(t, channelEvent{0, events[0]}, channelEvent{channelEvents[0].channel, channelEvents[0].event})
+	assert.Equal(t, 0, channelEvents[1].channel)
+	assert.Equal(t, SpeechEnd, channelEvents[1].event.Type)
+	assert.Equal(t, 1, channelEvents[2].channel)
+	assert.Equal(t, events[2].Offset, channelEvents[2].event.Offset)
+
+	assert.Equal(t, []bool{false, false}, v.ChannelSpeaking())
+	assert.Equal(t, -1, v.Speaker())
+}
+
+func TestChannelPolicies(t *testing.T) {
+	for _, tc := range []struct {
+		policy  ChannelPolicy
+		weights []float64
+		starts  int
+	}{
+		{AnyChannel, nil, 2},
+		{LoudestChannel, nil, 2},
+		// neither mic alone is enough
+		{AllChannels, nil, 0},
+		// only the left mic counts, then only the right is enough
+		{WeightedChannels, []float64{1, 0}, 1},
+		{WeightedChannels, []float64{1, 3}, 1},
+	} {
+		v := stereoVAD(t, tc.policy, tc.weights)
+		assert.Equal(t, tc.starts, starts(v.Process(interview())), tc.policy)
+	}
+}
+
+func TestChannelReset(t *testing.T) {
+	v := stereoVAD(t, AnyChannel, nil)
+	samples := interview()
+	first := v.Process(samples[:2*64*60])
+	assert.Equal(t, []bool{true, false}, v.ChannelSpeaking())
+
+	v.Reset()
+	assert.Equal(t, []bool{false, false}, v.ChannelSpeaking())
+	assert.True(t, v.Calibrated())
+	assert.Len(t, v.Detector().(*MultichannelDetector).NoiseFloors(), 2)
+
+	v.Recalibrate()
+	assert.False(t, v.Calibrated())
+	assert.Equal(t, first, v.Process(samples[:2*64*60]))
+}
+
+func TestValidateChannels(t *testing.T) {
+	for _, breakConfig := range []func(*VADConfig){
+		func(c *VADConfig) { c.ChannelPolicy = "first" },
+		func(c *VADConfig) { c.ChannelPolicy, c.ChannelWeights = WeightedChannels, []float64{1} },
+		func(c *VADConfig) { c.ChannelPolicy, c.ChannelWeights = WeightedChannels, []float64{1, -1} },
+		func(c *VADConfig) { c.ChannelPolicy, c.ChannelWeights = WeightedChannels, []float64{0, 0} },
+	} {
+		cfg := DefaultVADConfig()
+		cfg.InputChannels = 2
+		breakConfig(cfg)
+		_, err := NewVAD(cfg)
+		assert.ErrorIs(t, err, ErrInvalidVADConfig)
+	}
+}
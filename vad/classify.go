@@ -0,0 +1,388 @@
+package vad
+
+import (
+	"math"
+
+	"github.com/garlicgarrison/go-recorder/dsp"
+)
+
+// Class is what a segment the VAD found sounds like
+type Class string
+
+const (
+	SpeechClass Class = "speech"
+	MusicClass  Class = "music"
+	NoiseClass  Class = "noise"
+)
+
+// NonSpeech is what the VAD does with segments classified as music or noise
+type NonSpeech string
+
+const (
+	// TagNonSpeech classifies segments and keeps them all
+	TagNonSpeech NonSpeech = "tag"
+
+	// DropNonSpeech classifies segments and drops those that are not
+	// speech: Analyze leaves them out, and a Recorder discards them
+	DropNonSpeech NonSpeech = "drop"
+)
+
+const (
+	// milliseconds per classifier frame, long enough for two periods of a
+	// low voice, and between frames
+	ClassFrameTime = 40
+	ClassHopTime   = 20
+
+	// the pitch range harmonicity is looked for in
+	minPitch = 70.0  // Hz
+	maxPitch = 500.0 // Hz
+
+	// the normalized autocorrelation peak above which a frame is voiced
+	voicedPeak = 0.7
+
+	// frames this many dB below the loudest are pauses: unvoiced, and
+	// their level no lower than this for the modulation
+	quietLevel = 40.0
+
+	// the syllable rate band of the level modulation
+	syllableLow  = 2.0 // Hz
+	syllableHigh = 8.0 // Hz
+)
+
+// ClassFeatures are the measures a Classifier decides on
+type ClassFeatures struct {
+	// fraction of the frames with a clear pitch
+	Voicing float64
+
+	// RMS in dB of the level's modulation at the syllable rate, 2 to 8Hz
+	Modulation float64
+
+	// mean change of the normalized magnitude spectrum from one frame to
+	// the next, from 0 to 1
+	Flux float64
+}
+
+// Classifier tells speech from music and noise over a stretch of audio:
+//
+//   - noise has little pitch, so few voiced frames
+//   - speech alternates voiced syllables with consonants and pauses a few
+//     times a second, so its level is modulated at the syllable rate and
+//     not every frame is voiced
+//   - music holds its pitch through notes, so almost every frame is
+//     voiced, and its level moves more slowly or less
+//
+// It keeps a few measures per frame, not the audio, and is not safe for
+// concurrent use.
+type Classifier struct {
+	rate     float64
+	channels int
+
+	length, hop int
+	window      []float64
+	fft         *dsp.FFT
+	spectrum    []complex128
+	power       []complex128
+	windowed    []float64
+	magnitude   []float64
+	corr        []float64
+	windowCorr  []float64 // the window's own autocorrelation, normalized
+	minLag      int
+	maxLag      int
+
+	// mono samples not yet in a whole frame
+	mixer   *dsp.Downmix
+	pending []float64
+
+	prev []float64 // normalized magnitude spectrum of the last frame
+
+	// per frame, from the frame after the forgotten ones
+	forgotten int
+	levels    []float64 // dB
+	peaks     []float64 // normalized autocorrelation peak
+	fluxes    []float64
+}
+
+func NewClassifier(rate float64, channels int) *Classifier {
+	length := int(math.Round(rate * ClassFrameTime / 1000))
+	size := dsp.NextPowerOfTwo(2 * length)
+	fft, _ := dsp.NewFFT(size)
+
+	c := &Classifier{
+		rate:      rate,
+		channels:  channels,
+		mixer:     dsp.NewDownmix(channels),
+		length:    length,
+		hop:       int(math.Round(rate * ClassHopTime / 1000)),
+		window:    dsp.Hann(length),
+		fft:       fft,
+		spectrum:  make([]complex128, size),
+		power:     make([]complex128, size),
+		windowed:  make([]float64, length),
+		magnitude: make([]float64, size/2+1),
+		corr:      make([]float64, length),
+		minLag:    int(rate / maxPitch),
+		maxLag:    int(math.Ceil(rate / minPitch)),
+	}
+	if c.maxLag >= length {
+		c.maxLag = length - 1
+	}
+	c.windowCorr = append([]float64(nil), c.autocorrelate(c.window)...)
+	return c
+}
+
+// Classify classifies a whole stretch of interleaved samples
+func Classify(rate float64, channels int, samples []int32) (Class, ClassFeatures) {
+	c := NewClassifier(rate, channels)
+	c.Add(samples)
+	return c.Class()
+}
+
+// Add takes the next interleaved samples
+func (c *Classifier) Add(samples []int32) {
+	c.pending = c.mixer.Add(samples, c.pending)
+
+	used := 0
+	for used+c.length <= len(c.pending) {
+		c.analyze(c.pending[used : used+c.length])
+		used += c.hop
+	}
+	c.pending = c.pending[:copy(c.pending, c.pending[used:])]
+}
+
+// Reset forgets the audio so far
+func (c *Classifier) Reset() {
+	c.pending = c.pending[:0]
+	c.mixer.Reset()
+	c.prev = nil
+	c.levels = c.levels[:0]
+	c.peaks = c.peaks[:0]
+	c.fluxes = c.fluxes[:0]
+	c.forgotten = 0
+}
+
+// Class classifies the audio added since the classifier was created or
+// reset. Too little for a frame is noise.
+func (c *Classifier) Class() (Class, ClassFeatures) {
+	return c.classifyFrames(0, len(c.levels))
+}
+
+// offsetFrames is the first frame starting at or after an offset in
+// interleaved samples from the start
+func (c *Classifier) offsetFrames(offset uint64) int {
+	step := uint64(c.hop * c.channels)
+	return int((offset+step-1)/step) - c.forgotten
+}
+
+// classifyRange classifies the frames wholly between two offsets in
+// interleaved samples from the start
+func (c *Classifier) classifyRange(from, to uint64) (Class, ClassFeatures) {
+	first := c.offsetFrames(from)
+	if first < 0 {
+		first = 0
+	}
+	last := first
+	for last < len(c.levels) && uint64((c.forgotten+last)*c.hop+c.length)*uint64(c.channels) <= to {
+		last++
+	}
+	return c.classifyFrames(first, last)
+}
+
+// forget drops the frames starting before an offset
+func (c *Classifier) forget(offset uint64) {
+	n := c.offsetFrames(offset)
+	if n <= 0 {
+		return
+	}
+	if n > len(c.levels) {
+		n = len(c.levels)
+	}
+	c.levels = c.levels[:copy(c.levels, c.levels[n:])]
+	c.peaks = c.peaks[:copy(c.peaks, c.peaks[n:])]
+	c.fluxes = c.fluxes[:copy(c.fluxes, c.fluxes[n:])]
+	c.forgotten += n
+}
+
+func (c *Classifier) classifyFrames(first, last int) (Class, ClassFeatures) {
+	f := c.features(first, last)
+	switch {
+	case last <= first:
+		return NoiseClass, f
+	case f.Flux < musicFlux:
+		return MusicClass, f
+	case f.Voicing < minVoicing || f.Modulation < speechModulation:
+		return NoiseClass, f
+	case f.Voicing > musicVoicing:
+		return MusicClass, f
+	}
+	return SpeechClass, f
+}
+
+const (
+	// the most spectral flux for music: held notes and chords barely
+	// change from frame to frame, where speech and noise do
+	musicFlux = 0.18
+
+	// the fewest voiced frames for speech
+	minVoicing = 0.2
+
+	// dB; the least syllable rate modulation for speech. The voices of a
+	// crowd blur into babble without it.
+	speechModulation = 4.0
+
+	// the most voiced frames for speech; a melody is voiced throughout
+	musicVoicing = 0.9
+)
+
+func (c *Classifier) features(first, last int) ClassFeatures {
+	var f ClassFeatures
+	frames := last - first
+	if frames <= 0 {
+		return f
+	}
+	levels := c.levels[first:last]
+
+	loudest := math.Inf(-1)
+	for _, l := range levels {
+		loudest = math.Max(loudest, l)
+	}
+	floor := loudest - quietLevel
+
+	voiced := 0
+	for i, p := range c.peaks[first:last] {
+		if p > voicedPeak && levels[i] > floor {
+			voiced++
+		}
+	}
+	f.Voicing = float64(voiced) / float64(frames)
+
+	for _, flux := range c.fluxes[first:last] {
+		f.Flux += flux
+	}
+	f.Flux /= float64(frames)
+
+	// the level envelope, pauses raised to the floor so digital silence
+	// does not dominate
+	envelope := make([]float64, frames)
+	mean := 0.0
+	for i, l := range levels {
+		envelope[i] = math.Max(l, floor)
+		mean += envelope[i]
+	}
+	mean /= float64(frames)
+	for i := range envelope {
+		envelope[i] -= mean
+	}
+
+	f.Modulation = modulation(envelope, 1000/ClassHopTime)
+	return f
+}
+
+// modulation is the RMS of the part of an envelope at the syllable rate
+func modulation(envelope []float64, rate float64) float64 {
+	size := dsp.NextPowerOfTwo(len(envelope))
+	fft, err := dsp.NewFFT(size)
+	if err != nil {
+		return 0
+	}
+
+	// by Parseval, each bin but DC and Nyquist stands for its mirror too
+	power := fft.Power(envelope, nil, nil)
+	sum := 0.0
+	for i, p := range power {
+		freq := fft.BinFrequency(i, rate)
+		if freq >= syllableLow && freq <= syllableHigh {
+			sum += 2 * p
+		}
+	}
+	return math.Sqrt(sum / float64(size) / float64(len(envelope)))
+}
+
+// analyze measures a frame's level, harmonicity and spectral flux
+func (c *Classifier) analyze(frame []float64) {
+	energy := 0.0
+	for _, v := range frame {
+		energy += v * v
+	}
+	c.levels = append(c.levels, 10*math.Log10(energy/float64(len(frame))+minBinPower))
+
+	// Boersma's harmonicity: the autocorrelation of the windowed frame
+	// divided by the window's own, peaking near 1 at the period of a
+	// periodic signal. Only true peaks count, not the edge of the range:
+	// low rumble correlates at short lags without having a pitch.
+	for i, v := range frame {
+		c.windowed[i] = v * c.window[i]
+	}
+	corr := c.autocorrelate(c.windowed)
+	peak := 0.0
+	if corr[0] > 0 {
+		for lag := c.minLag + 1; lag < c.maxLag; lag++ {
+			if corr[lag] >= corr[lag-1] && corr[lag] >= corr[lag+1] {
+				peak = math.Max(peak, corr[lag]/c.windowCorr[lag])
+			}
+		}
+	}
+	c.peaks = append(c.peaks, math.Min(peak, 1))
+
+	// flux between magnitude spectra normalized to sum to 1, so loudness
+	// does not count
+	magnitude := c.spectrumMagnitude()
+	flux := 0.0
+	if c.prev != nil {
+		for i, m := range magnitude {
+			flux += math.Abs(m - c.prev[i])
+		}
+		flux /= 2
+	}
+	c.fluxes = append(c.fluxes, flux)
+	c.prev = append(c.prev[:0], magnitude...)
+}
+
+// autocorrelate returns the autocorrelation of x from lag 0 to the frame
+// length through the power spectrum, normalized to 1 at lag 0, in a slice
+// reused by the next call. It leaves the spectrum of x in c.spectrum.
+func (c *Classifier) autocorrelate(x []float64) []float64 {
+	for i := range c.spectrum {
+		v := 0.0
+		if i < len(x) {
+			v = x[i]
+		}
+		c.spectrum[i] = complex(v, 0)
+	}
+	c.fft.Transform(c.spectrum)
+
+	for i, s := range c.spectrum {
+		c.power[i] = complex(real(s)*real(s)+imag(s)*imag(s), 0)
+	}
+	c.fft.Transform(c.power)
+
+	corr := c.corr
+	for i := range corr {
+		corr[i] = real(c.power[i])
+	}
+	if corr[0] > 0 {
+		zero := corr[0]
+		for i := range corr {
+			corr[i] /= zero
+		}
+	}
+	return corr
+}
+
+// spectrumMagnitude is the magnitude of the last autocorrelated frame's
+// spectrum up to the Nyquist bin, normalized to sum to 1, in a slice reused
+// by the next call
+func (c *Classifier) spectrumMagnitude() []float64 {
+	magnitude := c.magnitude
+	sum := 0.0
+	for i := range magnitude {
+		s := c.spectrum[i]
+		magnitude[i] = math.Sqrt(real(s)*real(s) + imag(s)*imag(s))
+		sum += magnitude[i]
+	}
+	if sum > 0 {
+		for i := range magnitude {
+			magnitude[i] /= sum
+		}
+	}
+	return magnitude
+}
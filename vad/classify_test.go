@@ -0,0 +1,222 @@
+package vad
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const classRate = 16000
+
+// vowels are pairs of formants
+var vowels = [][2]float64{{730, 1090}, {270, 2290}, {530, 1840}, {570, 840}, {300, 870}, {660, 1720}}
+
+// harmonic is a sample of the harmonics of f0 below 4kHz, shaped by two
+// formants, or falling off as 1/h with none
+func harmonic(phase, f0 float64, formants *[2]float64) float64 {
+	v := 0.0
+	for h := 1; float64(h)*f0 < 4000; h++ {
+		gain := 1 / float64(h)
+		if formants != nil {
+			f := float64(h) * f0
+			gain = math.Exp(-sq((f-formants[0])/120)) + 0.5*math.Exp(-sq((f-formants[1])/200)) + 0.03
+		}
+		v += gain * math.Sin(float64(h)*phase)
+	}
+	return v
+}
+
+func sq(x float64) float64 {
+	return x * x
+}
+
+// talk is a voice saying syllables of gliding pitch a few times a second,
+// with fricatives and pauses between them
+func talk(rng *rand.Rand, seconds float64) []int32 {
+	n := int(seconds * classRate)
+	out := make([]float64, 0, n)
+	pitch := 90 + rng.Float64()*120
+	for len(out) < n {
+		length := int((0.12 + rng.Float64()*0.13) * classRate)
+		vowel := vowels[rng.Intn(len(vowels))]
+		from, to := pitch*(0.9+rng.Float64()*0.3), pitch*(0.8+rng.Float64()*0.2)
+		phase := 0.0
+		for i := 0; i < length; i++ {
+			x := float64(i) / float64(length)
+			f0 := from + (to-from)*x
+			phase += 2 * math.Pi * f0 / classRate
+			envelope := math.Sin(math.Pi * x)
+			out = append(out, 3e7*envelope*harmonic(phase, f0, &vowel))
+		}
+
+		gap := int((0.03 + rng.Float64()*0.09) * classRate)
+		if rng.Intn(8) == 0 {
+			gap += int(0.3 * classRate)
+		}
+		fricative := rng.Intn(2) == 0
+		prev := 0.0
+		for i := 0; i < gap; i++ {
+			v := 0.0
+			if fricative {
+				// differenced noise, for the hiss of an s or f
+				noise := rng.NormFloat64()
+				v = 1e7 * (noise - prev) * math.Sin(math.Pi*float64(i)/float64(gap))
+				prev = noise
+			}
+			out = append(out, v)
+		}
+	}
+	return mix(rng, out[:n])
+}
+
+// chords are held chords changing twice a second, with a little vibrato
+func chords(rng *rand.Rand, seconds float64) []int32 {
+	n := int(seconds * classRate)
+	out := make([]float64, n)
+	note := int(0.5 * classRate)
+	for start := 0; start < n; start += note {
+		root := 130.81 * math.Pow(2, float64(rng.Intn(12))/12)
+		for _, interval := range []float64{0, 4, 7} {
+			f0 := root * math.Pow(2, interval/12)
+			phase := 0.0
+			for i := start; i < start+note && i < n; i++ {
+				t := float64(i-start) / classRate
+				phase += 2 * math.Pi * f0 * (1 + 0.003*math.Sin(2*math.Pi*5*t)) / classRate
+				envelope := math.Min(1, t/0.02) * (1 - 0.2*math.Min(1, t/0.1))
+				out[i] += 1e7 * envelope * harmonic(phase, f0, nil)
+			}
+		}
+	}
+	return mix(rng, out)
+}
+
+// plucks are a melody of plucked notes, four a second, each ringing on
+// into the next
+func plucks(rng *rand.Rand, seconds float64) []int32 {
+	n := int(seconds * classRate)
+	out := make([]float64, n)
+	note := int(0.25 * classRate)
+	for start := 0; start < n; start += note {
+		f0 := 196 * math.Pow(2, float64(rng.Intn(15))/12)
+		phase := 0.0
+		for i := start; i < n && i < start+4*note; i++ {
+			t := float64(i-start) / classRate
+			phase += 2 * math.Pi * f0 / classRate
+			out[i] += 3e7 * math.Exp(-t/0.3) * harmonic(phase, f0, nil)
+		}
+	}
+	return mix(rng, out)
+}
+
+// hiss is white noise
+func hiss(rng *rand.Rand, seconds float64) []int32 {
+	out := make([]float64, int(seconds*classRate))
+	for i := range out {
+		out[i] = 1e8 * rng.NormFloat64()
+	}
+	return mix(rng, out)
+}
+
+// rumble is low noise swelling and fading, like a car passing
+func rumble(rng *rand.Rand, seconds float64) []int32 {
+	out := make([]float64, int(seconds*classRate))
+	low := 0.0
+	for i := range out {
+		low = 0.98*low + 0.02*rng.NormFloat64()
+		swell := math.Sin(math.Pi * float64(i) / float64(len(out)))
+		out[i] = 1e9 * swell * low
+	}
+	return mix(rng, out)
+}
+
+// babble is a crowd of voices talking over each other
+func babble(rng *rand.Rand, seconds float64) []int32 {
+	crowd := make([]int32, int(seconds*classRate))
+	for voice := 0; voice < 8; voice++ {
+		for i, s := range talk(rng, seconds) {
+			crowd[i] += s / 3
+		}
+	}
+	return crowd
+}
+
+// mix adds a quiet background and converts to samples
+func mix(rng *rand.Rand, signal []float64) []int32 {
+	samples := make([]int32, len(signal))
+	for i, s := range signal {
+		samples[i] = int32(s + 1e5*rng.NormFloat64())
+	}
+	return samples
+}
+
+func TestClassify(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for _, c := range []struct {
+		name     string
+		generate func(*rand.Rand, float64) []int32
+		want     Class
+	}{
+		{"talk", talk, SpeechClass},
+		{"chords", chords, MusicClass},
+		{"plucks", plucks, MusicClass},
+		{"hiss", hiss, NoiseClass},
+		{"rumble", rumble, NoiseClass},
+		{"babble", babble, NoiseClass},
+	} {
+		for i := 0; i < 3; i++ {
+			class, features := Classify(classRate, 1, c.generate(rng, 4))
+			assert.Equal(t, c.want, class, "%s %d: %+v", c.name, i, features)
+		}
+	}
+}
+
+func TestClassifySegments(t *testing.T) {
+	rng := rand.New(rand.NewSource(2))
+	quiet := func(seconds float64) []int32 {
+		return mix(rng, make([]float64, int(seconds*classRate)))
+	}
+
+	var samples []int32
+	samples = append(samples, quiet(1)...)
+	samples = append(samples, talk(rng, 3)...)
+	samples = append(samples, quiet(1.5)...)
+	samples = append(samples, chords(rng, 3)...)
+	samples = append(samples, quiet(1.5)...)
+	samples = append(samples, hiss(rng, 3)...)
+	samples = append(samples, quiet(1.5)...)
+
+	cfg := DefaultVADConfig()
+	cfg.SampleRate = classRate
+	cfg.FramesPerBuffer = 160
+	cfg.NonSpeech = TagNonSpeech
+	tagged, err := AnalyzeSamples(cfg, samples)
+	assert.NoError(t, err)
+
+	var classes []Class
+	for _, s := range tagged {
+		classes = append(classes, s.Class)
+	}
+	assert.Equal(t, []Class{SpeechClass, MusicClass, NoiseClass}, classes)
+
+	// the same segments, without the music and noise
+	cfg.NonSpeech = DropNonSpeech
+	segments, err := AnalyzeSamples(cfg, samples)
+	assert.NoError(t, err)
+	if len(tagged) == 3 {
+		assert.Equal(t, tagged[:1], segments)
+	}
+
+	// unclassified segments have no class
+	cfg.NonSpeech = ""
+	segments, err = AnalyzeSamples(cfg, samples)
+	assert.NoError(t, err)
+	assert.Len(t, segments, 3)
+	for _, s := range segments {
+		assert.Empty(t, s.Class)
+	}
+
+	cfg.NonSpeech = "mute"
+	assert.ErrorIs(t, cfg.Validate(), ErrInvalidVADConfig)
+}
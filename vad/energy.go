@@ -0,0 +1,103 @@
+package vad
+
+import "math"
+
+// EnergyDetector compares the RMS of each frame to a noise floor measured
+// over the first CalibrationTimeframe. The level in dB above the floor is
+// mapped onto probabilities so SpeechThreshold scores SpeechProbability
+// and SilenceThreshold scores SilenceProbability. With AverageTracking,
+// frames below speech level move the floor towards background noise; with
+// MinimumTracking every frame's power goes to a MinimumTracker.
+type EnergyDetector struct {
+	cfg *VADConfig
+
+	// calibration, in samples
+	calibrationWindow int
+	calibrated        bool
+	energy            float64
+	n                 int
+
+	floor   float64
+	tracker *MinimumTracker // nil for AverageTracking
+}
+
+func NewEnergyDetector(cfg *VADConfig) *EnergyDetector {
+	frame := cfg.window(cfg.FrameTimeframe) / cfg.InputChannels
+	return &EnergyDetector{
+		cfg:               cfg,
+		calibrationWindow: cfg.window(cfg.CalibrationTimeframe),
+		tracker:           newTracker(cfg, float64(frame)/cfg.SampleRate*1000),
+	}
+}
+
+func (d *EnergyDetector) Probability(frame []int32) float64 {
+	if len(frame) == 0 {
+		return 0
+	}
+
+	energy := 0.0
+	for _, amp := range frame {
+		energy += float64(amp) * float64(amp)
+	}
+
+	if !d.calibrated {
+		d.energy += energy
+		d.n += len(frame)
+		if d.n >= d.calibrationWindow {
+			d.floor = math.Max(math.Sqrt(d.energy/float64(d.n)), minNoiseFloor)
+			d.calibrated = true
+			if d.tracker != nil {
+				d.tracker.Reset(d.floor * d.floor)
+			}
+		}
+		return 0
+	}
+
+	rms := math.Sqrt(energy / float64(len(frame)))
+	p := levelProbability(d.cfg, 20*math.Log10(rms/d.floor))
+	if d.tracker != nil {
+		d.floor = math.Max(math.Sqrt(d.tracker.Update(rms*rms)), minNoiseFloor)
+	} else if p <= d.cfg.SpeechProbability {
+		d.floor = track(d.floor, rms, frameWeight(d.cfg, len(frame)))
+	}
+	return p
+}
+
+// levelProbability maps a level in dB above the floor linearly through the
+// two thresholds, SilenceThreshold to SilenceProbability and
+// SpeechThreshold to SpeechProbability, clamped to 0 and 1
+func levelProbability(cfg *VADConfig, level float64) float64 {
+	speech, silence := cfg.SpeechThreshold, cfg.SilenceThreshold
+	pSpeech, pSilence := cfg.SpeechProbability, cfg.SilenceProbability
+
+	if math.IsInf(level, -1) {
+		// digital silence
+		return 0
+	}
+
+	var p float64
+	if speech == silence {
+		p = pSilence
+		if level > speech {
+			p = 1
+		}
+	} else {
+		p = pSilence + (level-silence)/(speech-silence)*(pSpeech-pSilence)
+	}
+	return math.Max(0, math.Min(1, p))
+}
+
+func (d *EnergyDetector) Calibrated() bool {
+	return d.calibrated
+}
+
+func (d *EnergyDetector) Recalibrate() {
+	d.calibrated = false
+	d.energy = 0
+	d.n = 0
+	d.floor = 0
+}
+
+func (d *EnergyDetector) NoiseFloor() float64 {
+	return d.floor
+}
@@ -0,0 +1,281 @@
+package eval
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/garlicgarrison/go-recorder/codec"
+	"github.com/garlicgarrison/go-recorder/label"
+)
+
+const (
+	DefaultCorpusItems      = 10
+	DefaultCorpusSampleRate = 16000
+	DefaultCorpusDuration   = 30 * time.Second
+	DefaultCorpusSNR        = 20.0  // dB
+	DefaultCorpusLevel      = -20.0 // dB below full scale
+
+	DefaultMinSpeech = 400 * time.Millisecond
+	DefaultMaxSpeech = 3 * time.Second
+	DefaultMinPause  = 300 * time.Millisecond
+	DefaultMaxPause  = 4 * time.Second
+)
+
+// Item is a recording and the ground truth for it
+type Item struct {
+	Name   string
+	WAV    *codec.WAVFile
+	Labels []label.Label
+}
+
+// Duration is the length of the recording
+func (i *Item) Duration() time.Duration {
+	frames := len(i.WAV.Data) / int(i.WAV.Header.NumChannels)
+	return time.Duration(float64(frames) / float64(i.WAV.Header.SampleRate) * float64(time.Second))
+}
+
+// LoadItem reads a WAV file and its labels
+func LoadItem(wavPath, labelPath string) (*Item, error) {
+	b, err := os.ReadFile(wavPath)
+	if err != nil {
+		return nil, err
+	}
+
+	wav := &codec.WAVFile{}
+	err = wav.DecodeWAV(bytes.NewBuffer(b))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", wavPath, err)
+	}
+	if wav.Header.NumChannels == 0 || wav.Header.SampleRate == 0 {
+		return nil, fmt.Errorf("%w: %s has no channels or sample rate", codec.ErrInvalidWAV, wavPath)
+	}
+
+	labels, err := label.Load(labelPath)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", labelPath, err)
+	}
+
+	name := strings.TrimSuffix(filepath.Base(wavPath), filepath.Ext(wavPath))
+	return &Item{Name: name, WAV: wav, Labels: labels}, nil
+}
+
+// LoadCorpus reads every WAV file in a directory that has labels beside it
+// with the same name, ending in .rttm or .txt
+func LoadCorpus(dir string) ([]*Item, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.wav"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+
+	var items []*Item
+	for _, path := range paths {
+		base := strings.TrimSuffix(path, filepath.Ext(path))
+		for _, ext := range []string{".rttm", ".txt"} {
+			if _, err := os.Stat(base + ext); err != nil {
+				continue
+			}
+
+			item, err := LoadItem(path, base+ext)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+			break
+		}
+	}
+
+	if len(items) == 0 {
+		return nil, fmt.Errorf("%w: no labelled wav files in %s", label.ErrInvalidLabels, dir)
+	}
+	return items, nil
+}
+
+// WriteCorpus writes each item as a WAV file and an Audacity label file
+func WriteCorpus(dir string, items []*Item) error {
+	err := os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return err
+	}
+
+	for _, item := range items {
+		buf, err := item.WAV.EncodeWAV()
+		if err != nil {
+			return err
+		}
+		err = os.WriteFile(filepath.Join(dir, item.Name+".wav"), buf.Bytes(), 0o644)
+		if err != nil {
+			return err
+		}
+
+		var labels bytes.Buffer
+		err = label.WriteAudacity(&labels, item.Labels)
+		if err != nil {
+			return err
+		}
+		err = os.WriteFile(filepath.Join(dir, item.Name+".txt"), labels.Bytes(), 0o644)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CorpusConfig describes a synthetic corpus: utterances of voiced,
+// syllable-modulated harmonics between pauses, over white noise
+type CorpusConfig struct {
+	Items      int
+	SampleRate int
+	Duration   time.Duration
+
+	// dB of the speech over the noise, and of the speech below full scale
+	SNR   float64
+	Level float64
+
+	// ranges the utterance and pause lengths are drawn from
+	MinSpeech time.Duration
+	MaxSpeech time.Duration
+	MinPause  time.Duration
+	MaxPause  time.Duration
+
+	Seed int64
+}
+
+func DefaultCorpusConfig() *CorpusConfig {
+	return &CorpusConfig{
+		Items:      DefaultCorpusItems,
+		SampleRate: DefaultCorpusSampleRate,
+		Duration:   DefaultCorpusDuration,
+		SNR:        DefaultCorpusSNR,
+		Level:      DefaultCorpusLevel,
+		MinSpeech:  DefaultMinSpeech,
+		MaxSpeech:  DefaultMaxSpeech,
+		MinPause:   DefaultMinPause,
+		MaxPause:   DefaultMaxPause,
+		Seed:       1,
+	}
+}
+
+// Validate reports the first field that cannot work
+func (c *CorpusConfig) Validate() error {
+	switch {
+	case c == nil:
+		return ErrInvalidCorpusConfig
+	case c.Items <= 0:
+		return fmt.Errorf("%w: Items must be positive", ErrInvalidCorpusConfig)
+	case c.SampleRate <= 0:
+		return fmt.Errorf("%w: SampleRate must be positive", ErrInvalidCorpusConfig)
+	case c.Duration <= 0:
+		return fmt.Errorf("%w: Duration must be positive", ErrInvalidCorpusConfig)
+	case c.Level > 0:
+		return fmt.Errorf("%w: Level must not be above full scale", ErrInvalidCorpusConfig)
+	case c.MinSpeech <= 0 || c.MaxSpeech < c.MinSpeech:
+		return fmt.Errorf("%w: speech lengths must be positive, MinSpeech up to MaxSpeech", ErrInvalidCorpusConfig)
+	case c.MinPause <= 0 || c.MaxPause < c.MinPause:
+		return fmt.Errorf("%w: pause lengths must be positive, MinPause up to MaxPause", ErrInvalidCorpusConfig)
+	}
+	return nil
+}
+
+// Generate makes a labelled synthetic corpus, the same for the same config.
+// Each item opens with a pause.
+func Generate(cfg *CorpusConfig) ([]*Item, error) {
+	err := cfg.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	rng := rand.New(rand.NewSource(cfg.Seed))
+	items := make([]*Item, cfg.Items)
+	for i := range items {
+		items[i] = generate(cfg, rng, fmt.Sprintf("synthetic_%03d", i))
+	}
+	return items, nil
+}
+
+func generate(cfg *CorpusConfig, rng *rand.Rand, name string) *Item {
+	rate := float64(cfg.SampleRate)
+	n := int(cfg.Duration.Seconds() * rate)
+
+	speechRMS := math.Pow(10, cfg.Level/20) * math.MaxInt32
+	noiseRMS := speechRMS / math.Pow(10, cfg.SNR/20)
+
+	samples := make([]float64, n)
+	for i := range samples {
+		samples[i] = rng.NormFloat64() * noiseRMS
+	}
+
+	var labels []label.Label
+	at := between(rng, cfg.MinPause, cfg.MaxPause)
+	for {
+		length := between(rng, cfg.MinSpeech, cfg.MaxSpeech)
+		if at+length > cfg.Duration {
+			break
+		}
+
+		start, end := int(at.Seconds()*rate), int((at+length).Seconds()*rate)
+		utter(samples[start:end], rate, speechRMS, rng)
+		labels = append(labels, label.Label{Start: at, End: at + length, Name: "speech"})
+
+		at += length + between(rng, cfg.MinPause, cfg.MaxPause)
+	}
+
+	data := make([]int32, n)
+	for i, s := range samples {
+		data[i] = int32(math.Max(math.MinInt32, math.Min(math.MaxInt32, s)))
+	}
+
+	wav := codec.NewDefaultWAV(data)
+	wav.Header.SampleRate = uint32(cfg.SampleRate)
+	wav.Header.ByteRate = uint32(cfg.SampleRate) * 4
+	return &Item{Name: name, WAV: wav, Labels: labels}
+}
+
+// utter adds a voiced utterance: harmonics of a drifting pitch, modulated
+// at a syllable rate so it swells and dips like speech without falling
+// silent, with short fades at either end
+func utter(samples []float64, rate, rms float64, rng *rand.Rand) {
+	pitch := 100 + rng.Float64()*150
+	syllables := 3 + rng.Float64()*3
+	fade := int(0.01 * rate)
+
+	// the harmonics below 3kHz fall off as 1/h; normalize their power
+	power := 0.0
+	harmonics := int(3000 / pitch)
+	for h := 1; h <= harmonics; h++ {
+		power += 1 / float64(h*h) / 2
+	}
+	gain := rms / math.Sqrt(power)
+
+	phase := 0.0
+	for i := range samples {
+		t := float64(i) / rate
+		f0 := pitch * (1 + 0.1*math.Sin(2*math.Pi*0.7*t))
+		phase += 2 * math.Pi * f0 / rate
+
+		envelope := 0.6 + 0.4*math.Sin(2*math.Pi*syllables*t)
+		if i < fade {
+			envelope *= float64(i) / float64(fade)
+		}
+		if len(samples)-i < fade {
+			envelope *= float64(len(samples)-i) / float64(fade)
+		}
+
+		v := 0.0
+		for h := 1; h <= harmonics; h++ {
+			v += math.Sin(float64(h)*phase) / float64(h)
+		}
+		samples[i] += gain * envelope * v
+	}
+}
+
+func between(rng *rand.Rand, min, max time.Duration) time.Duration {
+	return min + time.Duration(rng.Int63n(int64(max-min)+1))
+}
@@ -0,0 +1,24 @@
+// Package eval measures how well a VAD finds speech against labelled ground
+// truth, across sweeps of its parameters.
+package eval
+
+import (
+	"errors"
+
+	"github.com/garlicgarrison/go-recorder/label"
+	"github.com/garlicgarrison/go-recorder/vad"
+)
+
+var (
+	ErrInvalidCorpusConfig = errors.New("invalid corpus config")
+	ErrInvalidParam        = errors.New("invalid sweep parameter")
+)
+
+// Segments converts the segments a VAD found to labels
+func Segments(segments []vad.Segment) []label.Label {
+	labels := make([]label.Label, len(segments))
+	for i, s := range segments {
+		labels[i] = label.Label{Start: s.Start, End: s.End}
+	}
+	return labels
+}
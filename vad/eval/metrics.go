@@ -0,0 +1,175 @@
+package eval
+
+import (
+	"time"
+
+	"github.com/garlicgarrison/go-recorder/label"
+)
+
+// FrameTime is the resolution frames are scored at
+const FrameTime = 10 * time.Millisecond
+
+// Metrics compares the speech a VAD found to ground truth
+type Metrics struct {
+	// frames of FrameTime by whether they were speech and were found to be
+	TruePositives  int
+	FalsePositives int
+	FalseNegatives int
+	TrueNegatives  int
+
+	Precision float64
+	Recall    float64
+	F1        float64
+
+	// fraction of frames without speech found to be speech, the x of an
+	// ROC curve whose y is Recall
+	FalsePositiveRate float64
+
+	// ground truth labels, and those some detection overlaps
+	Labels   int
+	Detected int
+
+	// mean time from the start of the first and end of the last label a
+	// detection overlaps to the start and end of the detection, negative
+	// when early
+	OnsetLatency  time.Duration
+	OffsetLatency time.Duration
+
+	// detections overlapping no label, and how many that is per hour of
+	// audio
+	FalseAlarms        int
+	FalseAlarmsPerHour float64
+
+	Duration time.Duration
+
+	// detections overlapping labels, and the sums of their latencies
+	hits    int
+	onsets  time.Duration
+	offsets time.Duration
+}
+
+// Score compares detected labels to ground truth over audio of a duration
+func Score(truth, detected []label.Label, duration time.Duration) Metrics {
+	m := Metrics{
+		Labels:   len(truth),
+		Duration: duration,
+	}
+
+	speech := frames(truth, duration)
+	found := frames(detected, duration)
+	for i := range speech {
+		switch {
+		case speech[i] && found[i]:
+			m.TruePositives++
+		case found[i]:
+			m.FalsePositives++
+		case speech[i]:
+			m.FalseNegatives++
+		default:
+			m.TrueNegatives++
+		}
+	}
+
+	for _, l := range truth {
+		for _, d := range detected {
+			if overlaps(l, d) {
+				m.Detected++
+				break
+			}
+		}
+	}
+
+	// a detection spanning several labels starts with the first and ends
+	// with the last
+	for _, d := range detected {
+		first, last := -1, -1
+		for i, l := range truth {
+			if overlaps(l, d) {
+				if first < 0 {
+					first = i
+				}
+				last = i
+			}
+		}
+		if first < 0 {
+			m.FalseAlarms++
+			continue
+		}
+
+		m.hits++
+		m.onsets += d.Start - truth[first].Start
+		m.offsets += d.End - truth[last].End
+	}
+
+	m.compute()
+	return m
+}
+
+// Add pools the counts of another score into m, as if over one recording
+func (m *Metrics) Add(other Metrics) {
+	m.TruePositives += other.TruePositives
+	m.FalsePositives += other.FalsePositives
+	m.FalseNegatives += other.FalseNegatives
+	m.TrueNegatives += other.TrueNegatives
+	m.Labels += other.Labels
+	m.Detected += other.Detected
+	m.FalseAlarms += other.FalseAlarms
+	m.Duration += other.Duration
+	m.hits += other.hits
+	m.onsets += other.onsets
+	m.offsets += other.offsets
+	m.compute()
+}
+
+// compute derives the rates from the counts
+func (m *Metrics) compute() {
+	m.Precision = ratio(m.TruePositives, m.TruePositives+m.FalsePositives)
+	m.Recall = ratio(m.TruePositives, m.TruePositives+m.FalseNegatives)
+	m.FalsePositiveRate = ratio(m.FalsePositives, m.FalsePositives+m.TrueNegatives)
+
+	m.F1 = 0
+	if m.Precision+m.Recall > 0 {
+		m.F1 = 2 * m.Precision * m.Recall / (m.Precision + m.Recall)
+	}
+
+	m.OnsetLatency, m.OffsetLatency = 0, 0
+	if m.hits > 0 {
+		m.OnsetLatency = m.onsets / time.Duration(m.hits)
+		m.OffsetLatency = m.offsets / time.Duration(m.hits)
+	}
+
+	m.FalseAlarmsPerHour = 0
+	if m.Duration > 0 {
+		m.FalseAlarmsPerHour = float64(m.FalseAlarms) / m.Duration.Hours()
+	}
+}
+
+// frames marks the frames whose middle some label covers
+func frames(labels []label.Label, duration time.Duration) []bool {
+	marked := make([]bool, int(duration/FrameTime))
+	for _, l := range labels {
+		first := int((l.Start - FrameTime/2 + FrameTime - 1) / FrameTime)
+		if l.Start < FrameTime/2 {
+			first = 0
+		}
+		for i := first; i < len(marked); i++ {
+			middle := time.Duration(i)*FrameTime + FrameTime/2
+			if middle >= l.End {
+				break
+			}
+			marked[i] = true
+		}
+	}
+	return marked
+}
+
+func overlaps(a, b label.Label) bool {
+	return a.Start < b.End && b.Start < a.End
+}
+
+func ratio(n, d int) float64 {
+	if d == 0 {
+		return 0
+	}
+	return float64(n) / float64(d)
+}
@@ -0,0 +1,62 @@
+package eval
+
+import (
+	"testing"
+	"time"
+
+	"github.com/garlicgarrison/go-recorder/label"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScore(t *testing.T) {
+	truth := []label.Label{
+		{Start: 1 * time.Second, End: 2 * time.Second},
+		{Start: 5 * time.Second, End: 6 * time.Second},
+	}
+	detected := []label.Label{
+		{Start: 1100 * time.Millisecond, End: 2200 * time.Millisecond},
+		{Start: 8 * time.Second, End: 8500 * time.Millisecond},
+	}
+
+	m := Score(truth, detected, 10*time.Second)
+
+	// of 1000 frames, 200 speech: 90 found, and 70 more found outside it
+	assert.Equal(t, 90, m.TruePositives)
+	assert.Equal(t, 70, m.FalsePositives)
+	assert.Equal(t, 110, m.FalseNegatives)
+	assert.Equal(t, 730, m.TrueNegatives)
+	assert.InDelta(t, 90.0/160, m.Precision, 1e-9)
+	assert.InDelta(t, 90.0/200, m.Recall, 1e-9)
+	assert.InDelta(t, 2*90.0/(160+200), m.F1, 1e-9)
+	assert.InDelta(t, 70.0/800, m.FalsePositiveRate, 1e-9)
+
+	assert.Equal(t, 2, m.Labels)
+	assert.Equal(t, 1, m.Detected)
+	assert.Equal(t, 100*time.Millisecond, m.OnsetLatency)
+	assert.Equal(t, 200*time.Millisecond, m.OffsetLatency)
+
+	assert.Equal(t, 1, m.FalseAlarms)
+	assert.InDelta(t, 360, m.FalseAlarmsPerHour, 1e-9)
+}
+
+func TestAdd(t *testing.T) {
+	truth := []label.Label{{Start: 1 * time.Second, End: 2 * time.Second}}
+	early := Score(truth, []label.Label{{Start: 900 * time.Millisecond, End: 2 * time.Second}}, 4*time.Second)
+	late := Score(truth, []label.Label{{Start: 1300 * time.Millisecond, End: 2 * time.Second}}, 4*time.Second)
+
+	var m Metrics
+	m.Add(early)
+	m.Add(late)
+	assert.Equal(t, 2, m.Detected)
+	assert.Equal(t, 100*time.Millisecond, m.OnsetLatency)
+	assert.Equal(t, 8*time.Second, m.Duration)
+	assert.Equal(t, early.TruePositives+late.TruePositives, m.TruePositives)
+	assert.InDelta(t, float64(m.TruePositives)/200, m.Recall, 1e-9)
+}
+
+func TestScoreEmpty(t *testing.T) {
+	m := Score(nil, nil, time.Second)
+	assert.Equal(t, 100, m.TrueNegatives)
+	assert.Equal(t, 0.0, m.F1)
+	assert.Equal(t, time.Duration(0), m.OnsetLatency)
+}
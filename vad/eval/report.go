@@ -0,0 +1,155 @@
+package eval
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// ROC orders the points of a sweep by false positive rate, then recall,
+// tracing the ROC curve of the parameters swept
+func ROC(points []Point) []Point {
+	roc := append([]Point(nil), points...)
+	sort.SliceStable(roc, func(i, j int) bool {
+		a, b := roc[i].Metrics, roc[j].Metrics
+		if a.FalsePositiveRate != b.FalsePositiveRate {
+			return a.FalsePositiveRate < b.FalsePositiveRate
+		}
+		return a.Recall < b.Recall
+	})
+	return roc
+}
+
+// Best is the point with the highest F1, false if there are none
+func Best(points []Point) (Point, bool) {
+	if len(points) == 0 {
+		return Point{}, false
+	}
+
+	best := points[0]
+	for _, p := range points[1:] {
+		if p.Metrics.F1 > best.Metrics.F1 {
+			best = p
+		}
+	}
+	return best, true
+}
+
+var metricColumns = []string{
+	"precision",
+	"recall",
+	"f1",
+	"false_positive_rate",
+	"onset_latency_ms",
+	"offset_latency_ms",
+	"false_alarms_per_hour",
+	"labels",
+	"detected",
+	"false_alarms",
+}
+
+// WriteCSV writes a row per point: the swept parameters in name order,
+// then the metrics
+func WriteCSV(w io.Writer, points []Point) error {
+	names := paramNames(points)
+
+	cw := csv.NewWriter(w)
+	err := cw.Write(append(append([]string(nil), names...), metricColumns...))
+	if err != nil {
+		return err
+	}
+
+	for _, p := range points {
+		row := make([]string, 0, len(names)+len(metricColumns))
+		for _, name := range names {
+			row = append(row, formatFloat(p.Params[name]))
+		}
+
+		m := p.Metrics
+		row = append(row,
+			formatFloat(m.Precision),
+			formatFloat(m.Recall),
+			formatFloat(m.F1),
+			formatFloat(m.FalsePositiveRate),
+			formatFloat(milliseconds(m.OnsetLatency)),
+			formatFloat(milliseconds(m.OffsetLatency)),
+			formatFloat(m.FalseAlarmsPerHour),
+			strconv.Itoa(m.Labels),
+			strconv.Itoa(m.Detected),
+			strconv.Itoa(m.FalseAlarms),
+		)
+		err = cw.Write(row)
+		if err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+type jsonPoint struct {
+	Params             map[string]float64 `json:"params"`
+	Precision          float64            `json:"precision"`
+	Recall             float64            `json:"recall"`
+	F1                 float64            `json:"f1"`
+	FalsePositiveRate  float64            `json:"false_positive_rate"`
+	OnsetLatencyMs     float64            `json:"onset_latency_ms"`
+	OffsetLatencyMs    float64            `json:"offset_latency_ms"`
+	FalseAlarmsPerHour float64            `json:"false_alarms_per_hour"`
+	Labels             int                `json:"labels"`
+	Detected           int                `json:"detected"`
+	FalseAlarms        int                `json:"false_alarms"`
+}
+
+// WriteJSON writes the points as a JSON array with the same fields as
+// WriteCSV, the parameters in a params object
+func WriteJSON(w io.Writer, points []Point) error {
+	out := make([]jsonPoint, len(points))
+	for i, p := range points {
+		m := p.Metrics
+		out[i] = jsonPoint{
+			Params:             p.Params,
+			Precision:          m.Precision,
+			Recall:             m.Recall,
+			F1:                 m.F1,
+			FalsePositiveRate:  m.FalsePositiveRate,
+			OnsetLatencyMs:     milliseconds(m.OnsetLatency),
+			OffsetLatencyMs:    milliseconds(m.OffsetLatency),
+			FalseAlarmsPerHour: m.FalseAlarmsPerHour,
+			Labels:             m.Labels,
+			Detected:           m.Detected,
+			FalseAlarms:        m.FalseAlarms,
+		}
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(out)
+}
+
+func paramNames(points []Point) []string {
+	seen := map[string]bool{}
+	var names []string
+	for _, p := range points {
+		for name := range p.Params {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', 6, 64)
+}
@@ -0,0 +1,161 @@
+package eval
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/garlicgarrison/go-recorder/vad"
+)
+
+// params sets the VADConfig fields a sweep can vary, by name
+var params = map[string]func(cfg *vad.VADConfig, v float64){
+	"speech-threshold":      func(cfg *vad.VADConfig, v float64) { cfg.SpeechThreshold = v },
+	"silence-threshold":     func(cfg *vad.VADConfig, v float64) { cfg.SilenceThreshold = v },
+	"voice-timeframe":       func(cfg *vad.VADConfig, v float64) { cfg.VoiceTimeframe = int(v) },
+	"silence-timeframe":     func(cfg *vad.VADConfig, v float64) { cfg.SilenceTimeframe = int(v) },
+	"frame-timeframe":       func(cfg *vad.VADConfig, v float64) { cfg.FrameTimeframe = int(v) },
+	"calibration-timeframe": func(cfg *vad.VADConfig, v float64) { cfg.CalibrationTimeframe = int(v) },
+	"noise-floor-weight":    func(cfg *vad.VADConfig, v float64) { cfg.NoiseFloorWeight = v },
+	"noise-window":          func(cfg *vad.VADConfig, v float64) { cfg.NoiseWindow = int(v) },
+	"speech-probability":    func(cfg *vad.VADConfig, v float64) { cfg.SpeechProbability = v },
+	"silence-probability":   func(cfg *vad.VADConfig, v float64) { cfg.SilenceProbability = v },
+	"smoothing":             func(cfg *vad.VADConfig, v float64) { cfg.Smoothing = v },
+	"aggressiveness":        func(cfg *vad.VADConfig, v float64) { cfg.Aggressiveness = int(v) },
+}
+
+// Params lists the names a sweep can vary
+func Params() []string {
+	names := make([]string, 0, len(params))
+	for name := range params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Param is a VADConfig field and the values a sweep tries for it
+type Param struct {
+	Name   string
+	Values []float64
+}
+
+// ParseParam reads name=v1,v2,... or name=from:to:step, as in
+// speech-threshold=6:18:3
+func ParseParam(spec string) (Param, error) {
+	name, values, ok := strings.Cut(spec, "=")
+	if !ok {
+		return Param{}, fmt.Errorf("%w: %q is not name=values", ErrInvalidParam, spec)
+	}
+	if _, ok := params[name]; !ok {
+		return Param{}, fmt.Errorf("%w: unknown parameter %q", ErrInvalidParam, name)
+	}
+
+	p := Param{Name: name}
+	if bounds := strings.Split(values, ":"); len(bounds) == 3 {
+		var from, to, step float64
+		var err error
+		for i, f := range []*float64{&from, &to, &step} {
+			*f, err = strconv.ParseFloat(bounds[i], 64)
+			if err != nil {
+				return Param{}, fmt.Errorf("%w: %s: %s", ErrInvalidParam, name, err)
+			}
+		}
+		if step <= 0 || to < from {
+			return Param{}, fmt.Errorf("%w: %s: want from:to:step with a positive step up to to", ErrInvalidParam, name)
+		}
+
+		// round the steps so 0.1 increments land on to
+		for i := 0; ; i++ {
+			v := from + float64(i)*step
+			if v > to+step/1e6 {
+				break
+			}
+			p.Values = append(p.Values, math.Round(v*1e9)/1e9)
+		}
+		return p, nil
+	}
+
+	for _, field := range strings.Split(values, ",") {
+		v, err := strconv.ParseFloat(strings.TrimSpace(field), 64)
+		if err != nil {
+			return Param{}, fmt.Errorf("%w: %s: %s", ErrInvalidParam, name, err)
+		}
+		p.Values = append(p.Values, v)
+	}
+	return p, nil
+}
+
+// Point is one combination of a sweep and its metrics pooled over the
+// corpus
+type Point struct {
+	// the value of each swept parameter
+	Params map[string]float64
+
+	Metrics Metrics
+}
+
+// Sweep runs the VAD over every item of a corpus for every combination of
+// the parameters' values, set on copies of base. Combinations base would
+// not validate with are skipped.
+func Sweep(base *vad.VADConfig, sweep []Param, items []*Item) ([]Point, error) {
+	if err := base.Validate(); err != nil {
+		return nil, err
+	}
+	for _, p := range sweep {
+		if _, ok := params[p.Name]; !ok {
+			return nil, fmt.Errorf("%w: unknown parameter %q", ErrInvalidParam, p.Name)
+		}
+		if len(p.Values) == 0 {
+			return nil, fmt.Errorf("%w: %s has no values", ErrInvalidParam, p.Name)
+		}
+	}
+
+	var points []Point
+	combination := make([]int, len(sweep))
+	for {
+		cfg := *base
+		values := make(map[string]float64, len(sweep))
+		for i, p := range sweep {
+			params[p.Name](&cfg, p.Values[combination[i]])
+			values[p.Name] = p.Values[combination[i]]
+		}
+
+		if cfg.Validate() == nil {
+			m, err := Evaluate(&cfg, items)
+			if err != nil {
+				return nil, err
+			}
+			points = append(points, Point{Params: values, Metrics: m})
+		}
+
+		// the next combination, the last parameter varying fastest
+		i := len(sweep) - 1
+		for ; i >= 0; i-- {
+			combination[i]++
+			if combination[i] < len(sweep[i].Values) {
+				break
+			}
+			combination[i] = 0
+		}
+		if i < 0 {
+			return points, nil
+		}
+	}
+}
+
+// Evaluate runs the VAD over every item of a corpus, at each item's own
+// sample rate and channel count, and pools the metrics
+func Evaluate(cfg *vad.VADConfig, items []*Item) (Metrics, error) {
+	var m Metrics
+	for _, item := range items {
+		segments, err := vad.AnalyzeFile(cfg, item.WAV)
+		if err != nil {
+			return Metrics{}, fmt.Errorf("%s: %w", item.Name, err)
+		}
+		m.Add(Score(item.Labels, Segments(segments), item.Duration()))
+	}
+	return m, nil
+}
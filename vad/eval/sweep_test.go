@@ -0,0 +1,135 @@
+package eval
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/garlicgarrison/go-recorder/label"
+	"github.com/garlicgarrison/go-recorder/vad"
+	"github.com/stretchr/testify/assert"
+)
+
+func testCorpus(t *testing.T) []*Item {
+	cfg := DefaultCorpusConfig()
+	cfg.Items = 2
+	cfg.Duration = 10 * time.Second
+	items, err := Generate(cfg)
+	assert.NoError(t, err)
+	return items
+}
+
+func TestParseParam(t *testing.T) {
+	p, err := ParseParam("speech-threshold=6:12:3")
+	assert.NoError(t, err)
+	assert.Equal(t, Param{Name: "speech-threshold", Values: []float64{6, 9, 12}}, p)
+
+	p, err = ParseParam("smoothing=0:0.3:0.1")
+	assert.NoError(t, err)
+	assert.Equal(t, []float64{0, 0.1, 0.2, 0.3}, p.Values)
+
+	p, err = ParseParam("aggressiveness=0, 3")
+	assert.NoError(t, err)
+	assert.Equal(t, []float64{0, 3}, p.Values)
+
+	for _, spec := range []string{"smoothing", "loudness=1", "smoothing=a", "smoothing=1:0:1", "smoothing=0:1:0"} {
+		_, err = ParseParam(spec)
+		assert.ErrorIs(t, err, ErrInvalidParam, spec)
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	items := testCorpus(t)
+	assert.Len(t, items, 2)
+	for _, item := range items {
+		assert.Equal(t, 10*time.Second, item.Duration())
+		assert.NotEmpty(t, item.Labels)
+		for _, l := range item.Labels {
+			assert.GreaterOrEqual(t, l.End-l.Start, DefaultMinSpeech)
+			assert.LessOrEqual(t, l.End, 10*time.Second)
+		}
+	}
+
+	again := testCorpus(t)
+	assert.Equal(t, items[1].Labels, again[1].Labels)
+	assert.Equal(t, items[1].WAV.Data, again[1].WAV.Data)
+
+	_, err := Generate(&CorpusConfig{})
+	assert.ErrorIs(t, err, ErrInvalidCorpusConfig)
+}
+
+func TestCorpusFiles(t *testing.T) {
+	dir := t.TempDir()
+	items := testCorpus(t)
+	assert.NoError(t, WriteCorpus(dir, items))
+
+	loaded, err := LoadCorpus(dir)
+	assert.NoError(t, err)
+	assert.Len(t, loaded, 2)
+	assert.Equal(t, items[0].Name, loaded[0].Name)
+	assert.Equal(t, items[0].WAV.Data, loaded[0].WAV.Data)
+	assert.Equal(t, uint32(DefaultCorpusSampleRate), loaded[0].WAV.Header.SampleRate)
+	assert.Len(t, loaded[0].Labels, len(items[0].Labels))
+
+	_, err = LoadCorpus(t.TempDir())
+	assert.ErrorIs(t, err, label.ErrInvalidLabels)
+}
+
+func TestSweep(t *testing.T) {
+	items := testCorpus(t)
+	sweep := []Param{
+		{Name: "speech-threshold", Values: []float64{6, 40}},
+		// SilenceThreshold above SpeechThreshold does not validate
+		{Name: "silence-threshold", Values: []float64{3, 10}},
+	}
+
+	points, err := Sweep(vad.DefaultVADConfig(), sweep, items)
+	assert.NoError(t, err)
+	assert.Len(t, points, 3)
+
+	// a low threshold finds the speech, one far above it nothing
+	assert.Equal(t, map[string]float64{"speech-threshold": 6, "silence-threshold": 3}, points[0].Params)
+	assert.Greater(t, points[0].Metrics.F1, 0.8)
+	assert.Less(t, points[0].Metrics.OnsetLatency, 500*time.Millisecond)
+	assert.Greater(t, points[0].Metrics.OnsetLatency, -500*time.Millisecond)
+	assert.Equal(t, 0, points[2].Metrics.TruePositives+points[2].Metrics.FalsePositives)
+
+	best, ok := Best(points)
+	assert.True(t, ok)
+	assert.Equal(t, points[0].Metrics.F1, best.Metrics.F1)
+
+	roc := ROC(points)
+	for i := 1; i < len(roc); i++ {
+		assert.LessOrEqual(t, roc[i-1].Metrics.FalsePositiveRate, roc[i].Metrics.FalsePositiveRate)
+	}
+
+	_, err = Sweep(vad.DefaultVADConfig(), []Param{{Name: "loudness", Values: []float64{1}}}, items)
+	assert.ErrorIs(t, err, ErrInvalidParam)
+}
+
+func TestReports(t *testing.T) {
+	points := []Point{{
+		Params: map[string]float64{"smoothing": 0.3, "speech-threshold": 12},
+		Metrics: Score(
+			[]label.Label{{Start: time.Second, End: 2 * time.Second}},
+			[]label.Label{{Start: 1100 * time.Millisecond, End: 2 * time.Second}},
+			4*time.Second),
+	}}
+
+	var csv bytes.Buffer
+	assert.NoError(t, WriteCSV(&csv, points))
+	lines := strings.Split(strings.TrimSpace(csv.String()), "\n")
+	assert.Len(t, lines, 2)
+	assert.True(t, strings.HasPrefix(lines[0], "smoothing,speech-threshold,precision,recall,f1,"))
+	assert.True(t, strings.HasPrefix(lines[1], "0.3,12,1,0.9,"))
+
+	var out bytes.Buffer
+	assert.NoError(t, WriteJSON(&out, points))
+	var decoded []map[string]interface{}
+	assert.NoError(t, json.Unmarshal(out.Bytes(), &decoded))
+	assert.Len(t, decoded, 1)
+	assert.Equal(t, 100.0, decoded[0]["onset_latency_ms"])
+	assert.Equal(t, 0.9, decoded[0]["recall"])
+}
@@ -0,0 +1,112 @@
+package vad
+
+import "math"
+
+// NoiseTracking is how a detector follows the noise floor once calibrated
+type NoiseTracking string
+
+const (
+	// moves the floor towards frames judged not to be speech by
+	// NoiseFloorWeight per VoiceTimeframe
+	AverageTracking NoiseTracking = "average"
+
+	// takes the floor from the minimum of the smoothed frame power over the
+	// last NoiseWindow, speech or not (Martin, 2001). It falls as soon as
+	// the background does and rises within NoiseWindow of it, without
+	// depending on how the frames were judged.
+	MinimumTracking NoiseTracking = "minimum"
+)
+
+const (
+	DefaultNoiseWindow = 1500 // milliseconds
+
+	// milliseconds: time constant of the frame power smoothing before the
+	// minimum is taken
+	minimumSmoothingTime = 100
+
+	// the window is searched in this many subwindows, so an old minimum
+	// leaves it a subwindow at a time
+	minimumSubwindows = 8
+
+	// the minimum of smoothed noise power sits below its mean; this scales
+	// it back up
+	minimumBias = 1.1
+)
+
+// MinimumTracker follows a noise floor in power by minimum statistics.
+// Each frame's power is smoothed, and the floor is the smallest smoothed
+// power over a window, kept as the minima of subwindows so the window can
+// slide without holding every frame.
+type MinimumTracker struct {
+	alpha float64
+
+	smoothed float64
+	minima   []float64 // of the completed subwindows, oldest first
+	current  float64   // of the subwindow being filled
+	frames   int
+	length   int // frames per subwindow
+
+	floor float64
+}
+
+// NewMinimumTracker tracks frames of frameMs milliseconds over
+// cfg.NoiseWindow
+func NewMinimumTracker(cfg *VADConfig, frameMs float64) *MinimumTracker {
+	frames := float64(cfg.NoiseWindow) / frameMs / minimumSubwindows
+	return &MinimumTracker{
+		alpha:  math.Exp(-frameMs / minimumSmoothingTime),
+		minima: make([]float64, 0, minimumSubwindows),
+		length: int(math.Max(1, math.Round(frames))),
+	}
+}
+
+// newTracker is the MinimumTracker for frames of frameMs milliseconds when
+// cfg asks for MinimumTracking, otherwise nil
+func newTracker(cfg *VADConfig, frameMs float64) *MinimumTracker {
+	if cfg.NoiseTracking != MinimumTracking {
+		return nil
+	}
+	return NewMinimumTracker(cfg, frameMs)
+}
+
+// Reset starts over from a measured floor power, as if the whole window
+// had been at it
+func (t *MinimumTracker) Reset(power float64) {
+	least := power / minimumBias
+	t.smoothed = power
+	t.minima = t.minima[:0]
+	for i := 0; i < cap(t.minima)-1; i++ {
+		t.minima = append(t.minima, least)
+	}
+	t.current = least
+	t.frames = 0
+	t.floor = power
+}
+
+// Update takes the power of the next frame and returns the floor
+func (t *MinimumTracker) Update(power float64) float64 {
+	t.smoothed = t.alpha*t.smoothed + (1-t.alpha)*power
+	t.current = math.Min(t.current, t.smoothed)
+
+	t.frames++
+	if t.frames == t.length {
+		if len(t.minima) == cap(t.minima) {
+			t.minima = t.minima[:copy(t.minima, t.minima[1:])]
+		}
+		t.minima = append(t.minima, t.current)
+		t.current = t.smoothed
+		t.frames = 0
+	}
+
+	least := t.current
+	for _, m := range t.minima {
+		least = math.Min(least, m)
+	}
+	t.floor = least * minimumBias
+	return t.floor
+}
+
+// Floor is the current floor power
+func (t *MinimumTracker) Floor() float64 {
+	return t.floor
+}
@@ -0,0 +1,74 @@
+package vad
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMinimumTracker(t *testing.T) {
+	cfg := DefaultVADConfig()
+	tracker := NewMinimumTracker(cfg, 20) // 75 frames, subwindows of 9
+
+	tracker.Reset(100)
+	assert.Equal(t, 100.0, tracker.Floor())
+
+	// a burst shorter than the window leaves the floor alone
+	for i := 0; i < 30; i++ {
+		tracker.Update(1e6)
+	}
+	for i := 0; i < 10; i++ {
+		tracker.Update(100)
+	}
+	assert.InDelta(t, 100, tracker.Floor(), 1)
+
+	// a louder background becomes the floor within the window
+	for i := 0; i < 90; i++ {
+		tracker.Update(1e4)
+	}
+	assert.InDelta(t, 1e4*minimumBias, tracker.Floor(), 1)
+
+	// and a quieter one as soon as the smoothing lets it
+	for i := 0; i < 60; i++ {
+		tracker.Update(10)
+	}
+	assert.InDelta(t, 10*minimumBias, tracker.Floor(), 1)
+}
+
+func TestMinimumTracking(t *testing.T) {
+	// the background steps up 40dB after 40 buffers, like a fan turning
+	// on, and stays
+	samples := tone(1e6, 64*40)
+	samples = append(samples, tone(1e8, 64*100)...)
+
+	average := newVAD(t)
+	average.Process(samples)
+
+	// judged speech, the new background never moves the floor
+	assert.True(t, average.Speaking())
+	assert.Less(t, average.NoiseFloor(), 1e7)
+
+	cfg := testConfig()
+	cfg.NoiseTracking = MinimumTracking
+	minimum, err := NewVAD(cfg)
+	assert.NoError(t, err)
+	events := minimum.Process(samples)
+
+	// the floor follows it within NoiseWindow, ending the false speech
+	assert.Len(t, events, 2)
+	assert.False(t, minimum.Speaking())
+	assert.InDelta(t, 1e8/1.414, minimum.NoiseFloor(), 1e8*0.1)
+}
+
+func TestMinimumTrackingSpectral(t *testing.T) {
+	cfg := spectralConfig(SpectralMethod)
+	cfg.NoiseTracking = MinimumTracking
+	v, err := NewVAD(cfg)
+	assert.NoError(t, err)
+
+	v.Process(tone(1e6, 16000))
+	quiet := v.NoiseFloor()
+	v.Process(tone(1e8, 16000*3))
+	assert.Greater(t, v.NoiseFloor(), quiet*50)
+	assert.False(t, v.Speaking())
+}
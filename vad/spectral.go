@@ -0,0 +1,215 @@
+package vad
+
+import (
+	"math"
+
+	"github.com/garlicgarrison/go-recorder/dsp"
+)
+
+const (
+	// the band holding most of the energy of speech
+	SpeechBandLow  = 300.0  // Hz
+	SpeechBandHigh = 3400.0 // Hz
+
+	// milliseconds per analysis frame, rounded up to a power of two samples
+	SpectralFrameTime = 20
+
+	// zero crossings per second above which a frame sounds more like hiss
+	// or clicks than speech
+	maxSpeechZCR = 3000.0
+
+	// keeps the log of an empty bin finite
+	minBinPower = 1e-9
+)
+
+// SpectralDetector scores short frames on three features:
+//
+//   - energy in the speech band, in dB above the band's noise floor, so hum
+//     and rumble below the band do not count
+//   - spectral flatness across the band, which is high for noise and
+//     transients and low for the harmonics of voiced speech
+//   - zero-crossing rate, which is high for hiss and keyboard clicks
+//
+// Its analysis frames are SpectralFrameTime long whatever the VAD's frames,
+// so a VAD frame scores the mean of the analysis frames completed in it, or
+// the last score if none were. With AverageTracking, analysis frames at or
+// below SilenceProbability move the floor; with MinimumTracking every
+// analysis frame's band power goes to a MinimumTracker.
+type SpectralDetector struct {
+	cfg    *VADConfig
+	fft    *dsp.FFT
+	window []float64
+	scale  float64 // turns summed bin power into mean square amplitude
+
+	low, high int // speech band bins
+
+	// the frame being filled, mixed down to mono
+	mixer *dsp.Downmix
+	mono  []float64
+	frame []float64
+	power []float64
+
+	// calibration, in samples
+	calibrationWindow int
+	calibrated        bool
+	calibrationSum    float64
+	calibrationFrames int
+	samples           int
+
+	// scores of the analysis frames completed in the current VAD frame
+	frames  int
+	probSum float64
+	last    float64
+
+	floor   float64         // speech band power, 0 until calibrated
+	tracker *MinimumTracker // nil for AverageTracking
+}
+
+func NewSpectralDetector(cfg *VADConfig) *SpectralDetector {
+	size := dsp.NextPowerOfTwo(int(math.Ceil(cfg.SampleRate * SpectralFrameTime / 1000)))
+	fft, _ := dsp.NewFFT(size)
+	window := dsp.Hann(size)
+
+	windowPower := 0.0
+	for _, w := range window {
+		windowPower += w * w
+	}
+
+	binWidth := cfg.SampleRate / float64(size)
+	high := int(SpeechBandHigh / binWidth)
+	if high > size/2 {
+		high = size / 2
+	}
+
+	return &SpectralDetector{
+		cfg:               cfg,
+		fft:               fft,
+		window:            window,
+		scale:             2 / (float64(size) * windowPower),
+		low:               int(math.Ceil(SpeechBandLow / binWidth)),
+		high:              high,
+		mixer:             dsp.NewDownmix(cfg.InputChannels),
+		frame:             make([]float64, 0, size),
+		power:             make([]float64, 0, size/2+1),
+		calibrationWindow: cfg.window(cfg.CalibrationTimeframe),
+		tracker:           newTracker(cfg, float64(size)/cfg.SampleRate*1000),
+	}
+}
+
+func (d *SpectralDetector) Probability(frame []int32) float64 {
+	d.mono = d.mixer.Add(frame, d.mono[:0])
+	for _, amp := range d.mono {
+		d.frame = append(d.frame, amp)
+		if len(d.frame) == cap(d.frame) {
+			d.analyze()
+			d.frame = d.frame[:0]
+		}
+	}
+
+	if !d.calibrated {
+		d.samples += len(frame)
+		if d.samples >= d.calibrationWindow {
+			d.calibrate()
+		}
+		d.frames = 0
+		d.probSum = 0
+		return 0
+	}
+
+	if d.frames > 0 {
+		d.last = d.probSum / float64(d.frames)
+		d.frames = 0
+		d.probSum = 0
+	}
+	return d.last
+}
+
+func (d *SpectralDetector) analyze() {
+	d.power = d.fft.Power(d.frame, d.window, d.power[:0])
+
+	band, logBand := 0.0, 0.0
+	for _, p := range d.power[d.low : d.high+1] {
+		p += minBinPower
+		band += p
+		logBand += math.Log(p)
+	}
+	bins := float64(d.high - d.low + 1)
+	flatness := math.Exp(logBand/bins) / (band / bins)
+	bandPower := band * d.scale
+
+	crossings := 0
+	for i := 1; i < len(d.frame); i++ {
+		if (d.frame[i-1] < 0) != (d.frame[i] < 0) {
+			crossings++
+		}
+	}
+	zcr := float64(crossings) * d.cfg.SampleRate / float64(len(d.frame))
+
+	if !d.calibrated {
+		d.calibrationSum += bandPower
+		d.calibrationFrames++
+		return
+	}
+
+	p := d.probability(bandPower, flatness, zcr)
+	d.frames++
+	d.probSum += p
+
+	if d.tracker != nil {
+		d.floor = math.Max(d.tracker.Update(bandPower), minNoiseFloor)
+		return
+	}
+
+	// a frame between the thresholds may be quiet speech, it must not
+	// raise the floor
+	if p <= d.cfg.SilenceProbability {
+		d.floor = track(d.floor, bandPower, frameWeight(d.cfg, len(d.frame)*d.cfg.InputChannels))
+	}
+}
+
+// probability combines the features of a frame into a speech probability.
+// Band energy, mapped through the thresholds as EnergyDetector maps its
+// level, gates the other two: a quiet frame is not speech however it is
+// shaped, and a noisy one scores lower than its level alone would.
+func (d *SpectralDetector) probability(bandPower, flatness, zcr float64) float64 {
+	level := 10 * math.Log10(bandPower/d.floor)
+	energy := levelProbability(d.cfg, level)
+
+	crossing := 1.0
+	if zcr > maxSpeechZCR {
+		crossing = math.Max(0, 2-zcr/maxSpeechZCR)
+	}
+
+	return energy * (0.3 + 0.7*(1-flatness)) * (0.5 + 0.5*crossing)
+}
+
+// calibrate takes the mean band power of the analysis frames so far as the
+// floor
+func (d *SpectralDetector) calibrate() {
+	band := 0.0
+	if d.calibrationFrames > 0 {
+		band = d.calibrationSum / float64(d.calibrationFrames)
+	}
+	d.floor = math.Max(band, minNoiseFloor)
+	d.calibrated = true
+	if d.tracker != nil {
+		d.tracker.Reset(d.floor)
+	}
+}
+
+func (d *SpectralDetector) Calibrated() bool {
+	return d.calibrated
+}
+
+func (d *SpectralDetector) Recalibrate() {
+	d.calibrated = false
+	d.calibrationSum = 0
+	d.calibrationFrames = 0
+	d.samples = 0
+	d.last = 0
+	d.floor = 0
+}
+
+func (d *SpectralDetector) NoiseFloor() float64 {
+	return math.Sqrt(d.floor)
+}
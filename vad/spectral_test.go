@@ -0,0 +1,142 @@
+package vad
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func spectralConfig(method Method) *VADConfig {
+	cfg := DefaultVADConfig()
+	cfg.Method = method
+	cfg.SampleRate = 16000
+	cfg.FramesPerBuffer = 160
+	return cfg
+}
+
+func noise(rms float64, n int, rng *rand.Rand) []int32 {
+	samples := make([]int32, n)
+	for i := range samples {
+		samples[i] = int32(rng.NormFloat64() * rms)
+	}
+	return samples
+}
+
+// voiced is a 150Hz buzz with harmonics up to 3kHz, roughly a vowel
+func voiced(rms float64, n int, rng *rand.Rand) []int32 {
+	samples := noise(1e6, n, rng)
+	for h := 1; h*150 <= 3000; h++ {
+		amplitude := rms * math.Sqrt2 / float64(h) / 1.2
+		for i := range samples {
+			samples[i] += int32(amplitude * math.Sin(2*math.Pi*150*float64(h*i)/16000))
+		}
+	}
+	return samples
+}
+
+func starts(events []Event) int {
+	n := 0
+	for _, e := range events {
+		if e.Type == SpeechStart {
+			n++
+		}
+	}
+	return n
+}
+
+func TestSpectralIgnoresNoise(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	quiet := noise(1e6, 16000, rng)
+	burst := noise(5e7, 8000, rng)
+
+	for _, c := range []struct {
+		method Method
+		starts int
+	}{
+		{EnergyMethod, 1},
+		{SpectralMethod, 0},
+	} {
+		v, err := NewVAD(spectralConfig(c.method))
+		assert.NoError(t, err)
+
+		events := v.Process(quiet)
+		events = append(events, v.Process(burst)...)
+		assert.Equal(t, c.starts, starts(events), "%s", c.method)
+	}
+}
+
+func TestSpectralSpeech(t *testing.T) {
+	rng := rand.New(rand.NewSource(2))
+	v, err := NewVAD(spectralConfig(SpectralMethod))
+	assert.NoError(t, err)
+
+	assert.Empty(t, v.Process(noise(1e6, 16000, rng)))
+	assert.Greater(t, v.NoiseFloor(), 0.0)
+
+	events := v.Process(voiced(2e7, 16000, rng))
+	assert.Len(t, events, 1)
+	assert.Equal(t, SpeechStart, events[0].Type)
+	assert.Less(t, events[0].Offset, uint64(16000+4800))
+
+	events = v.Process(noise(1e6, 32000, rng))
+	assert.Len(t, events, 1)
+	assert.Equal(t, SpeechEnd, events[0].Type)
+}
+
+func TestSpectralIgnoresHum(t *testing.T) {
+	// a loud 50Hz hum lies below the speech band, quiet speech on top of
+	// it is still found
+	rng := rand.New(rand.NewSource(3))
+	hum := func(n int) []int32 {
+		samples := noise(1e6, n, rng)
+		for i := range samples {
+			samples[i] += int32(3e8 * math.Sin(2*math.Pi*50*float64(i)/16000))
+		}
+		return samples
+	}
+
+	v, err := NewVAD(spectralConfig(SpectralMethod))
+	assert.NoError(t, err)
+	assert.Empty(t, v.Process(hum(16000)))
+
+	speech := hum(16000)
+	for i, s := range voiced(2e7, 16000, rng) {
+		speech[i] += s
+	}
+	assert.Equal(t, 1, starts(v.Process(speech)))
+}
+
+func TestValidateMethod(t *testing.T) {
+	cfg := DefaultVADConfig()
+	cfg.Method = "neural"
+	assert.ErrorIs(t, cfg.Validate(), ErrInvalidVADConfig)
+
+	cfg = spectralConfig(SpectralMethod)
+	cfg.SilenceProbability = 0.9
+	assert.ErrorIs(t, cfg.Validate(), ErrInvalidVADConfig)
+}
+
+// a frame shaped like speech scores its level through both thresholds
+func TestSpectralThresholds(t *testing.T) {
+	cfg := spectralConfig(SpectralMethod)
+	cfg.SilenceThreshold = 6
+	cfg.SpeechThreshold = 18
+	cfg.SilenceProbability = 0.1
+	cfg.SpeechProbability = 0.7
+	d := NewSpectralDetector(cfg)
+	d.floor = 1
+
+	power := func(db float64) float64 {
+		return math.Pow(10, db/10)
+	}
+	assert.InDelta(t, 0.1, d.probability(power(6), 0, 0), 1e-9)
+	assert.InDelta(t, 0.4, d.probability(power(12), 0, 0), 1e-9)
+	assert.InDelta(t, 0.7, d.probability(power(18), 0, 0), 1e-9)
+	assert.Equal(t, 0.0, d.probability(power(0), 0, 0))
+	assert.Equal(t, 1.0, d.probability(power(40), 0, 0))
+
+	// a flat spectrum scores lower at the same level
+	assert.Less(t, d.probability(power(18), 1, 0), 0.7)
+}
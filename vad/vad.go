@@ -1,154 +1,597 @@
 package vad
 
 import (
-	"log"
+	"errors"
+	"fmt"
 	"math"
+
+	"github.com/garlicgarrison/go-recorder/vad/webrtc"
+)
+
+const (
+	DefaultCalibrationTimeframe = 500
+	DefaultVoiceTimeframe       = 300
+	DefaultSilenceTimeframe     = 750
+	DefaultFrameTimeframe       = 20
+	DefaultInputChannels        = 1
+	DefaultSampleRate           = 22050
+	DefaultFramesPerBuffer      = 64
+
+	DefaultSpeechThreshold  = 12.0 // dB above the noise floor
+	DefaultSilenceThreshold = 3.0  // dB above the noise floor
+	DefaultNoiseFloorWeight = 0.3
+
+	DefaultSpeechProbability  = 0.5
+	DefaultSilenceProbability = 0.2
+	DefaultSmoothing          = 0.3
+
+	// the noise floor never drops below this RMS, so digital silence
+	// during calibration does not make every sound speech
+	minNoiseFloor = 1.0
+)
+
+var (
+	ErrInvalidVADConfig = errors.New("invalid vad config")
 )
 
-type Detection string
+// Method is the built-in detector a VAD scores frames with
+type Method string
 
 const (
-	DefaultSampleInterval   = 500
-	DefaultVoiceTimeframe   = 5
-	DefaultSilenceTimeframe = 12
-	DefaultInputChannels    = 1
-	DefaultSampleRate       = 22050
-	DefaultFramesPerBuffer  = 64
-
-	DefaultAMBAVG                  = 500000000.0
-	DefaultSpeechAMBAVGMultiplier  = 4
-	DefaultSilenceAMBAVGMultiplier = 1 // max: 1
-
-	NewSilenceThresholdWeight = 0.3 // max: 1
-	AudioChanSize             = 64
-
-	SpeechDetection  Detection = "speech"
-	SilenceDetection Detection = "silence"
+	// EnergyMethod compares the RMS of a frame to the noise floor
+	EnergyMethod Method = "energy"
+
+	// SpectralMethod scores short frames on speech band energy, spectral
+	// flatness and zero-crossing rate
+	SpectralMethod Method = "spectral"
+
+	// WebRTCMethod runs the WebRTC GMM detector and scores each frame with
+	// the fraction of its 20ms frames called speech
+	WebRTCMethod Method = "webrtc"
+)
+
+type EventType string
+
+const (
+	SpeechStart EventType = "speech_start"
+	SpeechEnd   EventType = "speech_end"
 )
 
+// Event marks a change between silence and speech
+type Event struct {
+	Type EventType
+
+	// samples passed to Process since the VAD was created or reset, up to
+	// the start of the frame where the speech or silence that caused the
+	// event began
+	Offset uint64
+
+	// 0 right at the threshold, approaching 1 as the smoothed probability
+	// moves away from it
+	Confidence float64
+
+	// SpeechEnd with a NonSpeech config only: what the audio from the
+	// SpeechStart sounded like. The VAD cannot take back the SpeechStart,
+	// so dropping is left to the consumer.
+	Class Class
+}
+
 type VADConfig struct {
-	// milliseconds
-	SpeechAMBAVGMultiplier  int
-	SilenceAMBAVGMultiplier float64
+	// empty means EnergyMethod. Ignored by NewVADWithDetector.
+	Method Method
+
+	// EnergyMethod and SpectralMethod only: dB above the noise floor that
+	// is as likely to be speech as SpeechProbability, and as
+	// SilenceProbability. SpectralMethod scales this down for frames whose
+	// spectrum is flat or crosses zero too often to be speech.
+	SpeechThreshold  float64
+	SilenceThreshold float64
+
+	// milliseconds, rounded up to whole buffers: how long the probability
+	// must stay above SpeechProbability to start speech, and at or below
+	// SilenceProbability to end it, the length of the frames scored, and
+	// the audio at the start used to measure the noise floor
+	VoiceTimeframe       int
+	SilenceTimeframe     int
+	FrameTimeframe       int
+	CalibrationTimeframe int
+
+	// EnergyMethod and SpectralMethod only: how the noise floor follows
+	// the background after calibration, empty meaning AverageTracking
+	NoiseTracking NoiseTracking
+
+	// AverageTracking: weight towards the level of quiet audio the noise
+	// floor moves over each VoiceTimeframe of it, from 0 (fixed after
+	// calibration) to 1
+	NoiseFloorWeight float64
+
+	// MinimumTracking: milliseconds the minimum is taken over, how long a
+	// louder background takes to become the floor
+	NoiseWindow int
 
-	VoiceTimeframe    int
-	SilenceTimeframe  int
-	SamplingTimeframe int
+	// the smoothed frame probability above which speech starts, and at or
+	// below which it ends
+	SpeechProbability  float64
+	SilenceProbability float64
+
+	// weight of the previous smoothed probability against a new frame's,
+	// from 0 (no smoothing) towards 1
+	Smoothing float64
+
+	// WebRTCMethod only: the detector's mode, from 0 (lets the most
+	// through) to 3 (rejects the most non-speech)
+	Aggressiveness int
+
+	// with more than one input channel, runs the detector and decisions
+	// per channel and combines them by this policy, empty meaning the
+	// channels are scored together
+	ChannelPolicy ChannelPolicy
+
+	// WeightedChannels only: a weight per input channel, nil meaning equal
+	// weights
+	ChannelWeights []float64
+
+	// whether to classify speech as speech, music or noise, and what to do
+	// with what is not speech, empty meaning speech is not classified
+	NonSpeech NonSpeech
 
 	SampleRate      float64
 	InputChannels   int
 	FramesPerBuffer int
 }
 
-// the average has weight towards recent ambient noise
+// Detector scores frames of interleaved samples with the probability, from
+// 0 to 1, that they are speech. The VAD calls it with consecutive frames of
+// the stream, FrameTimeframe long each, and layers smoothing, hysteresis
+// and minimum durations on top.
+type Detector interface {
+	Probability(frame []int32) float64
+}
+
+// DetectorFunc is a Detector from a plain function
+type DetectorFunc func(frame []int32) float64
+
+func (f DetectorFunc) Probability(frame []int32) float64 {
+	return f(frame)
+}
+
+// Calibrator is a Detector that measures the noise floor before it starts
+// detecting, and scores frames 0 until then
+type Calibrator interface {
+	Detector
+
+	Calibrated() bool
+	Recalibrate()
+
+	// NoiseFloor is an RMS amplitude, 0 until calibrated
+	NoiseFloor() float64
+}
+
+// VAD is a state machine fed buffer by buffer. It cuts the samples into
+// frames, has the detector score each, and smooths the scores. Speech starts
+// once the smoothed probability has stayed above SpeechProbability for
+// VoiceTimeframe, and ends once it has stayed at or below SilenceProbability
+// for SilenceTimeframe, so brief clicks and pauses do not switch it.
+//
+// A VAD is not safe for concurrent use.
 type VAD struct {
-	cfg            *VADConfig
-	ambAvg         float32
-	audioChan      chan []int32
-	speechWindows  int
-	silenceWindows int
-	sampleWindows  int
+	cfg      *VADConfig
+	detector Detector
+	handler  func(Event)
+
+	// lengths in samples, the durations in whole frames
+	frameSize  int
+	minSpeech  int
+	minSilence int
+
+	// the frame being filled, and the offset of its start
+	frame      []int32
+	frameStart uint64
+
+	speaking    bool
+	offset      uint64 // samples processed
+	probability float64
+
+	// the run of frames past the threshold towards a switch
+	run      int
+	runStart uint64
+
+	// with a NonSpeech config, measures the frames, and where the speech
+	// it is to classify started
+	classifier  *Classifier
+	speechStart uint64
 }
 
 func DefaultVADConfig() *VADConfig {
 	return &VADConfig{
-		SpeechAMBAVGMultiplier:  DefaultSpeechAMBAVGMultiplier,
-		SilenceAMBAVGMultiplier: DefaultSilenceAMBAVGMultiplier,
-		VoiceTimeframe:          DefaultVoiceTimeframe,
-		SilenceTimeframe:        DefaultSilenceTimeframe,
-		SamplingTimeframe:       DefaultSampleInterval,
-		SampleRate:              DefaultSampleRate,
-		InputChannels:           DefaultInputChannels,
-		FramesPerBuffer:         DefaultFramesPerBuffer,
+		SpeechThreshold:      DefaultSpeechThreshold,
+		SilenceThreshold:     DefaultSilenceThreshold,
+		VoiceTimeframe:       DefaultVoiceTimeframe,
+		SilenceTimeframe:     DefaultSilenceTimeframe,
+		FrameTimeframe:       DefaultFrameTimeframe,
+		CalibrationTimeframe: DefaultCalibrationTimeframe,
+		NoiseFloorWeight:     DefaultNoiseFloorWeight,
+		NoiseWindow:          DefaultNoiseWindow,
+		SpeechProbability:    DefaultSpeechProbability,
+		SilenceProbability:   DefaultSilenceProbability,
+		Smoothing:            DefaultSmoothing,
+		Aggressiveness:       DefaultAggressiveness,
+		SampleRate:           DefaultSampleRate,
+		InputChannels:        DefaultInputChannels,
+		FramesPerBuffer:      DefaultFramesPerBuffer,
 	}
 }
 
-func NewVAD(cfg *VADConfig) *VAD {
-	return &VAD{
-		cfg:            cfg,
-		ambAvg:         DefaultAMBAVG,
-		audioChan:      make(chan []int32, AudioChanSize),
-		speechWindows:  int((float32(cfg.VoiceTimeframe) / 1000.0) * float32(cfg.SampleRate)),
-		silenceWindows: int((float32(cfg.SilenceTimeframe) / 1000.0) * float32(cfg.SampleRate)),
-		sampleWindows:  int((float32(cfg.SamplingTimeframe) / 1000.0) * float32(cfg.SampleRate)),
+// Validate reports the first field that cannot work
+func (c *VADConfig) Validate() error {
+	switch {
+	case c == nil:
+		return ErrInvalidVADConfig
+	case c.SampleRate <= 0:
+		return fmt.Errorf("%w: SampleRate must be positive", ErrInvalidVADConfig)
+	case c.InputChannels <= 0:
+		return fmt.Errorf("%w: InputChannels must be positive", ErrInvalidVADConfig)
+	case c.FramesPerBuffer <= 0:
+		return fmt.Errorf("%w: FramesPerBuffer must be positive", ErrInvalidVADConfig)
+	case c.VoiceTimeframe <= 0:
+		return fmt.Errorf("%w: VoiceTimeframe must be positive", ErrInvalidVADConfig)
+	case c.SilenceTimeframe <= 0:
+		return fmt.Errorf("%w: SilenceTimeframe must be positive", ErrInvalidVADConfig)
+	case c.FrameTimeframe <= 0:
+		return fmt.Errorf("%w: FrameTimeframe must be positive", ErrInvalidVADConfig)
+	case c.CalibrationTimeframe <= 0:
+		return fmt.Errorf("%w: CalibrationTimeframe must be positive", ErrInvalidVADConfig)
+	case c.SpeechThreshold <= 0:
+		return fmt.Errorf("%w: SpeechThreshold must be above the noise floor", ErrInvalidVADConfig)
+	case c.SilenceThreshold > c.SpeechThreshold:
+		return fmt.Errorf("%w: SilenceThreshold %gdB is above SpeechThreshold %gdB", ErrInvalidVADConfig, c.SilenceThreshold, c.SpeechThreshold)
+	case c.NoiseFloorWeight < 0 || c.NoiseFloorWeight > 1:
+		return fmt.Errorf("%w: NoiseFloorWeight must be between 0 and 1", ErrInvalidVADConfig)
+	case c.NoiseTracking != "" && c.NoiseTracking != AverageTracking && c.NoiseTracking != MinimumTracking:
+		return fmt.Errorf("%w: unknown NoiseTracking %q", ErrInvalidVADConfig, c.NoiseTracking)
+	case c.NoiseTracking == MinimumTracking && c.NoiseWindow <= 0:
+		return fmt.Errorf("%w: NoiseWindow must be positive", ErrInvalidVADConfig)
+	case c.SpeechProbability <= 0 || c.SpeechProbability >= 1:
+		return fmt.Errorf("%w: SpeechProbability must be between 0 and 1", ErrInvalidVADConfig)
+	case c.SilenceProbability < 0 || c.SilenceProbability > c.SpeechProbability:
+		return fmt.Errorf("%w: SilenceProbability must be between 0 and SpeechProbability", ErrInvalidVADConfig)
+	case c.Smoothing < 0 || c.Smoothing >= 1:
+		return fmt.Errorf("%w: Smoothing must be at least 0 and below 1", ErrInvalidVADConfig)
 	}
-}
 
-func (v *VAD) AddBuffer(b []int32) {
-	select {
-	case v.audioChan <- b:
+	switch c.ChannelPolicy {
+	case "", AnyChannel, AllChannels, LoudestChannel:
+	case WeightedChannels:
+		if c.ChannelWeights == nil {
+			break
+		}
+		if len(c.ChannelWeights) != c.InputChannels {
+			return fmt.Errorf("%w: %d ChannelWeights for %d InputChannels", ErrInvalidVADConfig, len(c.ChannelWeights), c.InputChannels)
+		}
+		sum := 0.0
+		for _, w := range c.ChannelWeights {
+			if w < 0 {
+				return fmt.Errorf("%w: ChannelWeights must not be negative", ErrInvalidVADConfig)
+			}
+			sum += w
+		}
+		if sum == 0 {
+			return fmt.Errorf("%w: ChannelWeights must not all be 0", ErrInvalidVADConfig)
+		}
 	default:
-		log.Printf("channel is full -- discarding value")
+		return fmt.Errorf("%w: unknown ChannelPolicy %q", ErrInvalidVADConfig, c.ChannelPolicy)
 	}
-}
 
-func (v *VAD) DetectSpeech(stop chan bool) bool {
-	buffers := [][]int32{}
-	for len(buffers) < v.speechWindows {
-		select {
-		case newBuf := <-v.audioChan:
-			buffers = append(buffers, newBuf)
-		case <-stop:
-			return false
-		default:
-			continue
+	switch c.NonSpeech {
+	case "", TagNonSpeech, DropNonSpeech:
+	default:
+		return fmt.Errorf("%w: unknown NonSpeech %q", ErrInvalidVADConfig, c.NonSpeech)
+	}
+
+	switch c.Method {
+	case "", EnergyMethod, SpectralMethod:
+	case WebRTCMethod:
+		if c.Aggressiveness < int(webrtc.Quality) || c.Aggressiveness > int(webrtc.VeryAggressive) {
+			return fmt.Errorf("%w: Aggressiveness must be between 0 and 3", ErrInvalidVADConfig)
 		}
+	default:
+		return fmt.Errorf("%w: unknown Method %q", ErrInvalidVADConfig, c.Method)
 	}
 
-	isSpeech := v.detect(SpeechDetection, buffers)
-	if !isSpeech {
-		v.sample(buffers)
+	return nil
+}
+
+// window converts milliseconds to samples, rounded up to whole buffers
+func (c *VADConfig) window(ms int) int {
+	frames := float64(ms) / 1000 * c.SampleRate
+	buffers := int(math.Ceil(frames / float64(c.FramesPerBuffer)))
+	if buffers < 1 {
+		buffers = 1
 	}
+	return buffers * c.FramesPerBuffer * c.InputChannels
+}
 
-	return isSpeech
+// frames converts milliseconds to samples, rounded up to whole frames
+func (c *VADConfig) frames(ms int) int {
+	frame := c.window(c.FrameTimeframe)
+	n := (c.window(ms) + frame - 1) / frame
+	return n * frame
 }
 
-func (v *VAD) DetectSilence(stop chan bool) bool {
-	buffers := [][]int32{}
-	for len(buffers) < v.silenceWindows {
-		select {
-		case newBuf := <-v.audioChan:
-			buffers = append(buffers, newBuf)
-		case <-stop:
-			return false
-		default:
-			continue
+// NewVAD scores frames with the built-in detector for cfg.Method, one per
+// channel when there is a ChannelPolicy
+func NewVAD(cfg *VADConfig) (*VAD, error) {
+	err := cfg.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.ChannelPolicy != "" && cfg.InputChannels > 1 {
+		detector, err := NewMultichannelDetector(cfg, newDetector)
+		if err != nil {
+			return nil, err
 		}
+		return NewVADWithDetector(cfg, detector)
+	}
+	detector, err := newDetector(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return NewVADWithDetector(cfg, detector)
+}
+
+// NewVADWithDetector scores frames with any detector
+func NewVADWithDetector(cfg *VADConfig, detector Detector) (*VAD, error) {
+	err := cfg.Validate()
+	if err != nil {
+		return nil, err
+	}
+	if detector == nil {
+		return nil, fmt.Errorf("%w: nil Detector", ErrInvalidVADConfig)
 	}
 
-	return v.detect(SilenceDetection, buffers)
+	frameSize := cfg.window(cfg.FrameTimeframe)
+	v := &VAD{
+		cfg:        cfg,
+		detector:   detector,
+		frameSize:  frameSize,
+		minSpeech:  cfg.frames(cfg.VoiceTimeframe),
+		minSilence: cfg.frames(cfg.SilenceTimeframe),
+		frame:      make([]int32, 0, frameSize),
+	}
+	if cfg.NonSpeech != "" {
+		v.classifier = NewClassifier(cfg.SampleRate, cfg.InputChannels)
+	}
+	return v, nil
 }
 
-// the listening for voice window should be smaller than listening for silence window
-// because we want to record right after we hear voice, and a little bit of silence will trigger the recorder to stop
-// this function should have the only stream reads
-func (v *VAD) detect(detection Detection, buffers [][]int32) bool {
-	avgEnergy := float32(0)
-	for _, buffer := range buffers {
-		for _, amp := range buffer {
-			avgEnergy += float32(math.Pow(float64(amp), 2))
-		}
+func newDetector(cfg *VADConfig) (Detector, error) {
+	switch cfg.Method {
+	case SpectralMethod:
+		return NewSpectralDetector(cfg), nil
+	case WebRTCMethod:
+		return NewWebRTCDetector(cfg)
+	default:
+		return NewEnergyDetector(cfg), nil
 	}
-	avgEnergy = float32(math.Sqrt(float64(avgEnergy / float32(len(buffers)))))
+}
+
+// OnEvent sets a handler that Process calls for each event as it happens
+func (v *VAD) OnEvent(handler func(Event)) {
+	v.handler = handler
+}
+
+// Detector is the detector scoring the frames
+func (v *VAD) Detector() Detector {
+	return v.detector
+}
+
+// Speaking reports whether the VAD is between a SpeechStart and SpeechEnd
+func (v *VAD) Speaking() bool {
+	return v.speaking
+}
 
-	if avgEnergy > float32(v.ambAvg)*DefaultSpeechAMBAVGMultiplier &&
-		detection == SpeechDetection {
-		return true
-	} else if avgEnergy <= float32(v.ambAvg)*DefaultSilenceAMBAVGMultiplier &&
-		detection == SilenceDetection {
-		return true
+// Probability is the smoothed speech probability of the frames so far
+func (v *VAD) Probability() float64 {
+	return v.probability
+}
+
+// Calibrated reports whether the noise floor has been measured, always
+// true for detectors that do not measure one
+func (v *VAD) Calibrated() bool {
+	if c, ok := v.detector.(Calibrator); ok {
+		return c.Calibrated()
+	}
+	return true
+}
+
+// NoiseFloor is the current noise floor as an RMS amplitude, 0 until
+// calibrated or for detectors that do not measure one
+func (v *VAD) NoiseFloor() float64 {
+	if c, ok := v.detector.(Calibrator); ok {
+		return c.NoiseFloor()
 	}
+	return 0
+}
 
-	return false
+// ChannelSpeaking reports whether each channel is speaking by its own
+// decisions, nil unless the detector is a MultichannelDetector
+func (v *VAD) ChannelSpeaking() []bool {
+	if m, ok := v.detector.(*MultichannelDetector); ok {
+		return m.Speaking()
+	}
+	return nil
 }
 
-func (v *VAD) sample(buffers [][]int32) {
-	silenceThreshold := float32(0)
-	for _, buffer := range buffers {
-		for j := range buffer {
-			silenceThreshold += float32(math.Pow(float64(buffer[j]), 2))
+// Speaker is the channel speaking: with a MultichannelDetector the one
+// its Speaker reports, otherwise 0 while speaking. -1 when none is.
+func (v *VAD) Speaker() int {
+	if m, ok := v.detector.(*MultichannelDetector); ok {
+		return m.Speaker()
+	}
+	if v.speaking {
+		return 0
+	}
+	return -1
+}
+
+// Lookback is the furthest in samples a SpeechStart can lie behind the
+// latest sample of the Process call that returned it, not counting that
+// call's samples past the frame that triggered it
+func (v *VAD) Lookback() int {
+	return v.minSpeech + v.frameSize
+}
+
+// Reset returns to silence and restarts the sample count. The detector and
+// its noise floor are kept, though a detector with decisions of its own,
+// like a MultichannelDetector, is reset too.
+func (v *VAD) Reset() {
+	if r, ok := v.detector.(interface{ Reset() }); ok {
+		r.Reset()
+	}
+	v.speaking = false
+	v.offset = 0
+	v.frame = v.frame[:0]
+	v.frameStart = 0
+	v.probability = 0
+	v.run = 0
+	v.runStart = 0
+	v.speechStart = 0
+	if v.classifier != nil {
+		v.classifier.Reset()
+	}
+}
+
+// Recalibrate resets and has the detector measure the noise floor again
+// before detecting
+func (v *VAD) Recalibrate() {
+	v.Reset()
+	if c, ok := v.detector.(Calibrator); ok {
+		c.Recalibrate()
+	}
+}
+
+// Process scores the next samples and returns the events they caused, in
+// order. The VAD does not hold on to b.
+func (v *VAD) Process(b []int32) []Event {
+	var events []Event
+	for len(b) > 0 {
+		n := v.frameSize - len(v.frame)
+		if n > len(b) {
+			n = len(b)
 		}
+
+		v.frame = append(v.frame, b[:n]...)
+		v.offset += uint64(n)
+		b = b[n:]
+
+		if len(v.frame) < v.frameSize {
+			break
+		}
+
+		if v.classifier != nil {
+			v.classifier.Add(v.frame)
+		}
+		if event, ok := v.detect(); ok {
+			v.classify(&event)
+			events = append(events, event)
+			if v.handler != nil {
+				v.handler(event)
+			}
+		}
+		if v.classifier != nil && !v.speaking && v.offset > uint64(v.Lookback()) {
+			// keep only what a SpeechStart could reach back to
+			v.classifier.forget(v.offset - uint64(v.Lookback()))
+		}
+
+		v.frame = v.frame[:0]
+		v.frameStart = v.offset
+	}
+
+	return events
+}
+
+// classify gives a SpeechEnd the class of the speech it ends
+func (v *VAD) classify(event *Event) {
+	if v.classifier == nil {
+		return
+	}
+	if event.Type == SpeechStart {
+		v.speechStart = event.Offset
+		return
+	}
+	event.Class, _ = v.classifier.classifyRange(v.speechStart, event.Offset)
+}
+
+// detect scores a full frame and reports an event once the run past the
+// threshold is long enough
+func (v *VAD) detect() (Event, bool) {
+	p := v.detector.Probability(v.frame)
+	v.probability = v.cfg.Smoothing*v.probability + (1-v.cfg.Smoothing)*p
+
+	speech, silence := v.cfg.SpeechProbability, v.cfg.SilenceProbability
+	var switching bool
+	var confidence float64
+	if v.speaking {
+		switching = v.probability <= silence
+		confidence = margin(v.probability, silence)
+	} else {
+		switching = v.probability > speech
+		confidence = (v.probability - speech) / (1 - speech)
+	}
+
+	if !switching {
+		v.run = 0
+		return Event{}, false
+	}
+
+	if v.run == 0 {
+		v.runStart = v.frameStart
+	}
+	v.run += v.frameSize
+
+	duration := v.minSpeech
+	if v.speaking {
+		duration = v.minSilence
+	}
+	if v.run < duration {
+		return Event{}, false
+	}
+
+	v.speaking = !v.speaking
+	v.run = 0
+	event := Event{
+		Type:       SpeechEnd,
+		Offset:     v.runStart,
+		Confidence: confidence,
+	}
+	if v.speaking {
+		event.Type = SpeechStart
+	}
+	return event, true
+}
+
+// track moves a noise floor towards a quiet level by weight w
+func track(floor, level, w float64) float64 {
+	return math.Max(floor*(1-w)+level*w, minNoiseFloor)
+}
+
+// frameWeight spreads a noise floor weight over a VoiceTimeframe across
+// the frames of n samples it holds, so the floor moves at the same rate
+// whatever the frame length
+func frameWeight(cfg *VADConfig, n int) float64 {
+	return 1 - math.Pow(1-cfg.NoiseFloorWeight, float64(n)/float64(cfg.window(cfg.VoiceTimeframe)))
+}
+
+// fromDB converts a level in dB to an amplitude ratio
+func fromDB(db float64) float64 {
+	return math.Pow(10, db/20)
+}
+
+// margin is how far above low high is, from 0 when equal towards 1
+func margin(low, high float64) float64 {
+	if high <= 0 {
+		return 0
 	}
-	silenceThreshold = float32(math.Sqrt(float64(silenceThreshold / float32(len(buffers)))))
-	v.ambAvg = v.ambAvg*(1-NewSilenceThresholdWeight) + silenceThreshold*NewSilenceThresholdWeight
+	return 1 - low/high
 }
@@ -0,0 +1,185 @@
+package vad
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testConfig() *VADConfig {
+	cfg := DefaultVADConfig()
+	cfg.SampleRate = 1000 // frames of 1 buffer, runs of 5 and 12, calibration of 8
+	return cfg
+}
+
+func newVAD(t *testing.T) *VAD {
+	v, err := NewVAD(testConfig())
+	assert.NoError(t, err)
+	return v
+}
+
+// tone fills n samples with a sine of the given amplitude
+func tone(amplitude float64, n int) []int32 {
+	samples := make([]int32, n)
+	for i := range samples {
+		samples[i] = int32(amplitude * math.Sin(float64(i)/3))
+	}
+	return samples
+}
+
+func utterance() []int32 {
+	samples := tone(1e6, 64*50)
+	samples = append(samples, tone(1e9, 64*30)...)
+	return append(samples, tone(1e6, 64*30)...)
+}
+
+func TestProcessEvents(t *testing.T) {
+	v := newVAD(t)
+
+	events := v.Process(utterance())
+	assert.Len(t, events, 2)
+
+	// after 8 buffers of calibration, the speech starting at buffer 50
+	// stays above the threshold for 5 buffers
+	assert.Equal(t, SpeechStart, events[0].Type)
+	assert.Equal(t, uint64(64*50), events[0].Offset)
+	assert.Greater(t, events[0].Confidence, 0.9)
+
+	// smoothing holds the probability above the silence threshold for the
+	// first quiet buffer at 80, then it stays below for 12
+	assert.Equal(t, SpeechEnd, events[1].Type)
+	assert.Equal(t, uint64(64*81), events[1].Offset)
+	assert.Greater(t, events[1].Confidence, 0.2)
+	assert.False(t, v.Speaking())
+}
+
+func TestProcessChunking(t *testing.T) {
+	whole := newVAD(t)
+	expected := whole.Process(utterance())
+
+	split := newVAD(t)
+	var handled []Event
+	split.OnEvent(func(e Event) {
+		handled = append(handled, e)
+	})
+
+	samples := utterance()
+	var events []Event
+	for len(samples) > 0 {
+		n := 37
+		if n > len(samples) {
+			n = len(samples)
+		}
+		events = append(events, split.Process(samples[:n])...)
+		samples = samples[n:]
+	}
+
+	assert.Equal(t, len(expected), len(events))
+	for i := range expected {
+		assert.Equal(t, expected[i].Type, events[i].Type)
+		assert.Equal(t, expected[i].Offset, events[i].Offset)
+		assert.InDelta(t, expected[i].Confidence, events[i].Confidence, 1e-6)
+	}
+	assert.Equal(t, events, handled)
+}
+
+func TestReset(t *testing.T) {
+	v := newVAD(t)
+	v.Process(tone(1e6, 64*8))
+	v.Process(tone(1e9, 64*5))
+	assert.True(t, v.Speaking())
+
+	v.Reset()
+	assert.False(t, v.Speaking())
+	assert.Empty(t, v.Process(tone(1e6, 64*4)))
+}
+
+func TestCalibration(t *testing.T) {
+	v := newVAD(t)
+
+	// loud from the start: the floor is measured on it rather than assumed
+	assert.Empty(t, v.Process(tone(1e9, 64*8)))
+	assert.True(t, v.Calibrated())
+	assert.InDelta(t, 1e9/math.Sqrt2, v.NoiseFloor(), 1e8)
+	assert.Empty(t, v.Process(tone(1e9, 64*20)))
+
+	// 12dB is 4 times the amplitude
+	v.Recalibrate()
+	v.Process(tone(1e7, 64*8))
+	assert.Empty(t, v.Process(tone(3.5e7, 64*5)))
+
+	// the frames below speech level raised the floor by a weight of 0.3
+	// over the voice timeframe
+	assert.InDelta(t, 0.7*1e7/math.Sqrt2+0.3*3.5e7/math.Sqrt2, v.NoiseFloor(), 1e6)
+
+	// smoothing takes a frame to cross the threshold
+	assert.Empty(t, v.Process(tone(8e7, 64*5)))
+	assert.NotEmpty(t, v.Process(tone(8e7, 64)))
+}
+
+func TestDetector(t *testing.T) {
+	// a threshold on the loudest sample, with no calibration
+	var frames []int
+	detector := DetectorFunc(func(frame []int32) float64 {
+		frames = append(frames, len(frame))
+		for _, s := range frame {
+			if s > 1e8 {
+				return 1
+			}
+		}
+		return 0
+	})
+
+	v, err := NewVADWithDetector(testConfig(), detector)
+	assert.NoError(t, err)
+	assert.True(t, v.Calibrated())
+	assert.Equal(t, 0.0, v.NoiseFloor())
+
+	events := v.Process(utterance())
+	assert.Len(t, events, 2)
+	assert.Equal(t, uint64(64*50), events[0].Offset)
+	assert.Equal(t, uint64(64*81), events[1].Offset)
+
+	// frames are FrameTimeframe rounded up to whole buffers
+	assert.Len(t, frames, 110)
+	assert.Equal(t, 64, frames[0])
+
+	// a click shorter than VoiceTimeframe does not start speech
+	v.Reset()
+	click := tone(1e6, 64*20)
+	copy(click[64*10:], tone(1e9, 64*2))
+	assert.Empty(t, v.Process(click))
+
+	_, err = NewVADWithDetector(testConfig(), nil)
+	assert.ErrorIs(t, err, ErrInvalidVADConfig)
+}
+
+func TestValidate(t *testing.T) {
+	assert.NoError(t, DefaultVADConfig().Validate())
+
+	_, err := NewVAD(nil)
+	assert.ErrorIs(t, err, ErrInvalidVADConfig)
+
+	for _, breakConfig := range []func(*VADConfig){
+		func(c *VADConfig) { c.SampleRate = 0 },
+		func(c *VADConfig) { c.InputChannels = 0 },
+		func(c *VADConfig) { c.FramesPerBuffer = -1 },
+		func(c *VADConfig) { c.VoiceTimeframe = 0 },
+		func(c *VADConfig) { c.SilenceTimeframe = 0 },
+		func(c *VADConfig) { c.CalibrationTimeframe = 0 },
+		func(c *VADConfig) { c.SpeechThreshold = 0 },
+		func(c *VADConfig) { c.SilenceThreshold = c.SpeechThreshold + 1 },
+		func(c *VADConfig) { c.NoiseFloorWeight = 1.5 },
+		func(c *VADConfig) { c.FrameTimeframe = 0 },
+		func(c *VADConfig) { c.Smoothing = 1 },
+		func(c *VADConfig) { c.SilenceProbability = 0.9 },
+		func(c *VADConfig) { c.NoiseTracking = "median" },
+		func(c *VADConfig) { c.NoiseTracking, c.NoiseWindow = MinimumTracking, 0 },
+	} {
+		cfg := DefaultVADConfig()
+		breakConfig(cfg)
+		_, err := NewVAD(cfg)
+		assert.ErrorIs(t, err, ErrInvalidVADConfig)
+	}
+}
@@ -0,0 +1,108 @@
+package vad
+
+import (
+	"fmt"
+
+	"github.com/garlicgarrison/go-recorder/dsp"
+	"github.com/garlicgarrison/go-recorder/resample"
+	"github.com/garlicgarrison/go-recorder/vad/webrtc"
+)
+
+const (
+	// milliseconds per frame given to the WebRTC detector
+	WebRTCFrameTime = 20
+
+	DefaultAggressiveness = int(webrtc.Aggressive)
+)
+
+// WebRTCDetector runs the WebRTC GMM detector over WebRTCFrameTime frames
+// of its own, and scores a VAD frame with the fraction of those completed
+// in it that were speech, or the last score if none were. The detector
+// adapts its own models, so there is no calibration.
+type WebRTCDetector struct {
+	cfg      *VADConfig
+	detector *webrtc.VAD
+
+	// converts to a rate the detector accepts, nil when the input already
+	// is one
+	resampler *resample.Resampler
+	rate      int
+
+	// mixed down to mono, resampled samples waiting to fill a frame
+	mixer   *dsp.Downmix
+	mixed   []float64
+	mono    []int32
+	pending []int32
+	frame   []int16
+
+	last float64
+}
+
+// webrtcRate is the rate the detector runs at for an input rate: the input
+// rate itself when the detector accepts it, otherwise the highest accepted
+// rate below it
+func webrtcRate(sampleRate float64) int {
+	rate := webrtc.SampleRates[0]
+	for _, r := range webrtc.SampleRates {
+		if float64(r) <= sampleRate {
+			rate = r
+		}
+	}
+	return rate
+}
+
+func NewWebRTCDetector(cfg *VADConfig) (*WebRTCDetector, error) {
+	detector, err := webrtc.New(webrtc.Mode(cfg.Aggressiveness))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidVADConfig, err)
+	}
+	rate := webrtcRate(cfg.SampleRate)
+
+	d := &WebRTCDetector{
+		cfg:      cfg,
+		detector: detector,
+		rate:     rate,
+		mixer:    dsp.NewDownmix(cfg.InputChannels),
+		frame:    make([]int16, 0, webrtc.FrameLength(rate, WebRTCFrameTime)),
+	}
+	if float64(rate) != cfg.SampleRate {
+		d.resampler, err = resample.NewWithQuality(1, float64(rate)/cfg.SampleRate, resample.Sinc)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidVADConfig, err)
+		}
+	}
+	return d, nil
+}
+
+func (d *WebRTCDetector) Probability(frame []int32) float64 {
+	d.mixed = d.mixer.Add(frame, d.mixed[:0])
+	d.mono = d.mono[:0]
+	for _, amp := range d.mixed {
+		d.mono = append(d.mono, int32(amp))
+	}
+
+	mono := d.mono
+	if d.resampler != nil {
+		d.pending = d.resampler.Process(mono, d.pending[:0])
+		mono = d.pending
+	}
+
+	frames, speech := 0, 0
+	for _, amp := range mono {
+		// the detector works on 16 bit samples
+		d.frame = append(d.frame, int16(amp>>16))
+		if len(d.frame) == cap(d.frame) {
+			ok, _ := d.detector.Process(d.rate, d.frame)
+			frames++
+			if ok {
+				speech++
+			}
+			d.frame = d.frame[:0]
+		}
+	}
+
+	if frames > 0 {
+		d.last = float64(speech) / float64(frames)
+	}
+	return d.last
+}
@@ -0,0 +1,402 @@
+package webrtc
+
+const (
+	numChannels  = 6
+	numGaussians = 2
+	tableSize    = numChannels * numGaussians
+
+	// frames of speech after which the longer hangover applies
+	maxSpeechFrames = 6
+
+	// minimum deviation of both models, in Q7
+	minStd = 384
+)
+
+var (
+	// weight of each band in the global decision
+	spectrumWeight = [numChannels]int32{6, 8, 10, 12, 14, 16}
+
+	// model update rates in Q15, and the long term noise correction in Q8
+	noiseUpdateConst  = int32(655)
+	speechUpdateConst = int32(6554)
+	backEta           = int32(154)
+
+	// the closest the two models' means may come, in Q5
+	minimumDifference = [numChannels]int16{544, 544, 576, 576, 576, 576}
+
+	// upper limits of the speech and noise means, in Q7
+	maximumSpeech = [numChannels]int16{11392, 11392, 11520, 11520, 11520, 11520}
+	maximumNoise  = [numChannels]int16{9216, 9088, 8960, 8832, 8704, 8576}
+
+	// lower limit of the speech mean per Gaussian, in Q7
+	minimumMean = [numGaussians]int16{640, 768}
+
+	// the starting models: Gaussian weights in Q7, and means and deviations
+	// in Q7, the first Gaussian of all six bands then the second
+	noiseDataWeights  = [tableSize]int32{34, 62, 72, 66, 53, 25, 94, 66, 56, 62, 75, 103}
+	speechDataWeights = [tableSize]int32{48, 82, 45, 87, 50, 47, 80, 46, 83, 41, 78, 81}
+	noiseDataMeans    = [tableSize]int16{6738, 4892, 7065, 6715, 6771, 3369, 7646, 3863, 7820, 7266, 5020, 4362}
+	speechDataMeans   = [tableSize]int16{8306, 10085, 10078, 11823, 11843, 6309, 9473, 9571, 10879, 7581, 8180, 7483}
+	noiseDataStds     = [tableSize]int16{378, 1064, 493, 582, 688, 593, 474, 697, 475, 688, 421, 455}
+	speechDataStds    = [tableSize]int16{555, 505, 567, 524, 585, 1231, 509, 828, 492, 1540, 1079, 850}
+)
+
+// thresholds of a mode for 10, 20 and 30ms frames
+type thresholds struct {
+	overHangMax1 [3]int16
+	overHangMax2 [3]int16
+	individual   [3]int16
+	total        [3]int16
+}
+
+var modeThresholds = [...]thresholds{
+	Quality: {
+		overHangMax1: [3]int16{8, 4, 3},
+		overHangMax2: [3]int16{14, 7, 5},
+		individual:   [3]int16{24, 21, 24},
+		total:        [3]int16{57, 48, 57},
+	},
+	LowBitrate: {
+		overHangMax1: [3]int16{8, 4, 3},
+		overHangMax2: [3]int16{14, 7, 5},
+		individual:   [3]int16{37, 32, 37},
+		total:        [3]int16{100, 80, 100},
+	},
+	Aggressive: {
+		overHangMax1: [3]int16{6, 3, 2},
+		overHangMax2: [3]int16{9, 5, 3},
+		individual:   [3]int16{82, 78, 82},
+		total:        [3]int16{285, 260, 285},
+	},
+	VeryAggressive: {
+		overHangMax1: [3]int16{6, 3, 2},
+		overHangMax2: [3]int16{9, 5, 3},
+		individual:   [3]int16{94, 94, 94},
+		total:        [3]int16{1100, 1050, 1100},
+	},
+}
+
+// core is the state of one detector: the filter states, the two GMMs per
+// band, and the per band minimum tracking
+type core struct {
+	thresholds thresholds
+
+	vad          int
+	frameCounter int32
+	overHang     int16
+	numOfSpeech  int16
+
+	noiseMeans  [tableSize]int16
+	speechMeans [tableSize]int16
+	noiseStds   [tableSize]int16
+	speechStds  [tableSize]int16
+
+	// 16 -> 8 and 32 -> 16 downsamplers
+	downsamplingStates [2][2]int32
+	resampler          resampler48To8
+
+	upperState    [5]int16
+	lowerState    [5]int16
+	hpFilterState [4]int16
+
+	// the 16 smallest features of each band in the last 100 frames, their
+	// ages, and the smoothed medians
+	lowValueVector [16 * numChannels]int16
+	indexVector    [16 * numChannels]int16
+	meanValue      [numChannels]int16
+}
+
+func (c *core) init(mode Mode) {
+	*c = core{
+		thresholds:  modeThresholds[mode],
+		noiseMeans:  noiseDataMeans,
+		speechMeans: speechDataMeans,
+		noiseStds:   noiseDataStds,
+		speechStds:  speechDataStds,
+	}
+
+	for i := range c.lowValueVector {
+		c.lowValueVector[i] = 10000
+	}
+	for i := range c.meanValue {
+		c.meanValue[i] = 1600
+	}
+}
+
+// weightedAverage shifts the two means of a band by offset and returns
+// their weighted sum, in Q14
+func weightedAverage(data []int16, offset int16, weights []int32) int32 {
+	avg := int32(0)
+	for k := 0; k < numGaussians; k++ {
+		data[k*numChannels] += offset
+		avg += int32(data[k*numChannels]) * weights[k*numChannels]
+	}
+	return avg
+}
+
+// gmmProbability decides a frame from its band features with a likelihood
+// ratio test between the noise and speech GMMs, then adapts the models to
+// the decision. It returns 0 for noise, 1 for speech and above 1 for a
+// hangover frame after speech.
+func (c *core) gmmProbability(features *[numChannels]int16, totalPower int16, frameLength int) int {
+	var index int
+	switch frameLength {
+	case 80:
+		index = 0
+	case 160:
+		index = 1
+	default:
+		index = 2
+	}
+	overhead1 := c.thresholds.overHangMax1[index]
+	overhead2 := c.thresholds.overHangMax2[index]
+	individualTest := c.thresholds.individual[index]
+	totalTest := c.thresholds.total[index]
+
+	vadflag := 0
+	if totalPower > minEnergy {
+		var (
+			deltaN, deltaS                      [tableSize]int16
+			ngprvec, sgprvec                    [tableSize]int16
+			noiseProbability, speechProbability [numGaussians]int32
+			sumLogLikelihoodRatios              int32
+		)
+
+		for channel := 0; channel < numChannels; channel++ {
+			h0Test, h1Test := int32(0), int32(0)
+			for k := 0; k < numGaussians; k++ {
+				gaussian := channel + k*numChannels
+
+				// Q27 = Q7 * Q20
+				p, d := gaussianProbability(features[channel], c.noiseMeans[gaussian], c.noiseStds[gaussian])
+				deltaN[gaussian] = d
+				noiseProbability[k] = noiseDataWeights[gaussian] * p
+				h0Test += noiseProbability[k]
+
+				p, d = gaussianProbability(features[channel], c.speechMeans[gaussian], c.speechStds[gaussian])
+				deltaS[gaussian] = d
+				speechProbability[k] = speechDataWeights[gaussian] * p
+				h1Test += speechProbability[k]
+			}
+
+			// log2(h1/h0) approximated by the difference of their
+			// normalizing shifts
+			shiftsH0 := normW32(h0Test)
+			shiftsH1 := normW32(h1Test)
+			if h0Test == 0 {
+				shiftsH0 = 31
+			}
+			if h1Test == 0 {
+				shiftsH1 = 31
+			}
+			logLikelihoodRatio := shiftsH0 - shiftsH1
+
+			sumLogLikelihoodRatios += int32(logLikelihoodRatio) * spectrumWeight[channel]
+
+			// local decision
+			if logLikelihoodRatio*4 > individualTest {
+				vadflag = 1
+			}
+
+			// how much each Gaussian accounts for the noise and speech
+			// probabilities, in Q14, for the model updates
+			h0 := int16(h0Test >> 12)
+			if h0 > 0 {
+				tmp := int32(uint32(noiseProbability[0])&0xFFFFF000) << 2
+				ngprvec[channel] = int16(divW32W16(tmp, h0))
+				ngprvec[channel+numChannels] = 16384 - ngprvec[channel]
+			} else {
+				ngprvec[channel] = 16384
+			}
+
+			h1 := int16(h1Test >> 12)
+			if h1 > 0 {
+				tmp := int32(uint32(speechProbability[0])&0xFFFFF000) << 2
+				sgprvec[channel] = int16(divW32W16(tmp, h1))
+				sgprvec[channel+numChannels] = 16384 - sgprvec[channel]
+			}
+		}
+
+		// global decision
+		if sumLogLikelihoodRatios >= int32(totalTest) {
+			vadflag = 1
+		}
+
+		maxspe := int16(12800)
+		for channel := 0; channel < numChannels; channel++ {
+			featureMinimum := c.findMinimum(features[channel], channel)
+
+			noiseGlobalMean := weightedAverage(c.noiseMeans[channel:], 0, noiseDataWeights[channel:])
+			tmp1s16 := int16(noiseGlobalMean >> 6) // Q8
+
+			for k := 0; k < numGaussians; k++ {
+				gaussian := channel + k*numChannels
+
+				nmk := c.noiseMeans[gaussian]
+				smk := c.speechMeans[gaussian]
+				nsk := c.noiseStds[gaussian]
+				ssk := c.speechStds[gaussian]
+
+				// move the noise mean towards a noise frame
+				nmk2 := nmk
+				if vadflag == 0 {
+					delt := int16((int32(ngprvec[gaussian]) * int32(deltaN[gaussian])) >> 11)
+					nmk2 = nmk + int16((int32(delt)*noiseUpdateConst)>>22)
+				}
+
+				// long term correction towards the band's minimum
+				ndelt := (featureMinimum << 4) - tmp1s16
+				nmk3 := nmk2 + int16((int32(ndelt)*backEta)>>9)
+
+				low := int16((k + 5) << 7)
+				if nmk3 < low {
+					nmk3 = low
+				}
+				high := int16((72 + k - channel) << 7)
+				if nmk3 > high {
+					nmk3 = high
+				}
+				c.noiseMeans[gaussian] = nmk3
+
+				if vadflag != 0 {
+					// move the speech mean towards a speech frame
+					delt := int16((int32(sgprvec[gaussian]) * int32(deltaS[gaussian])) >> 11)
+					tmps16 := int16((int32(delt) * speechUpdateConst) >> 21)
+					smk2 := smk + ((tmps16 + 1) >> 1)
+
+					maxmu := maxspe + 640
+					if smk2 < minimumMean[k] {
+						smk2 = minimumMean[k]
+					}
+					if smk2 > maxmu {
+						smk2 = maxmu
+					}
+					c.speechMeans[gaussian] = smk2
+
+					// and its deviation, by 0.025 of the error
+					tmps16 = (smk + 4) >> 3
+					tmps16 = features[channel] - tmps16
+					tmp1s32 := (int32(deltaS[gaussian]) * int32(tmps16)) >> 3
+					tmp2s32 := tmp1s32 - 4096
+					tmps16 = sgprvec[gaussian] >> 2
+					tmp1s32 = int32(tmps16) * tmp2s32
+					tmp2s32 = tmp1s32 >> 4
+
+					if tmp2s32 > 0 {
+						tmps16 = int16(divW32W16(tmp2s32, ssk*10))
+					} else {
+						tmps16 = -int16(divW32W16(-tmp2s32, ssk*10))
+					}
+					tmps16 += 128
+					ssk += tmps16 >> 8
+					if ssk < minStd {
+						ssk = minStd
+					}
+					c.speechStds[gaussian] = ssk
+				} else {
+					// move the noise deviation, by about 0.001 of the error
+					tmps16 := features[channel] - (nmk >> 3)
+					tmp1s32 := (int32(deltaN[gaussian]) * int32(tmps16)) >> 3
+					tmp1s32 -= 4096
+
+					tmps16 = (ngprvec[gaussian] + 2) >> 2
+					tmp2s32 := int32(uint32(tmps16) * uint32(tmp1s32))
+					tmp1s32 = tmp2s32 >> 14
+
+					if tmp1s32 > 0 {
+						tmps16 = int16(divW32W16(tmp1s32, nsk))
+					} else {
+						tmps16 = -int16(divW32W16(-tmp1s32, nsk))
+					}
+					tmps16 += 32
+					nsk += tmps16 >> 6
+					if nsk < minStd {
+						nsk = minStd
+					}
+					c.noiseStds[gaussian] = nsk
+				}
+			}
+
+			// push the models apart if they are too close
+			noiseGlobalMean = weightedAverage(c.noiseMeans[channel:], 0, noiseDataWeights[channel:])
+			speechGlobalMean := weightedAverage(c.speechMeans[channel:], 0, speechDataWeights[channel:])
+
+			diff := int16(speechGlobalMean>>9) - int16(noiseGlobalMean>>9)
+			if diff < minimumDifference[channel] {
+				tmps16 := minimumDifference[channel] - diff
+
+				// about 0.8 and 0.2 of the shortfall, in Q7
+				tmp1s16 := int16((13 * int32(tmps16)) >> 2)
+				tmp2s16 := int16((3 * int32(tmps16)) >> 2)
+
+				speechGlobalMean = weightedAverage(c.speechMeans[channel:], tmp1s16, speechDataWeights[channel:])
+				noiseGlobalMean = weightedAverage(c.noiseMeans[channel:], -tmp2s16, noiseDataWeights[channel:])
+			}
+
+			// and keep both below their upper limits
+			maxspe = maximumSpeech[channel]
+			tmp2s16 := int16(speechGlobalMean >> 7)
+			if tmp2s16 > maxspe {
+				tmp2s16 -= maxspe
+				for k := 0; k < numGaussians; k++ {
+					c.speechMeans[channel+k*numChannels] -= tmp2s16
+				}
+			}
+
+			tmp2s16 = int16(noiseGlobalMean >> 7)
+			if tmp2s16 > maximumNoise[channel] {
+				tmp2s16 -= maximumNoise[channel]
+				for k := 0; k < numGaussians; k++ {
+					c.noiseMeans[channel+k*numChannels] -= tmp2s16
+				}
+			}
+		}
+		c.frameCounter++
+	}
+
+	// hangover: speech continues for a few frames after the last speech
+	// frame, longer after a long run of speech
+	if vadflag == 0 {
+		if c.overHang > 0 {
+			vadflag = 2 + int(c.overHang)
+			c.overHang--
+		}
+		c.numOfSpeech = 0
+	} else {
+		c.numOfSpeech++
+		if c.numOfSpeech > maxSpeechFrames {
+			c.numOfSpeech = maxSpeechFrames
+			c.overHang = overhead2
+		} else {
+			c.overHang = overhead1
+		}
+	}
+	return vadflag
+}
+
+func (c *core) calcVad8khz(frame []int16) int {
+	var features [numChannels]int16
+	totalPower := c.calculateFeatures(frame, &features)
+	c.vad = c.gmmProbability(&features, totalPower, len(frame))
+	return c.vad
+}
+
+func (c *core) calcVad16khz(frame []int16) int {
+	var nb [240]int16
+	downsample(frame, nb[:], &c.downsamplingStates[0])
+	return c.calcVad8khz(nb[:len(frame)/2])
+}
+
+func (c *core) calcVad32khz(frame []int16) int {
+	var wb [480]int16
+	downsample(frame, wb[:], &c.downsamplingStates[1])
+	return c.calcVad16khz(wb[:len(frame)/2])
+}
+
+func (c *core) calcVad48khz(frame []int16) int {
+	var nb [240]int16
+	for i := 0; i < len(frame)/480; i++ {
+		c.resampler.resample(frame[i*480:], nb[i*80:])
+	}
+	return c.calcVad8khz(nb[:len(frame)/6])
+}
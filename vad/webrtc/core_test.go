@@ -0,0 +1,113 @@
+package webrtc
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// The expected values in this file are the ones in the C unit tests of
+// common_audio/vad.
+
+func TestGaussianProbability(t *testing.T) {
+	for _, c := range []struct {
+		input, mean int16
+		prob        int32
+		delta       int16
+	}{
+		// at the mean, 1/s in Q20
+		{0, 0, 1048576, 0},
+		{16, 128, 1048576, 0},
+		{-16, -128, 1048576, 0},
+
+		// away from the mean
+		{59, 0, 1024, 7552},
+		{75, 128, 1024, 7552},
+		{-75, -128, 1024, -7552},
+
+		// far enough for the probability to be 0
+		{105, 0, 0, 13440},
+	} {
+		prob, delta := gaussianProbability(c.input, c.mean, 128)
+		assert.Equal(t, c.prob, prob, "input %d mean %d", c.input, c.mean)
+		assert.Equal(t, c.delta, delta, "input %d mean %d", c.input, c.mean)
+	}
+}
+
+// squares is i*i wrapped to 16 bits, a signal that triggers the detector
+// in every mode
+func squares(n int) []int16 {
+	s := make([]int16, n)
+	for i := range s {
+		s[i] = int16(i * i)
+	}
+	return s
+}
+
+func TestCalculateFeatures(t *testing.T) {
+	reference := []int16{48, 11, 11}
+	expected := [][numChannels]int16{
+		{1213, 759, 587, 462, 434, 272},
+		{1479, 1385, 1291, 1200, 1103, 1099},
+		{1732, 1692, 1681, 1629, 1436, 1436},
+	}
+
+	// the filter states carry over from one length to the next
+	var c core
+	c.init(Quality)
+	speech := squares(240)
+	for i, length := range []int{80, 160, 240} {
+		var features [numChannels]int16
+		assert.Equal(t, reference[i], c.calculateFeatures(speech[:length], &features))
+		assert.Equal(t, expected[i], features)
+	}
+
+	// zeros and ones carry no energy into any band
+	for _, value := range []int16{0, 1} {
+		constant := make([]int16, 240)
+		for i := range constant {
+			constant[i] = value
+		}
+
+		for _, length := range []int{80, 160, 240} {
+			c.init(Quality)
+			var features [numChannels]int16
+			assert.Equal(t, int16(0), c.calculateFeatures(constant[:length], &features))
+			assert.Equal(t, offsetVector, features)
+		}
+	}
+}
+
+func TestDownsample(t *testing.T) {
+	var state [2]int32
+	out := make([]int16, 480)
+
+	downsample(make([]int16, 960), out, &state)
+	assert.Equal(t, [2]int32{0, 0}, state)
+	assert.Equal(t, make([]int16, 480), out)
+
+	downsample(squares(960), out, &state)
+	assert.Equal(t, [2]int32{207, 2270}, state)
+}
+
+func TestFindMinimum(t *testing.T) {
+	// 1600 while no frame has been counted
+	reference := []int16{
+		1600, 720, 509, 512, 532, 552, 570, 588,
+		606, 624, 642, 659, 675, 691, 707, 723,
+		1600, 544, 502, 522, 542, 561, 579, 597,
+		615, 633, 651, 667, 683, 699, 715, 731,
+	}
+
+	// values both below and above the initial 10000
+	var c core
+	c.init(Quality)
+	for i := 0; i < 16; i++ {
+		value := int16(500 * (i + 1))
+		for channel := 0; channel < numChannels; channel++ {
+			assert.Equal(t, reference[i], c.findMinimum(value, channel))
+			assert.Equal(t, reference[i+16], c.findMinimum(12000, channel))
+		}
+		c.frameCounter++
+	}
+}
@@ -0,0 +1,161 @@
+package webrtc
+
+const (
+	// 160*log10(2) in Q9
+	logConst = 24660
+
+	// 14 in Q10
+	logEnergyIntPart = 14336
+
+	// a frame below this total energy is not modelled at all
+	minEnergy = 10
+)
+
+var (
+	// high pass filter coefficients in Q14, a cut-off at 80Hz when the
+	// input is sampled at 500Hz
+	hpZeroCoefs = [3]int32{6631, -13262, 6631}
+	hpPoleCoefs = [3]int32{16384, -7756, 5620}
+
+	// all-pass coefficients of the upper and lower split branches in Q15,
+	// 0.64 and 0.17
+	allPassCoefsQ15 = [2]int32{20972, 5571}
+
+	// adjusts each band's log energy for the halving in each split
+	offsetVector = [numChannels]int16{368, 368, 272, 176, 176, 176}
+)
+
+// highPassFilter removes 0-80Hz from the lowest band, sampled at 500Hz
+func highPassFilter(in []int16, state *[4]int16, out []int16) {
+	for i, x := range in {
+		// all-zero section
+		tmp := hpZeroCoefs[0] * int32(x)
+		tmp += hpZeroCoefs[1] * int32(state[0])
+		tmp += hpZeroCoefs[2] * int32(state[1])
+		state[1] = state[0]
+		state[0] = x
+
+		// all-pole section
+		tmp -= hpPoleCoefs[1] * int32(state[2])
+		tmp -= hpPoleCoefs[2] * int32(state[3])
+		state[3] = state[2]
+		state[2] = int16(tmp >> 14)
+		out[i] = state[2]
+	}
+}
+
+// allPassFilter filters every other sample of in, from Q0 to Q(-1), into
+// length samples of out
+func allPassFilter(in []int16, length int, coefficient int32, state *int16, out []int16) {
+	state32 := int32(*state) << 16 // Q15
+
+	for i := 0; i < length; i++ {
+		x := int32(in[2*i])
+		tmp := state32 + coefficient*x
+		y := int16(tmp >> 16) // Q(-1)
+		out[i] = y
+		state32 = x<<14 - coefficient*int32(y) // Q14
+		state32 *= 2                           // Q15
+	}
+
+	*state = int16(state32 >> 16)
+}
+
+// splitFilter splits in into a high and a low band at half its bandwidth,
+// each downsampled by 2
+func splitFilter(in []int16, length int, upper, lower *int16, hp, lp []int16) {
+	half := length >> 1
+
+	allPassFilter(in, half, allPassCoefsQ15[0], upper, hp)
+	allPassFilter(in[1:], half, allPassCoefsQ15[1], lower, lp)
+
+	for i := 0; i < half; i++ {
+		tmp := hp[i]
+		hp[i] -= lp[i]
+		lp[i] += tmp
+	}
+}
+
+// logOfEnergy is the energy of in, in dB in Q4 plus offset. It adds to the
+// total energy until that exceeds minEnergy.
+func logOfEnergy(in []int16, offset int16, total *int16) int16 {
+	en, rshifts := energy(in)
+	if en == 0 {
+		return offset
+	}
+	e := uint32(en)
+
+	// normalize to 15 bits
+	normalizing := 17 - int(normU32(e))
+	rshifts += normalizing
+	if normalizing < 0 {
+		e <<= uint(-normalizing)
+	} else {
+		e >>= uint(normalizing)
+	}
+
+	// log2 of a 15 bit value in Q10 is about 14 plus the fraction below the
+	// leading bit
+	log2 := int16(logEnergyIntPart)
+	log2 += int16((e & 0x00003FFF) >> 4)
+
+	logEnergy := int16((logConst*int32(log2))>>19 + (int32(rshifts)*logConst)>>9)
+	if logEnergy < 0 {
+		logEnergy = 0
+	}
+	logEnergy += offset
+
+	if *total <= minEnergy {
+		if rshifts >= 0 {
+			// the energy is above minEnergy by construction
+			*total += minEnergy + 1
+		} else {
+			*total += int16(e >> uint(-rshifts))
+		}
+	}
+	return logEnergy
+}
+
+// calculateFeatures splits an 8kHz frame of 80, 160 or 240 samples into six
+// bands, 80-250, 250-500, 500-1000, 1000-2000, 2000-3000 and 3000-4000Hz,
+// and returns the log energy of each and a rough total energy
+func (c *core) calculateFeatures(in []int16, features *[numChannels]int16) int16 {
+	var (
+		total          int16
+		hp120, lp120   [120]int16
+		hp60, lp60     [60]int16
+		length         = len(in) >> 1
+		halfDataLength = length
+	)
+
+	// split at 2000Hz
+	splitFilter(in, len(in), &c.upperState[0], &c.lowerState[0], hp120[:], lp120[:])
+
+	// split 2000-4000Hz at 3000Hz
+	splitFilter(hp120[:], length, &c.upperState[1], &c.lowerState[1], hp60[:], lp60[:])
+	length >>= 1
+	features[5] = logOfEnergy(hp60[:length], offsetVector[5], &total)
+	features[4] = logOfEnergy(lp60[:length], offsetVector[4], &total)
+
+	// split 0-2000Hz at 1000Hz
+	length = halfDataLength
+	splitFilter(lp120[:], length, &c.upperState[2], &c.lowerState[2], hp60[:], lp60[:])
+	length >>= 1
+	features[3] = logOfEnergy(hp60[:length], offsetVector[3], &total)
+
+	// split 0-1000Hz at 500Hz
+	splitFilter(lp60[:], length, &c.upperState[3], &c.lowerState[3], hp120[:], lp120[:])
+	length >>= 1
+	features[2] = logOfEnergy(hp120[:length], offsetVector[2], &total)
+
+	// split 0-500Hz at 250Hz
+	splitFilter(lp120[:], length, &c.upperState[4], &c.lowerState[4], hp60[:], lp60[:])
+	length >>= 1
+	features[1] = logOfEnergy(hp60[:length], offsetVector[1], &total)
+
+	// remove 0-80Hz from the lowest band
+	highPassFilter(lp60[:length], &c.hpFilterState, hp120[:])
+	features[0] = logOfEnergy(hp120[:length], offsetVector[0], &total)
+
+	return total
+}
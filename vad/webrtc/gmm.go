@@ -0,0 +1,44 @@
+package webrtc
+
+const (
+	// an exponent above this, in Q10, gives a probability of 0
+	compVar = 22005
+
+	// log2(exp(1)) in Q12
+	log2Exp = 5909
+)
+
+// gaussianProbability is (1/s)*exp(-(x-m)^2/(2*s^2)) in Q20 for an input x
+// in Q4 and a mean m and deviation s in Q7. delta is (x-m)/s^2 in Q11, for
+// updating the model.
+func gaussianProbability(input, mean, std int16) (int32, int16) {
+	// 1/s in Q10, rounded
+	tmp32 := int32(131072) + int32(std>>1)
+	invStd := int16(divW32W16(tmp32, std))
+
+	// 1/s^2 in Q14
+	tmp16 := invStd >> 2
+	invStd2 := int16((int32(tmp16) * int32(tmp16)) >> 2)
+
+	tmp16 = input << 3 // Q4 -> Q7
+	tmp16 -= mean
+
+	delta := int16((int32(invStd2) * int32(tmp16)) >> 10)
+
+	// the exponent (x-m)^2/(2*s^2) in Q10
+	tmp32 = (int32(delta) * int32(tmp16)) >> 9
+
+	// exp(-x) as exp2(-log2(e)*x), with a linear fraction
+	expValue := int16(0)
+	if tmp32 < compVar {
+		tmp16 = int16((log2Exp * tmp32) >> 12)
+		tmp16 = -tmp16
+		expValue = 0x0400 | (tmp16 & 0x03FF)
+		tmp16 = ^tmp16
+		tmp16 >>= 10
+		tmp16++
+		expValue >>= uint16(tmp16)
+	}
+
+	return int32(invStd) * int32(expValue), delta
+}
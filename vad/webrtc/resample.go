@@ -0,0 +1,155 @@
+package webrtc
+
+// The 48kHz to 8kHz resampler from common_audio/signal_processing: down by
+// 2, a low pass, 3 to 2, and down by 2 again, working in Q15 in between.
+
+// all-pass coefficients of the two polyphase branches
+var resampleAllpass = [2][3]int32{
+	{821, 6110, 12382},
+	{3050, 9368, 15063},
+}
+
+// 3 input samples to 2 output samples
+var coefficients48To32 = [2][8]int32{
+	{778, -2050, 1087, 23285, 12903, -3783, 441, 222},
+	{222, 441, -3783, 12903, 23285, 1087, -2050, 778},
+}
+
+type resampler48To8 struct {
+	s48To24 [8]int32
+	s24To24 [16]int32
+	s24To16 [8]int32
+	s16To8  [8]int32
+
+	tmp [480 + 256]int32
+}
+
+// allpass runs one three-stage all-pass branch over a sample, state holding
+// the branch's four delay values
+func allpass(x int32, coefs *[3]int32, state []int32) int32 {
+	diff := x - state[1]
+	diff = (diff + (1 << 13)) >> 14
+	tmp1 := state[0] + diff*coefs[0]
+	state[0] = x
+
+	diff = tmp1 - state[2]
+	diff >>= 14
+	if diff < 0 {
+		diff++
+	}
+	tmp0 := state[1] + diff*coefs[1]
+	state[1] = tmp1
+
+	diff = tmp0 - state[3]
+	diff >>= 14
+	if diff < 0 {
+		diff++
+	}
+	state[3] = state[2] + diff*coefs[2]
+	state[2] = tmp0
+
+	return state[3]
+}
+
+// downBy2ShortToInt halves the rate of in, out in Q15
+func downBy2ShortToInt(in []int16, out []int32, state *[8]int32) {
+	half := len(in) >> 1
+
+	for i := 0; i < half; i++ {
+		x := int32(in[2*i])<<15 + 1<<14
+		out[i] = allpass(x, &resampleAllpass[1], state[0:4]) >> 1
+	}
+	for i := 0; i < half; i++ {
+		x := int32(in[2*i+1])<<15 + 1<<14
+		out[i] += allpass(x, &resampleAllpass[0], state[4:8]) >> 1
+	}
+}
+
+// lpBy2IntToInt low pass filters in at half its bandwidth, from Q15 to Q0
+// at the same rate
+func lpBy2IntToInt(in []int32, out []int32, state *[16]int32) {
+	half := len(in) >> 1
+
+	// lower branch: odd input to even output, delayed by one sample
+	tmp := state[12]
+	for i := 0; i < half; i++ {
+		out[2*i] = allpass(tmp, &resampleAllpass[1], state[0:4]) >> 1
+		tmp = in[2*i+1]
+	}
+
+	// upper branch: even input to even output
+	for i := 0; i < half; i++ {
+		y := allpass(in[2*i], &resampleAllpass[0], state[4:8])
+		out[2*i] = (out[2*i] + y>>1) >> 15
+	}
+
+	// lower branch: even input to odd output
+	for i := 0; i < half; i++ {
+		out[2*i+1] = allpass(in[2*i], &resampleAllpass[1], state[8:12]) >> 1
+	}
+
+	// upper branch: odd input to odd output
+	for i := 0; i < half; i++ {
+		y := allpass(in[2*i+1], &resampleAllpass[0], state[12:16])
+		out[2*i+1] = (out[2*i+1] + y>>1) >> 15
+	}
+}
+
+// resample48To32 turns each 3 samples of in, plus 5 samples of history
+// before them, into 2 samples of out in Q15
+func resample48To32(in []int32, out []int32, blocks int) {
+	for m := 0; m < blocks; m++ {
+		for k := 0; k < 2; k++ {
+			tmp := int32(1 << 14)
+			for j, c := range coefficients48To32[k] {
+				tmp += c * in[k+j]
+			}
+			out[k] = tmp
+		}
+		in = in[3:]
+		out = out[2:]
+	}
+}
+
+// downBy2IntToShort halves the rate of in, from Q15 to Q0, using in as
+// scratch
+func downBy2IntToShort(in []int32, out []int16, state *[8]int32) {
+	half := len(in) >> 1
+
+	for i := 0; i < half; i++ {
+		in[2*i] = allpass(in[2*i], &resampleAllpass[1], state[0:4]) >> 1
+	}
+	for i := 0; i < half; i++ {
+		in[2*i+1] = allpass(in[2*i+1], &resampleAllpass[0], state[4:8]) >> 1
+	}
+
+	for i := 0; i < half; i++ {
+		tmp := (in[2*i] + in[2*i+1]) >> 15
+		if tmp > 0x7FFF {
+			tmp = 0x7FFF
+		}
+		if tmp < -0x8000 {
+			tmp = -0x8000
+		}
+		out[i] = int16(tmp)
+	}
+}
+
+// resample turns 480 samples at 48kHz into 80 at 8kHz
+func (r *resampler48To8) resample(in []int16, out []int16) {
+	tmp := r.tmp[:]
+
+	// 48 -> 24
+	downBy2ShortToInt(in[:480], tmp[256:496], &r.s48To24)
+
+	// 24 -> 24, low passed
+	lpBy2IntToInt(tmp[256:496], tmp[16:256], &r.s24To24)
+
+	// 24 -> 16, carrying the last 8 samples over to the next call
+	copy(tmp[8:16], r.s24To16[:])
+	copy(r.s24To16[:], tmp[248:256])
+	resample48To32(tmp[8:], tmp[:160], 80)
+
+	// 16 -> 8
+	downBy2IntToShort(tmp[:160], out[:80], &r.s16To8)
+}
@@ -0,0 +1,96 @@
+package webrtc
+
+const (
+	// 0.2 and 0.99 in Q15
+	smoothingDown = 6553
+	smoothingUp   = 32439
+
+	// frames a value is kept among a band's smallest
+	minimumAge = 100
+)
+
+// all-pass coefficients of the downsampler in Q13
+var allPassCoefsQ13 = [2]int32{5243, 1392}
+
+// downsample halves the rate of in into out with a pair of all-pass
+// filters
+func downsample(in []int16, out []int16, state *[2]int32) {
+	tmp1, tmp2 := state[0], state[1]
+
+	for n := 0; n < len(in)>>1; n++ {
+		x := int32(in[2*n])
+		y1 := int16((tmp1 >> 1) + ((allPassCoefsQ13[0] * x) >> 14))
+		tmp1 = x - ((allPassCoefsQ13[0] * int32(y1)) >> 12)
+
+		x = int32(in[2*n+1])
+		y2 := int16((tmp2 >> 1) + ((allPassCoefsQ13[1] * x) >> 14))
+		tmp2 = x - ((allPassCoefsQ13[1] * int32(y2)) >> 12)
+
+		out[n] = y1 + y2
+	}
+
+	state[0], state[1] = tmp1, tmp2
+}
+
+// findMinimum inserts a band's feature into its 16 smallest values of the
+// last 100 frames, and returns a smoothed median of the 5 smallest, in Q4
+func (c *core) findMinimum(feature int16, channel int) int16 {
+	age := c.indexVector[channel*16 : channel*16+16]
+	smallest := c.lowValueVector[channel*16 : channel*16+16]
+
+	// every value is a frame older, the oldest is dropped
+	for i := 0; i < 16; i++ {
+		if age[i] != minimumAge {
+			age[i]++
+			continue
+		}
+
+		for j := i; j < 15; j++ {
+			smallest[j] = smallest[j+1]
+			age[j] = age[j+1]
+		}
+		age[15] = minimumAge + 1
+		smallest[15] = 10000
+	}
+
+	// smallest is sorted, the feature goes before the first larger value
+	position := -1
+	for i := 0; i < 16; i++ {
+		if feature < smallest[i] {
+			position = i
+			break
+		}
+	}
+
+	if position > -1 {
+		for i := 15; i > position; i-- {
+			smallest[i] = smallest[i-1]
+			age[i] = age[i-1]
+		}
+		smallest[position] = feature
+		age[position] = 1
+	}
+
+	median := int16(1600)
+	if c.frameCounter > 2 {
+		median = smallest[2]
+	} else if c.frameCounter > 0 {
+		median = smallest[0]
+	}
+
+	// smooth quickly down and slowly up
+	alpha := int32(0)
+	if c.frameCounter > 0 {
+		if median < c.meanValue[channel] {
+			alpha = smoothingDown
+		} else {
+			alpha = smoothingUp
+		}
+	}
+	tmp := (alpha + 1) * int32(c.meanValue[channel])
+	tmp += (32767 - alpha) * int32(median)
+	tmp += 16384
+	c.meanValue[channel] = int16(tmp >> 15)
+
+	return c.meanValue[channel]
+}
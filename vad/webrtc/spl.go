@@ -0,0 +1,73 @@
+package webrtc
+
+import "math/bits"
+
+// The fixed-point helpers from common_audio/signal_processing that the VAD
+// uses. Arithmetic wraps like the int32 arithmetic it was written for.
+
+// normW32 is the left shift that normalizes a to 32 bits, 0 for 0
+func normW32(a int32) int16 {
+	if a == 0 {
+		return 0
+	}
+	if a < 0 {
+		a = ^a
+	}
+	return int16(bits.LeadingZeros32(uint32(a)) - 1)
+}
+
+// normU32 is the number of leading zeros of a, 0 for 0
+func normU32(a uint32) int16 {
+	if a == 0 {
+		return 0
+	}
+	return int16(bits.LeadingZeros32(a))
+}
+
+// sizeInBits is the number of bits needed to hold n
+func sizeInBits(n uint32) int16 {
+	return int16(32 - bits.LeadingZeros32(n))
+}
+
+// divW32W16 divides num by den, saturating on a zero den
+func divW32W16(num int32, den int16) int32 {
+	if den == 0 {
+		return 0x7FFFFFFF
+	}
+	return num / int32(den)
+}
+
+// scalingSquare is the right shift that keeps a sum of times squares of the
+// largest value in v within 32 bits
+func scalingSquare(v []int16, times int) int16 {
+	nbits := sizeInBits(uint32(times))
+	smax := int16(-1)
+	for _, s := range v {
+		abs := s
+		if s <= 0 {
+			abs = -s
+		}
+		if abs > smax {
+			smax = abs
+		}
+	}
+
+	t := normW32(int32(smax) * int32(smax))
+	if smax == 0 {
+		return 0
+	}
+	if t > nbits {
+		return 0
+	}
+	return nbits - t
+}
+
+// energy sums the squares of v, each shifted right by the returned scale
+func energy(v []int16) (int32, int) {
+	scaling := scalingSquare(v, len(v))
+	en := int32(0)
+	for _, s := range v {
+		en += (int32(s) * int32(s)) >> scaling
+	}
+	return en, int(scaling)
+}
@@ -0,0 +1,34 @@
+# writes mixed_<rate>k.pcm: quiet noise, a voice gliding through vowels,
+# louder noise, the voice over it, and digital silence
+import math, random, struct, sys
+
+def gen(rate):
+    rng = random.Random(7)
+    out = []
+    def noise(seconds, level):
+        for _ in range(int(seconds * rate)):
+            out.append(level * rng.gauss(0, 1))
+    def voice(seconds, level, under):
+        n = int(seconds * rate)
+        phase = 0.0
+        for i in range(n):
+            t = i / rate
+            f0 = 120 + 40 * math.sin(2 * math.pi * 0.7 * t)
+            phase += 2 * math.pi * f0 / rate
+            syllable = abs(math.sin(2 * math.pi * 2.5 * t))
+            formant = 700 if int(t * 5) % 2 else 300
+            v = 0.0
+            h = 1
+            while h * f0 < min(4000, rate / 2):
+                v += math.exp(-((h * f0 - formant) / 300) ** 2) * math.sin(h * phase)
+                h += 1
+            out.append(level * syllable * v + under * rng.gauss(0, 1))
+    noise(1, 30)
+    voice(1.5, 6000, 30)
+    noise(1, 800)
+    voice(1.5, 6000, 800)
+    out.extend([0] * rate)
+    return b''.join(struct.pack('<h', max(-32768, min(32767, int(round(s))))) for s in out)
+
+for rate in (8000, 16000, 32000, 48000):
+    open(sys.argv[1] + '/mixed_%dk.pcm' % (rate // 1000), 'wb').write(gen(rate))
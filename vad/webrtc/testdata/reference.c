@@ -0,0 +1,32 @@
+// reference.c prints the decisions of the reference WebRTC C VAD for every
+// frame of 16 bit little endian mono PCM, one line of "mode ms decisions"
+// per mode and frame length. See README.
+#include "webrtc.c"
+#include <stdio.h>
+#include <stdlib.h>
+
+int main(int argc, char **argv) {
+  int rate = atoi(argv[1]);
+  FILE *f = fopen(argv[2], "rb");
+  static int16_t samples[1 << 22];
+  size_t n = fread(samples, 2, sizeof(samples) / 2, f);
+  fclose(f);
+  for (int mode = 0; mode <= 3; mode++) {
+    for (int ms = 10; ms <= 30; ms += 10) {
+      VadInst *v;
+      WebRtcVad_Create(&v);
+      WebRtcVad_Init(v);
+      WebRtcVad_set_mode(v, mode);
+      int length = rate / 1000 * ms;
+      printf("%d %d ", mode, ms);
+      for (size_t at = 0; at + length <= n; at += length) {
+        int speech = WebRtcVad_Process(v, rate, samples + at, length);
+        if (speech < 0) return 1;
+        putchar(speech ? '1' : '0');
+      }
+      putchar('\n');
+      WebRtcVad_Free(v);
+    }
+  }
+  return 0;
+}
@@ -0,0 +1,115 @@
+// Package webrtc is a pure Go port of the WebRTC voice activity detector
+// from common_audio/vad. Each 10, 20 or 30ms frame is resampled to 8kHz and
+// split into six sub-bands, and a likelihood ratio test between a speech and
+// a noise Gaussian mixture model on the bands' log energies decides it. The
+// models adapt to every frame. The fixed-point arithmetic follows the C
+// code, so decisions match it frame for frame.
+package webrtc
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Mode is how aggressively non-speech is rejected, from Quality, which lets
+// the most through, to VeryAggressive
+type Mode int
+
+const (
+	Quality Mode = iota
+	LowBitrate
+	Aggressive
+	VeryAggressive
+)
+
+var (
+	ErrInvalidMode  = errors.New("invalid vad mode")
+	ErrInvalidFrame = errors.New("invalid sample rate or frame length")
+)
+
+// SampleRates are the rates in Hz the detector accepts
+var SampleRates = []int{8000, 16000, 32000, 48000}
+
+// FrameTimes are the frame lengths in milliseconds the detector accepts
+var FrameTimes = []int{10, 20, 30}
+
+// VAD is a detector with its adapted models. It is not safe for concurrent
+// use.
+type VAD struct {
+	core core
+	mode Mode
+}
+
+func New(mode Mode) (*VAD, error) {
+	if mode < Quality || mode > VeryAggressive {
+		return nil, fmt.Errorf("%w: %d", ErrInvalidMode, mode)
+	}
+
+	v := &VAD{mode: mode}
+	v.core.init(mode)
+	return v, nil
+}
+
+// Mode is the aggressiveness the detector runs in
+func (v *VAD) Mode() Mode {
+	return v.mode
+}
+
+// SetMode changes the aggressiveness. The models are kept.
+func (v *VAD) SetMode(mode Mode) error {
+	if mode < Quality || mode > VeryAggressive {
+		return fmt.Errorf("%w: %d", ErrInvalidMode, mode)
+	}
+
+	v.mode = mode
+	v.core.thresholds = modeThresholds[mode]
+	return nil
+}
+
+// Reset drops the adapted models and filter states
+func (v *VAD) Reset() {
+	v.core.init(v.mode)
+}
+
+// ValidRateAndFrameLength reports whether frames of length samples at rate
+// can be processed
+func ValidRateAndFrameLength(rate, length int) bool {
+	for _, r := range SampleRates {
+		if r != rate {
+			continue
+		}
+		for _, ms := range FrameTimes {
+			if length == rate/1000*ms {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// FrameLength is the number of samples in a frame of ms milliseconds at
+// rate
+func FrameLength(rate, ms int) int {
+	return rate / 1000 * ms
+}
+
+// Process decides whether a mono frame sampled at rate is speech, including
+// the hangover frames that follow speech
+func (v *VAD) Process(rate int, frame []int16) (bool, error) {
+	if !ValidRateAndFrameLength(rate, len(frame)) {
+		return false, fmt.Errorf("%w: %d samples at %dHz", ErrInvalidFrame, len(frame), rate)
+	}
+
+	var vad int
+	switch rate {
+	case 48000:
+		vad = v.core.calcVad48khz(frame)
+	case 32000:
+		vad = v.core.calcVad32khz(frame)
+	case 16000:
+		vad = v.core.calcVad16khz(frame)
+	default:
+		vad = v.core.calcVad8khz(frame)
+	}
+	return vad > 0, nil
+}
@@ -0,0 +1,134 @@
+package webrtc
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNew(t *testing.T) {
+	for _, mode := range []Mode{-1, 4} {
+		_, err := New(mode)
+		assert.ErrorIs(t, err, ErrInvalidMode)
+	}
+
+	v, err := New(Aggressive)
+	assert.NoError(t, err)
+	assert.Equal(t, Aggressive, v.Mode())
+	assert.ErrorIs(t, v.SetMode(5), ErrInvalidMode)
+	assert.Equal(t, Aggressive, v.Mode())
+}
+
+func TestValidRateAndFrameLength(t *testing.T) {
+	for _, rate := range SampleRates {
+		for _, ms := range FrameTimes {
+			assert.True(t, ValidRateAndFrameLength(rate, FrameLength(rate, ms)))
+		}
+		assert.False(t, ValidRateAndFrameLength(rate, FrameLength(rate, 40)))
+		assert.False(t, ValidRateAndFrameLength(rate, FrameLength(rate, 10)+1))
+	}
+	assert.False(t, ValidRateAndFrameLength(22050, 220))
+
+	v, _ := New(Quality)
+	_, err := v.Process(44100, make([]int16, 441))
+	assert.ErrorIs(t, err, ErrInvalidFrame)
+}
+
+// zeros are never speech, and i*i is speech in every mode at every rate
+func TestProcess(t *testing.T) {
+	for mode := Quality; mode <= VeryAggressive; mode++ {
+		v, _ := New(mode)
+		for _, rate := range SampleRates {
+			for _, ms := range FrameTimes {
+				speech, err := v.Process(rate, make([]int16, FrameLength(rate, ms)))
+				assert.NoError(t, err)
+				assert.False(t, speech, "zeros at %dHz %dms in mode %d", rate, ms, mode)
+			}
+		}
+
+		for _, rate := range SampleRates {
+			for _, ms := range FrameTimes {
+				speech, err := v.Process(rate, squares(FrameLength(rate, ms)))
+				assert.NoError(t, err)
+				assert.True(t, speech, "i*i at %dHz %dms in mode %d", rate, ms, mode)
+			}
+		}
+	}
+}
+
+func readPCM(t *testing.T, path string) []int16 {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read error - %s", err)
+	}
+
+	samples := make([]int16, len(b)/2)
+	for i := range samples {
+		samples[i] = int16(binary.LittleEndian.Uint16(b[2*i:]))
+	}
+	return samples
+}
+
+// decide runs a fresh detector over samples frame by frame and returns its
+// decisions as a string of 0s and 1s
+func decide(t *testing.T, mode Mode, rate, ms int, samples []int16) string {
+	v, err := New(mode)
+	if err != nil {
+		t.Fatalf("vad error - %s", err)
+	}
+
+	var decisions strings.Builder
+	length := FrameLength(rate, ms)
+	for len(samples) >= length {
+		speech, err := v.Process(rate, samples[:length])
+		if err != nil {
+			t.Fatalf("process error - %s", err)
+		}
+		if speech {
+			decisions.WriteByte('1')
+		} else {
+			decisions.WriteByte('0')
+		}
+		samples = samples[length:]
+	}
+	return decisions.String()
+}
+
+// TestConformance runs each test vector, 16 bit little endian mono PCM, in
+// every mode and frame length and compares the decisions with the reference
+// C implementation's, listed next to it one line of "mode ms decisions" each.
+// testdata/README has where they came from.
+func TestConformance(t *testing.T) {
+	for _, vector := range []string{"vowels", "mixed"} {
+		for _, rate := range SampleRates {
+			name := fmt.Sprintf("testdata/%s_%dk", vector, rate/1000)
+			samples := readPCM(t, name+".pcm")
+
+			var lines []string
+			for mode := Quality; mode <= VeryAggressive; mode++ {
+				for _, ms := range FrameTimes {
+					lines = append(lines, fmt.Sprintf("%d %d %s", mode, ms, decide(t, mode, rate, ms, samples)))
+				}
+			}
+
+			f, err := os.Open(name + ".txt")
+			if err != nil {
+				t.Fatalf("open error - %s", err)
+			}
+
+			var expected []string
+			scanner := bufio.NewScanner(f)
+			for scanner.Scan() {
+				expected = append(expected, scanner.Text())
+			}
+			f.Close()
+			assert.Equal(t, expected, lines, filepath.Base(name))
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package vad
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWebRTCSpeech(t *testing.T) {
+	// 22050Hz is resampled to 16000Hz for the detector
+	for _, rate := range []float64{16000, 22050} {
+		rng := rand.New(rand.NewSource(4))
+		cfg := spectralConfig(WebRTCMethod)
+		cfg.SampleRate = rate
+		v, err := NewVAD(cfg)
+		assert.NoError(t, err)
+
+		n := int(rate)
+		v.Process(noise(1e6, n, rng))
+		assert.False(t, v.Speaking(), "%gHz", rate)
+
+		events := v.Process(voiced(2e8, n, rng))
+		assert.Equal(t, 1, starts(events), "%gHz", rate)
+
+		events = v.Process(noise(1e6, 2*n, rng))
+		assert.Len(t, events, 1, "%gHz", rate)
+		assert.False(t, v.Speaking(), "%gHz", rate)
+	}
+}
+
+func TestValidateAggressiveness(t *testing.T) {
+	cfg := spectralConfig(WebRTCMethod)
+	assert.NoError(t, cfg.Validate())
+
+	cfg.Aggressiveness = 4
+	assert.ErrorIs(t, cfg.Validate(), ErrInvalidVADConfig)
+
+	// only the WebRTC method reads it
+	cfg.Method = SpectralMethod
+	assert.NoError(t, cfg.Validate())
+}
+
+func TestNewWebRTCDetectorError(t *testing.T) {
+	// NewWebRTCDetector is not behind Validate, so it reports a bad
+	// aggressiveness itself rather than leaving a nil detector
+	cfg := spectralConfig(WebRTCMethod)
+	cfg.Aggressiveness = -1
+	d, err := NewWebRTCDetector(cfg)
+	assert.ErrorIs(t, err, ErrInvalidVADConfig)
+	assert.Nil(t, d)
+
+	cfg.Aggressiveness = DefaultAggressiveness
+	d, err = NewWebRTCDetector(cfg)
+	assert.NoError(t, err)
+	assert.NotNil(t, d)
+}
@@ -2,86 +2,192 @@ package wavseg
 
 import (
 	"bytes"
+	"io"
 	"math"
+	"time"
 
 	"github.com/garlicgarrison/go-recorder/codec"
+	"github.com/garlicgarrison/go-recorder/diarize"
+	"github.com/garlicgarrison/go-recorder/label"
+	"github.com/garlicgarrison/go-recorder/vad"
 )
 
 const (
-	DefaultThreshold     = 0.1
+	// Deprecated: WavSeg finds speech with the vad package; tune
+	// vad.VADConfig.SpeechThreshold instead.
+	DefaultThreshold = 0.1
+	// Deprecated: tune vad.VADConfig.SilenceTimeframe instead.
 	DefaultMinSilentTime = 300 // milliseconds
 
 	DefaultCutoffSpeechInterval = 80 // milliseconds
 )
 
+// WavSeg cuts a WAV file into its speech segments, as a VAD with the default
+// config would find them live
 func WavSeg(wav *bytes.Buffer) []*bytes.Buffer {
+	return WavSegWithConfig(wav, vad.DefaultVADConfig())
+}
+
+// WavSegWithConfig cuts a WAV file into the speech segments vad.AnalyzeFile
+// finds with cfg, dropping those shorter than DefaultCutoffSpeechInterval.
+// Set cfg.NonSpeech to vad.DropNonSpeech to drop music and noise too.
+func WavSegWithConfig(wav *bytes.Buffer, cfg *vad.VADConfig) []*bytes.Buffer {
 	w := &codec.WAVFile{}
 	err := w.DecodeWAV(wav)
 	if err != nil {
 		return nil
 	}
 
-	threshold := DefaultThreshold * rms(w.Data)
-	var chunks [][]int32
-	var chunkStart int
-	var chunkEnd int
-	var inChunk bool
-	var silenceLength int
-
-	for i := 0; i < len(w.Data); i += 2 {
-		amplitude := float64(w.Data[i])
-
-		if amplitude > threshold {
-			silenceLength = 0
-			if !inChunk {
-				chunkStart = i
-				inChunk = true
-			}
-		} else {
-			silenceLength++
-			if inChunk && silenceLength > minSilenceLength(w.Header.SampleRate) {
-				chunkEnd = i
-				inChunk = false
-				chunks = append(chunks, w.Data[chunkStart:chunkEnd])
-			}
+	segments, err := vad.AnalyzeFile(cfg, w)
+	if err != nil {
+		return nil
+	}
+
+	toRet := []*bytes.Buffer{}
+	for _, segment := range segments {
+		buf, err := cut(w, segment.Start, segment.End)
+		if err != nil {
+			return nil
 		}
+		if buf != nil {
+			toRet = append(toRet, buf)
+		}
+	}
+	return toRet
+}
+
+// Tagged is a segment of a WAV file and what it sounds like
+type Tagged struct {
+	Class vad.Class
+	Start time.Duration
+	End   time.Duration
+	WAV   *bytes.Buffer
+}
+
+// WavSegTagged cuts a WAV file into the segments vad.AnalyzeFile finds with
+// cfg, each classified as speech, music or noise, dropping those shorter
+// than DefaultCutoffSpeechInterval. An empty cfg.NonSpeech tags them all.
+func WavSegTagged(wav *bytes.Buffer, cfg *vad.VADConfig) ([]Tagged, error) {
+	if cfg == nil {
+		return nil, vad.ErrInvalidVADConfig
+	}
+
+	w := &codec.WAVFile{}
+	err := w.DecodeWAV(wav)
+	if err != nil {
+		return nil, err
 	}
 
-	if inChunk {
-		chunks = append(chunks, w.Data[chunkStart:])
+	tagCfg := *cfg
+	if tagCfg.NonSpeech == "" {
+		tagCfg.NonSpeech = vad.TagNonSpeech
+	}
+	segments, err := vad.AnalyzeFile(&tagCfg, w)
+	if err != nil {
+		return nil, err
 	}
 
-	toRet := []*bytes.Buffer{}
-	for _, chunk := range chunks {
-		if len(chunk) < chunkLength(w.Header.SampleRate) {
+	var toRet []Tagged
+	for _, segment := range segments {
+		buf, err := cut(w, segment.Start, segment.End)
+		if err != nil {
+			return nil, err
+		}
+		if buf == nil {
 			continue
 		}
 
-		f := codec.NewDefaultWAV(chunk)
-		f.Header = w.Header
+		toRet = append(toRet, Tagged{
+			Class: segment.Class,
+			Start: segment.Start,
+			End:   segment.End,
+			WAV:   buf,
+		})
+	}
+	return toRet, nil
+}
+
+// Speech is a segment of a WAV file and who is speaking in it
+type Speech struct {
+	Speaker string
+	Start   time.Duration
+	End     time.Duration
+	WAV     *bytes.Buffer
+}
+
+// WavSegSpeakers cuts a WAV file into turns by speaker, as diarize.Diarize
+// finds them with cfg, dropping those shorter than
+// DefaultCutoffSpeechInterval
+func WavSegSpeakers(wav *bytes.Buffer, cfg *diarize.Config) ([]Speech, error) {
+	w := &codec.WAVFile{}
+	err := w.DecodeWAV(wav)
+	if err != nil {
+		return nil, err
+	}
+
+	turns, err := diarize.Diarize(cfg, w)
+	if err != nil {
+		return nil, err
+	}
 
-		buf, err := f.EncodeWAV()
+	var toRet []Speech
+	for _, turn := range turns {
+		buf, err := cut(w, turn.Start, turn.End)
 		if err != nil {
-			return nil
+			return nil, err
+		}
+		if buf == nil {
+			continue
 		}
 
-		toRet = append(toRet, buf)
+		toRet = append(toRet, Speech{
+			Speaker: turn.Name(),
+			Start:   turn.Start,
+			End:     turn.End,
+			WAV:     buf,
+		})
 	}
-	return toRet
+	return toRet, nil
 }
 
-func rms(chunk []int32) float64 {
-	sum := float64(0)
-	for _, c := range chunk {
-		sum += math.Pow(float64(c), 2)
+// WriteRTTM writes the turns WavSegSpeakers found as the SPEAKER lines of
+// an RTTM file
+func WriteRTTM(w io.Writer, file string, speech []Speech) error {
+	labels := make([]label.Label, len(speech))
+	for i, s := range speech {
+		labels[i] = label.Label{Start: s.Start, End: s.End, Name: s.Speaker}
 	}
-	return math.Sqrt(sum / float64(len(chunk)))
+	return label.WriteRTTM(w, file, labels)
+}
+
+// cut encodes the part of a WAV file between two times, or returns nil if
+// it is shorter than DefaultCutoffSpeechInterval
+func cut(w *codec.WAVFile, from, to time.Duration) (*bytes.Buffer, error) {
+	start := sampleIndex(w.Header, from.Seconds())
+	end := sampleIndex(w.Header, to.Seconds())
+	if end > len(w.Data) {
+		end = len(w.Data)
+	}
+
+	chunk := w.Data[start:end]
+	if len(chunk) < chunkLength(w.Header) {
+		return nil, nil
+	}
+
+	// the source's format, but the sizes of the chunk
+	f := codec.NewDefaultWAV(chunk)
+	f.Header = w.Header
+	f.Header.TotalSize = uint32(36 + 4*len(chunk))
+	return f.EncodeWAV()
 }
 
-func minSilenceLength(sampleRate uint32) int {
-	return int((float32(DefaultMinSilentTime) / 1000.0) * float32(sampleRate))
+// sampleIndex is the index in the interleaved data of the frame at a time
+func sampleIndex(header codec.WAVHeader, seconds float64) int {
+	frame := int(math.Round(seconds * float64(header.SampleRate)))
+	return frame * int(header.NumChannels)
 }
 
-func chunkLength(sampleRate uint32) int {
-	return int((float32(DefaultCutoffSpeechInterval) / 1000.0) * float32(sampleRate))
+func chunkLength(header codec.WAVHeader) int {
+	frames := int((float32(DefaultCutoffSpeechInterval) / 1000.0) * float32(header.SampleRate))
+	return frames * int(header.NumChannels)
 }
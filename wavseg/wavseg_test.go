@@ -2,12 +2,19 @@ package wavseg
 
 import (
 	"bytes"
+	"encoding/binary"
 	"fmt"
 	"math"
+	"math/rand"
 	"os"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/garlicgarrison/go-recorder/codec"
+	"github.com/garlicgarrison/go-recorder/diarize"
+	"github.com/garlicgarrison/go-recorder/label"
+	"github.com/garlicgarrison/go-recorder/vad"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -84,3 +91,213 @@ func TestWavSeg(t *testing.T) {
 		}
 	}
 }
+
+// each segment's RIFF and data sizes are its own, not the source file's
+func TestSegmentSizes(t *testing.T) {
+	waves := getTestData(2)
+	waves = append(waves, getTestDataSilence(1)...)
+	waves = append(waves, getTestData(2)...)
+
+	b, err := codec.NewDefaultWAV(waves).EncodeWAV()
+	assert.NoError(t, err)
+
+	buffers := WavSeg(b)
+	assert.Len(t, buffers, 2)
+	for _, segment := range buffers {
+		data := segment.Bytes()
+		assert.Equal(t, uint32(len(data)-8), binary.LittleEndian.Uint32(data[4:8]))
+		assert.Equal(t, uint32(len(data)-44), binary.LittleEndian.Uint32(data[40:44]))
+	}
+}
+
+const testRate = 16000
+
+// recording builds a 16kHz WAV file piece by piece
+type recording struct {
+	rng     *rand.Rand
+	samples []int32
+}
+
+func (r *recording) at() time.Duration {
+	return time.Duration(len(r.samples)) * time.Second / testRate
+}
+
+func (r *recording) pause(seconds float64) {
+	for i := 0; i < int(seconds*testRate); i++ {
+		r.samples = append(r.samples, int32(1e5*r.rng.NormFloat64()))
+	}
+}
+
+// voice is harmonics of a wavering pitch shaped by two wandering formants
+func (r *recording) voice(pitch, f1, f2, seconds float64) {
+	phase := 0.0
+	for i := 0; i < int(seconds*testRate); i++ {
+		t := float64(i) / testRate
+		f0 := pitch * (1 + 0.08*math.Sin(2*math.Pi*0.9*t))
+		phase += 2 * math.Pi * f0 / testRate
+		a := f1 * (1 + 0.15*math.Sin(2*math.Pi*1.7*t))
+		b := f2 * (1 + 0.1*math.Sin(2*math.Pi*2.3*t+1))
+
+		v := 0.0
+		for h := 1; float64(h)*f0 < 4000; h++ {
+			f := float64(h) * f0
+			gain := math.Exp(-math.Pow((f-a)/150, 2)) + 0.6*math.Exp(-math.Pow((f-b)/250, 2)) + 0.02
+			v += gain * math.Sin(float64(h)*phase)
+		}
+		envelope := 0.6 + 0.4*math.Sin(2*math.Pi*4*t)
+		r.samples = append(r.samples, int32(1e8*envelope*v+1e5*r.rng.NormFloat64()))
+	}
+}
+
+func (r *recording) wav(t *testing.T) *bytes.Buffer {
+	w := codec.NewDefaultWAV(r.samples)
+	w.Header.SampleRate = testRate
+	w.Header.ByteRate = testRate * 4
+	b, err := w.EncodeWAV()
+	assert.NoError(t, err)
+	return b
+}
+
+// frames decodes a segment and counts its frames
+func frames(t *testing.T, b *bytes.Buffer) int {
+	w := &codec.WAVFile{}
+	assert.NoError(t, w.DecodeWAV(bytes.NewBuffer(b.Bytes())))
+	return len(w.Data)
+}
+
+func TestWavSegSpeakers(t *testing.T) {
+	r := &recording{rng: rand.New(rand.NewSource(1))}
+	var starts, ends []time.Duration
+	say := func(pitch, f1, f2, seconds float64) {
+		starts = append(starts, r.at())
+		r.voice(pitch, f1, f2, seconds)
+		ends = append(ends, r.at())
+	}
+	r.pause(1)
+	say(110, 500, 1500, 3)
+	r.pause(1.5)
+	say(220, 850, 2600, 3)
+	r.pause(1.5)
+	say(110, 500, 1500, 2.5)
+	r.pause(1.5)
+
+	speech, err := WavSegSpeakers(r.wav(t), diarize.DefaultConfig())
+	assert.NoError(t, err)
+	assert.Len(t, speech, 3)
+	if len(speech) != 3 {
+		return
+	}
+
+	for i, want := range []string{"speaker_0", "speaker_1", "speaker_0"} {
+		assert.Equal(t, want, speech[i].Speaker)
+		assert.InDelta(t, starts[i], speech[i].Start, float64(300*time.Millisecond), "turn %d", i)
+		assert.InDelta(t, ends[i], speech[i].End, float64(300*time.Millisecond), "turn %d", i)
+
+		length := speech[i].End - speech[i].Start
+		assert.InDelta(t, int(length*testRate/time.Second), frames(t, speech[i].WAV), 1, "turn %d", i)
+	}
+
+	var rttm bytes.Buffer
+	assert.NoError(t, WriteRTTM(&rttm, "interview", speech))
+	lines := strings.Split(strings.TrimSpace(rttm.String()), "\n")
+	assert.Len(t, lines, 3)
+	for i, line := range lines {
+		assert.True(t, strings.HasPrefix(line, "SPEAKER interview 1 "), line)
+		assert.True(t, strings.HasSuffix(line, " <NA> <NA> "+speech[i].Speaker+" <NA> <NA>"), line)
+	}
+
+	labels, err := label.ParseRTTM(&rttm)
+	assert.NoError(t, err)
+	assert.Len(t, labels, 3)
+	for i, l := range labels {
+		assert.Equal(t, speech[i].Speaker, l.Name)
+		assert.InDelta(t, speech[i].Start, l.Start, float64(time.Millisecond))
+		assert.InDelta(t, speech[i].End, l.End, float64(time.Millisecond))
+	}
+}
+
+// hold is a chord held for a while, like hold music
+func (r *recording) hold(seconds float64) {
+	for i := 0; i < int(seconds*testRate); i++ {
+		t := float64(i) / testRate
+		v := 0.0
+		for _, f := range []float64{261.63, 329.63, 392} {
+			for h := 1.0; h <= 4; h++ {
+				v += math.Sin(2*math.Pi*f*h*t) / h
+			}
+		}
+		r.samples = append(r.samples, int32(1e8*v))
+	}
+}
+
+// talk alternates a voiced glide with a burst of hiss five times a second,
+// with a pause now and then
+func (r *recording) talk(seconds float64) {
+	phase := 0.0
+	for i := 0; i < int(seconds*testRate); i++ {
+		t := float64(i) / testRate
+		syllable := int(t / 0.2)
+		x := math.Mod(t, 0.2) / 0.2
+		switch {
+		case syllable%4 == 3:
+			r.samples = append(r.samples, int32(1e5*r.rng.NormFloat64()))
+		case x < 0.6:
+			f0 := 140 - 40*x + float64(syllable%3)*15
+			phase += 2 * math.Pi * f0 / testRate
+			v := 0.0
+			for h := 1.0; h <= 12; h++ {
+				v += math.Sin(h*phase) / h
+			}
+			r.samples = append(r.samples, int32(3e8*math.Sin(math.Pi*x/0.6)*v))
+		default:
+			r.samples = append(r.samples, int32(3e7*r.rng.NormFloat64()))
+		}
+	}
+}
+
+func TestWavSegTagged(t *testing.T) {
+	r := &recording{rng: rand.New(rand.NewSource(1))}
+	r.pause(1)
+	musicStart := r.at()
+	r.hold(3)
+	musicEnd := r.at()
+	r.pause(2)
+	talkStart := r.at()
+	r.talk(3)
+	talkEnd := r.at()
+	r.pause(2)
+
+	// tagging is the default, without touching the caller's config
+	tagCfg := vad.DefaultVADConfig()
+	tagged, err := WavSegTagged(r.wav(t), tagCfg)
+	assert.NoError(t, err)
+	assert.Equal(t, vad.NonSpeech(""), tagCfg.NonSpeech)
+
+	dropCfg := vad.DefaultVADConfig()
+	dropCfg.NonSpeech = vad.DropNonSpeech
+	dropped, err := WavSegTagged(r.wav(t), dropCfg)
+	assert.NoError(t, err)
+
+	// tagging keeps the hold music, dropping leaves only the talking
+	assert.Len(t, tagged, 2)
+	assert.Len(t, dropped, 1)
+	if len(tagged) != 2 || len(dropped) != 1 {
+		return
+	}
+	assert.Equal(t, vad.MusicClass, tagged[0].Class)
+	assert.Equal(t, vad.SpeechClass, tagged[1].Class)
+	assert.Equal(t, vad.SpeechClass, dropped[0].Class)
+
+	slack := float64(100 * time.Millisecond)
+	assert.InDelta(t, musicStart, tagged[0].Start, slack)
+	assert.InDelta(t, musicEnd, tagged[0].End, slack)
+	for _, speech := range []Tagged{tagged[1], dropped[0]} {
+		assert.InDelta(t, talkStart, speech.Start, slack)
+		assert.InDelta(t, talkEnd, speech.End, slack)
+
+		length := speech.End - speech.Start
+		assert.InDelta(t, int(length*testRate/time.Second), frames(t, speech.WAV), 1)
+	}
+	assert.Equal(t, tagged[1].Start, dropped[0].Start)
+	assert.Equal(t, tagged[1].End, dropped[0].End)
+}